@@ -0,0 +1,53 @@
+// +build !js
+
+package webrtc
+
+import (
+	"sync"
+	"time"
+)
+
+// bitrateWindow is the duration the bitrate of received RTP is averaged over
+const bitrateWindow = time.Second
+
+// bitrateSample is the size of a packet and when it was received
+type bitrateSample struct {
+	at    time.Time
+	bytes int
+}
+
+// bitrateEstimator estimates a bitrate from the sizes of the packets received
+// within the last bitrateWindow
+type bitrateEstimator struct {
+	mu      sync.Mutex
+	samples []bitrateSample
+	bytes   int
+}
+
+// add counts a packet of the given size received at the given time
+func (e *bitrateEstimator) add(at time.Time, bytes int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.samples = append(e.samples, bitrateSample{at: at, bytes: bytes})
+	e.bytes += bytes
+	e.expire(at)
+}
+
+// estimate returns the bitrate in bits per second at the given time
+func (e *bitrateEstimator) estimate(now time.Time) float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.expire(now)
+	return float64(e.bytes*8) / bitrateWindow.Seconds()
+}
+
+// expire drops the samples that are older than bitrateWindow, e.mu must be held
+func (e *bitrateEstimator) expire(now time.Time) {
+	i := 0
+	for ; i < len(e.samples) && now.Sub(e.samples[i].at) >= bitrateWindow; i++ {
+		e.bytes -= e.samples[i].bytes
+	}
+	e.samples = e.samples[i:]
+}
@@ -0,0 +1,41 @@
+// +build !js
+
+package webrtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitrateEstimator(t *testing.T) {
+	start := time.Now()
+
+	// Three simulcast layers, each sends 50 packets per second
+	layers := map[string]int{"q": 250, "h": 1000, "f": 2500}
+	estimators := map[string]*bitrateEstimator{}
+	for rid := range layers {
+		estimators[rid] = &bitrateEstimator{}
+	}
+
+	var last time.Time
+	for at := start; at.Sub(start) < 3*time.Second; at = at.Add(20 * time.Millisecond) {
+		for rid, packetSize := range layers {
+			estimators[rid].add(at, packetSize)
+		}
+		last = at
+	}
+
+	for rid, packetSize := range layers {
+		assert.Equal(t, float64(packetSize*8*50), estimators[rid].estimate(last), "layer: %s", rid)
+	}
+
+	// Nothing was received within the last second
+	for rid := range layers {
+		assert.Equal(t, float64(0), estimators[rid].estimate(last.Add(time.Second)), "layer: %s", rid)
+	}
+
+	var empty bitrateEstimator
+	assert.Equal(t, float64(0), empty.estimate(start))
+}
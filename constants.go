@@ -7,6 +7,9 @@ const (
 	unknownStr = "unknown"
 	ssrcStr    = "ssrc"
 
+	// sdpAttributeICEOptions is the SDP attribute listing the supported ICE options
+	sdpAttributeICEOptions = "ice-options"
+
 	// Equal to UDP MTU
 	receiveMTU = 1460
 )
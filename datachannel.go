@@ -328,34 +328,37 @@ func (d *DataChannel) readLoop() {
 	}
 }
 
-// Send sends the binary message to the DataChannel peer
+// Send sends the binary message to the DataChannel peer. Messages up to
+// SCTPTransport.MaxMessageSize are split into as many SCTP chunks as needed and
+// reassembled by the peer, larger messages are a TypeError. SCTP can't carry
+// empty messages, an empty message is sent as a single zero byte.
 func (d *DataChannel) Send(data []byte) error {
-	err := d.ensureOpen()
-	if err != nil {
-		return err
-	}
-
-	if len(data) == 0 {
-		data = []byte{0}
-	}
-
-	_, err = d.dataChannel.WriteDataChannel(data, false)
-	return err
+	return d.send(data, false)
 }
 
-// SendText sends the text message to the DataChannel peer
+// SendText sends the text message to the DataChannel peer, like Send
 func (d *DataChannel) SendText(s string) error {
+	return d.send([]byte(s), true)
+}
+
+func (d *DataChannel) send(data []byte, isString bool) error {
 	err := d.ensureOpen()
 	if err != nil {
 		return err
 	}
 
-	data := []byte(s)
+	d.mu.RLock()
+	sctpTransport := d.sctpTransport
+	d.mu.RUnlock()
+	if float64(len(data)) > sctpTransport.MaxMessageSize() {
+		return &rtcerr.TypeError{Err: ErrDataChannelMessageTooLarge}
+	}
+
 	if len(data) == 0 {
 		data = []byte{0}
 	}
 
-	_, err = d.dataChannel.WriteDataChannel(data, true)
+	_, err = d.dataChannel.WriteDataChannel(data, isString)
 	return err
 }
 
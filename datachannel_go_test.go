@@ -10,13 +10,16 @@ import (
 	"io/ioutil"
 	"math/big"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/pion/datachannel"
 	"github.com/pion/logging"
+	"github.com/pion/sdp/v2"
 	"github.com/pion/transport/test"
+	"github.com/pion/webrtc/v2/pkg/rtcerr"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -528,3 +531,300 @@ func TestEOF(t *testing.T) {
 		<-dcbClosedCh // (2)
 	})
 }
+
+func TestDataChannel_NoMedia(t *testing.T) {
+	to := test.TimeOut(time.Second * 20)
+	defer to.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	offerPC, answerPC, err := newPair()
+	assert.NoError(t, err)
+
+	answerPC.OnDataChannel(func(d *DataChannel) {
+		if d.Label() != expectedLabel {
+			return
+		}
+		d.OnMessage(func(msg DataChannelMessage) {
+			assert.NoError(t, d.Send(append([]byte("echo "), msg.Data...)))
+		})
+	})
+
+	dc, err := offerPC.CreateDataChannel(expectedLabel, nil)
+	assert.NoError(t, err)
+
+	echoed := make(chan []byte, 1)
+	dc.OnOpen(func() {
+		assert.NoError(t, dc.SendText("ping"))
+	})
+	dc.OnMessage(func(msg DataChannelMessage) {
+		echoed <- msg.Data
+	})
+
+	assert.NoError(t, signalPair(offerPC, answerPC))
+
+	// Both sides only negotiate the application media section
+	for _, desc := range []*SessionDescription{offerPC.LocalDescription(), answerPC.LocalDescription()} {
+		parsed := sdp.SessionDescription{}
+		assert.NoError(t, parsed.Unmarshal([]byte(desc.SDP)))
+		assert.Equal(t, 1, len(parsed.MediaDescriptions))
+		assert.Equal(t, "application", parsed.MediaDescriptions[0].MediaName.Media)
+	}
+	assert.Empty(t, offerPC.GetTransceivers())
+	assert.Empty(t, answerPC.GetTransceivers())
+
+	assert.Equal(t, []byte("echo ping"), <-echoed)
+
+	closePairNow(t, offerPC, answerPC)
+}
+
+func TestDataChannel_MaxChannels(t *testing.T) {
+	s := SettingEngine{}
+	s.SetSCTPMaxChannels(4)
+	api := NewAPI(WithSettingEngine(s))
+
+	pc, err := api.NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(4), pc.sctpTransport.MaxChannels())
+
+	// IDs must be lower than the limit
+	id := uint16(4)
+	_, err = pc.CreateDataChannel(expectedLabel, &DataChannelInit{ID: &id})
+	assert.Equal(t, &rtcerr.OperationError{Err: ErrMaxDataChannelID}, err)
+
+	for i := 0; i < 4; i++ {
+		_, err = pc.CreateDataChannel(expectedLabel, nil)
+		assert.NoError(t, err)
+	}
+	_, err = pc.CreateDataChannel(expectedLabel, nil)
+	assert.Equal(t, &rtcerr.OperationError{Err: ErrMaxDataChannels}, err)
+
+	assert.NoError(t, pc.Close())
+}
+
+func TestDataChannel_MessageSize(t *testing.T) {
+	to := test.TimeOut(time.Second * 20)
+	defer to.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	offerPC, answerPC, err := newPair()
+	assert.NoError(t, err)
+
+	received := make(chan DataChannelMessage, 2)
+	answerPC.OnDataChannel(func(d *DataChannel) {
+		if d.Label() != expectedLabel {
+			return
+		}
+		assert.Equal(t, answerPC.sctpTransport, d.Transport())
+		d.OnMessage(func(msg DataChannelMessage) {
+			received <- msg
+		})
+	})
+
+	dc, err := offerPC.CreateDataChannel(expectedLabel, nil)
+	assert.NoError(t, err)
+	opened := make(chan struct{})
+	dc.OnOpen(func() {
+		close(opened)
+	})
+
+	assert.NoError(t, signalPair(offerPC, answerPC))
+	<-opened
+
+	maxMessageSize := int(offerPC.sctpTransport.MaxMessageSize())
+	assert.Equal(t, 65535, maxMessageSize)
+
+	// A message of the maximum size is fragmented and reassembled
+	large := make([]byte, maxMessageSize)
+	_, err = rand.Read(large)
+	assert.NoError(t, err)
+	assert.NoError(t, dc.Send(large))
+	msg := <-received
+	assert.False(t, msg.IsString)
+	assert.True(t, bytes.Equal(large, msg.Data))
+
+	assert.Equal(t, &rtcerr.TypeError{Err: ErrDataChannelMessageTooLarge}, dc.Send(make([]byte, maxMessageSize+1)))
+	assert.Equal(t, &rtcerr.TypeError{Err: ErrDataChannelMessageTooLarge}, dc.SendText(string(make([]byte, maxMessageSize+1))))
+
+	// Empty messages arrive as a single zero byte
+	assert.NoError(t, dc.SendText(""))
+	msg = <-received
+	assert.True(t, msg.IsString)
+	assert.Equal(t, []byte{0}, msg.Data)
+
+	closePairNow(t, offerPC, answerPC)
+}
+
+func TestDataChannel_RemoteMaxMessageSize(t *testing.T) {
+	to := test.TimeOut(time.Second * 20)
+	defer to.Stop()
+
+	offerPC, answerPC, err := newPair()
+	assert.NoError(t, err)
+
+	answerPC.OnDataChannel(func(d *DataChannel) {})
+
+	dc, err := offerPC.CreateDataChannel(expectedLabel, nil)
+	assert.NoError(t, err)
+	opened := make(chan struct{})
+	dc.OnOpen(func() {
+		close(opened)
+	})
+
+	offer, err := offerPC.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, offerPC.SetLocalDescription(offer))
+	assert.NoError(t, answerPC.SetRemoteDescription(offer))
+
+	answer, err := answerPC.CreateAnswer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, answerPC.SetLocalDescription(answer))
+
+	// The answerer only accepts messages of up to 1024 bytes
+	answer.SDP = strings.Replace(answer.SDP, "a=sctpmap:5000 webrtc-datachannel 1024\r\n", "a=sctpmap:5000 webrtc-datachannel 1024\r\na=max-message-size:1024\r\n", 1)
+	assert.NoError(t, offerPC.SetRemoteDescription(answer))
+	<-opened
+
+	assert.Equal(t, float64(1024), offerPC.sctpTransport.MaxMessageSize())
+	assert.NoError(t, dc.Send(make([]byte, 1024)))
+	assert.Equal(t, &rtcerr.TypeError{Err: ErrDataChannelMessageTooLarge}, dc.Send(make([]byte, 1025)))
+
+	// Without the attribute the default of 64K applies, capped by what pion/sctp sends
+	assert.Equal(t, float64(65535), answerPC.sctpTransport.MaxMessageSize())
+
+	closePairNow(t, offerPC, answerPC)
+}
+
+func TestDataChannel_CloseOneOfMany(t *testing.T) {
+	to := test.TimeOut(time.Second * 20)
+	defer to.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	offerPC, answerPC, err := newPair()
+	assert.NoError(t, err)
+
+	type remoteChannel struct {
+		*DataChannel
+		closed   chan struct{}
+		messages chan DataChannelMessage
+	}
+	remoteChannels := make(chan remoteChannel, 2)
+	answerPC.OnDataChannel(func(d *DataChannel) {
+		if d.Label() == "initial_data_channel" {
+			return
+		}
+		r := remoteChannel{d, make(chan struct{}), make(chan DataChannelMessage, 10)}
+		d.OnClose(func() {
+			close(r.closed)
+		})
+		d.OnMessage(func(msg DataChannelMessage) {
+			r.messages <- msg
+		})
+		remoteChannels <- r
+	})
+
+	createChannel := func(label string) (*DataChannel, chan struct{}, chan DataChannelMessage) {
+		dc, err := offerPC.CreateDataChannel(label, nil)
+		assert.NoError(t, err)
+		closed := make(chan struct{})
+		dc.OnClose(func() {
+			close(closed)
+		})
+		messages := make(chan DataChannelMessage, 10)
+		dc.OnMessage(func(msg DataChannelMessage) {
+			messages <- msg
+		})
+		return dc, closed, messages
+	}
+	closing, closingClosed, _ := createChannel("closing")
+	staying, _, stayingMessages := createChannel("staying")
+
+	assert.NoError(t, signalPair(offerPC, answerPC))
+
+	remotes := map[string]remoteChannel{}
+	for len(remotes) < 2 {
+		r := <-remoteChannels
+		remotes[r.Label()] = r
+	}
+
+	// Closing one DataChannel resets its stream, both ends are closed
+	assert.NoError(t, closing.Close())
+	<-closingClosed
+	<-remotes["closing"].closed
+	assert.Equal(t, DataChannelStateClosed, closing.ReadyState())
+	assert.Equal(t, DataChannelStateClosed, remotes["closing"].ReadyState())
+
+	// The other DataChannel keeps working in both directions
+	assert.Equal(t, DataChannelStateOpen, staying.ReadyState())
+	assert.NoError(t, staying.SendText("ping"))
+	assert.Equal(t, []byte("ping"), (<-remotes["staying"].messages).Data)
+	assert.NoError(t, remotes["staying"].SendText("pong"))
+	assert.Equal(t, []byte("pong"), (<-stayingMessages).Data)
+
+	select {
+	case <-remotes["staying"].closed:
+		t.Fatal("closing one DataChannel closed another")
+	default:
+	}
+
+	closePairNow(t, offerPC, answerPC)
+}
+
+func TestDataChannel_RejectedByAnswer(t *testing.T) {
+	to := test.TimeOut(time.Second * 20)
+	defer to.Stop()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	offerPC, answerPC, err := api.newPair(Configuration{})
+	assert.NoError(t, err)
+
+	_, err = offerPC.AddTransceiverFromKind(RTPCodecTypeVideo)
+	assert.NoError(t, err)
+	_, err = offerPC.CreateDataChannel(expectedLabel, nil)
+	assert.NoError(t, err)
+	answerPC.OnDataChannel(func(d *DataChannel) {
+		assert.Fail(t, "DataChannel of a rejected application media section")
+	})
+
+	connected := make(chan struct{})
+	answerPC.OnConnectionStateChange(func(state PeerConnectionState) {
+		if state == PeerConnectionStateConnected {
+			close(connected)
+		}
+	})
+
+	offer, err := offerPC.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, offerPC.SetLocalDescription(offer))
+	assert.NoError(t, answerPC.SetRemoteDescription(offer))
+
+	answer, err := answerPC.CreateAnswer(&AnswerOptions{RejectDataChannels: true})
+	assert.NoError(t, err)
+	assert.NoError(t, answerPC.SetLocalDescription(answer))
+	assert.NoError(t, offerPC.SetRemoteDescription(answer))
+
+	parsed := sdp.SessionDescription{}
+	assert.NoError(t, parsed.Unmarshal([]byte(answer.SDP)))
+	assert.Equal(t, 2, len(parsed.MediaDescriptions))
+	assert.Equal(t, "application", parsed.MediaDescriptions[1].MediaName.Media)
+	assert.Equal(t, 0, parsed.MediaDescriptions[1].MediaName.Port.Value)
+	assert.False(t, strings.Contains(answer.SDP, "BUNDLE 0 1"))
+
+	// Neither side starts SCTP once the transports are up
+	<-connected
+	time.Sleep(100 * time.Millisecond)
+	for _, pc := range []*PeerConnection{offerPC, answerPC} {
+		assert.Equal(t, SCTPTransportStateConnecting, pc.sctpTransport.State())
+		pc.sctpTransport.lock.RLock()
+		assert.Nil(t, pc.sctpTransport.association)
+		pc.sctpTransport.lock.RUnlock()
+	}
+
+	closePairNow(t, offerPC, answerPC)
+}
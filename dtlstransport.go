@@ -16,6 +16,7 @@ import (
 
 	"github.com/pion/dtls/v2"
 	"github.com/pion/dtls/v2/pkg/crypto/fingerprint"
+	"github.com/pion/rtcp"
 	"github.com/pion/srtp"
 	"github.com/pion/webrtc/v2/internal/mux"
 	"github.com/pion/webrtc/v2/internal/util"
@@ -35,8 +36,19 @@ type DTLSTransport struct {
 	remoteCertificate []byte
 	state             DTLSTransportState
 
+	// lastError is why the DTLSTransport failed
+	lastError error
+
+	// compoundRTCP is set if the remote doesn't accept reduced-size RTCP, then
+	// every RTCP packet written starts with a Receiver Report
+	compoundRTCP bool
+
 	onStateChangeHdlr func(DTLSTransportState)
 
+	// onUnhandledRTCPHdlr is called with the RTCP the started RTPSenders and
+	// RTPReceivers of the DTLSTransport don't handle, see PeerConnection.OnRTCP
+	onUnhandledRTCPHdlr func([]rtcp.Packet, uint32, *RTPReceiver, *RTPSender)
+
 	conn *dtls.Conn
 
 	srtpSession   *srtp.SessionSRTP
@@ -100,6 +112,13 @@ func (t *DTLSTransport) onStateChange(state DTLSTransportState) {
 	}
 }
 
+// fail sets the state to failed because of err, it requires the caller holds the lock
+func (t *DTLSTransport) fail(err error) error {
+	t.lastError = err
+	t.onStateChange(DTLSTransportStateFailed)
+	return err
+}
+
 // OnStateChange sets a handler that is fired when the DTLS
 // connection state changes.
 func (t *DTLSTransport) OnStateChange(f func(DTLSTransportState)) {
@@ -108,6 +127,24 @@ func (t *DTLSTransport) OnStateChange(f func(DTLSTransportState)) {
 	t.onStateChangeHdlr = f
 }
 
+func (t *DTLSTransport) setOnUnhandledRTCP(f func([]rtcp.Packet, uint32, *RTPReceiver, *RTPSender)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.onUnhandledRTCPHdlr = f
+}
+
+// onUnhandledRTCP passes the RTCP a RTPSender or RTPReceiver received for the
+// given SSRC but didn't handle to the handler of the PeerConnection
+func (t *DTLSTransport) onUnhandledRTCP(pkts []rtcp.Packet, ssrc uint32, receiver *RTPReceiver, sender *RTPSender) {
+	t.lock.RLock()
+	hdlr := t.onUnhandledRTCPHdlr
+	t.lock.RUnlock()
+
+	if hdlr != nil && len(pkts) != 0 {
+		hdlr(pkts, ssrc, receiver, sender)
+	}
+}
+
 // State returns the current dtls transport state.
 func (t *DTLSTransport) State() DTLSTransportState {
 	t.lock.RLock()
@@ -115,6 +152,15 @@ func (t *DTLSTransport) State() DTLSTransportState {
 	return t.state
 }
 
+// LastError returns the error the DTLSTransport failed with, like an error of
+// the DTLS handshake or a remote certificate that doesn't match the signaled
+// fingerprint. It is nil unless the state is DTLSTransportStateFailed.
+func (t *DTLSTransport) LastError() error {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.lastError
+}
+
 // GetLocalParameters returns the DTLS parameters of the local DTLSTransport upon construction.
 func (t *DTLSTransport) GetLocalParameters() (DTLSParameters, error) {
 	fingerprints := []DTLSFingerprint{}
@@ -134,14 +180,32 @@ func (t *DTLSTransport) GetLocalParameters() (DTLSParameters, error) {
 	}, nil
 }
 
-// GetRemoteCertificate returns the certificate chain in use by the remote side
-// returns an empty list prior to selection of the remote certificate
+// GetRemoteCertificate returns the DER encoded certificate the remote
+// authenticated the DTLS handshake with. It returns nil until the DTLS
+// transport is connected.
 func (t *DTLSTransport) GetRemoteCertificate() []byte {
 	t.lock.RLock()
 	defer t.lock.RUnlock()
 	return t.remoteCertificate
 }
 
+// ExportKeyingMaterial exports keying material of the DTLS connection as
+// defined in RFC 5705. The SRTP master keys and salts are exported with the
+// label "EXTRACTOR-dtls_srtp" and no context, which allows external tools to
+// protect and unprotect the media of this transport.
+// https://tools.ietf.org/html/rfc5764#section-4.2
+func (t *DTLSTransport) ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.conn == nil {
+		return nil, fmt.Errorf("the DTLS transport has not started yet")
+	}
+
+	connState := t.conn.ConnectionState()
+	return connState.ExportKeyingMaterial(label, context, length)
+}
+
 func (t *DTLSTransport) startSRTP() error {
 	t.lock.Lock()
 	defer t.lock.Unlock()
@@ -235,6 +299,50 @@ func (t *DTLSTransport) getSRTCPSession() (*srtp.SessionSRTCP, error) {
 	return t.srtcpSession, nil
 }
 
+// writeRTCP marshals and sends RTCP over the SRTCP session of this DTLSTransport
+func (t *DTLSTransport) writeRTCP(pkts []rtcp.Packet) error {
+	t.lock.RLock()
+	compoundRTCP := t.compoundRTCP
+	t.lock.RUnlock()
+
+	if compoundRTCP && len(pkts) != 0 {
+		switch pkts[0].(type) {
+		case *rtcp.SenderReport, *rtcp.ReceiverReport:
+		default:
+			pkts = append([]rtcp.Packet{&rtcp.ReceiverReport{}}, pkts...)
+		}
+	}
+
+	raw, err := rtcp.Marshal(pkts)
+	if err != nil {
+		return err
+	}
+
+	srtcpSession, err := t.getSRTCPSession()
+	if err != nil {
+		return nil
+	}
+
+	writeStream, err := srtcpSession.OpenWriteStream()
+	if err != nil {
+		return fmt.Errorf("WriteRTCP failed to open WriteStream: %v", err)
+	}
+
+	if _, err := writeStream.Write(raw); err != nil {
+		return err
+	}
+	t.api.settingEngine.traceRTCP(true, pkts)
+	return nil
+}
+
+// setReducedSizeRTCP sets if the remote accepts reduced-size RTCP, which
+// doesn't start with a Sender or Receiver Report
+func (t *DTLSTransport) setReducedSizeRTCP(reducedSize bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.compoundRTCP = !reducedSize
+}
+
 func (t *DTLSTransport) role() DTLSRole {
 	// If remote has an explicit role use the inverse
 	switch t.remoteParameters.Role {
@@ -320,36 +428,45 @@ func (t *DTLSTransport) Start(remoteParameters DTLSParameters) error {
 	defer t.lock.Unlock()
 
 	if err != nil {
-		t.onStateChange(DTLSTransportStateFailed)
-		return err
+		return t.fail(fmt.Errorf("DTLS handshake failed: %v", err))
 	}
 
 	t.conn = dtlsConn
+
+	// The remote certificate is available once connected, even if it isn't verified
+	remoteCerts := t.conn.ConnectionState().PeerCertificates
+	if len(remoteCerts) != 0 {
+		t.remoteCertificate = remoteCerts[0]
+	}
 	t.onStateChange(DTLSTransportStateConnected)
 
-	if t.api.settingEngine.disableCertificateFingerprintVerification {
+	pins := t.api.settingEngine.remoteFingerprintPins
+	if t.api.settingEngine.disableCertificateFingerprintVerification && len(pins) == 0 {
 		return nil
 	}
 
 	// Check the fingerprint if a certificate was exchanged
-	remoteCerts := t.conn.ConnectionState().PeerCertificates
 	if len(remoteCerts) == 0 {
-		t.onStateChange(DTLSTransportStateFailed)
-		return fmt.Errorf("peer didn't provide certificate via DTLS")
+		return t.fail(fmt.Errorf("peer didn't provide certificate via DTLS"))
 	}
-	t.remoteCertificate = remoteCerts[0]
 
 	parsedRemoteCert, err := x509.ParseCertificate(t.remoteCertificate)
 	if err != nil {
-		t.onStateChange(DTLSTransportStateFailed)
-		return err
+		return t.fail(err)
 	}
 
-	err = t.validateFingerPrint(parsedRemoteCert)
+	if !t.api.settingEngine.disableCertificateFingerprintVerification {
+		err = t.validateFingerPrint(parsedRemoteCert)
+	}
+	if err == nil && len(pins) != 0 {
+		if err = matchFingerprint(parsedRemoteCert, pins); err != nil {
+			err = fmt.Errorf("remote certificate doesn't match pinned fingerprint: %v", err)
+		}
+	}
 	if err != nil {
-		t.onStateChange(DTLSTransportStateFailed)
+		return t.fail(err)
 	}
-	return err
+	return nil
 }
 
 // Stop stops and closes the DTLSTransport object.
@@ -383,7 +500,12 @@ func (t *DTLSTransport) Stop() error {
 }
 
 func (t *DTLSTransport) validateFingerPrint(remoteCert *x509.Certificate) error {
-	for _, fp := range t.remoteParameters.Fingerprints {
+	return matchFingerprint(remoteCert, t.remoteParameters.Fingerprints)
+}
+
+// matchFingerprint returns nil if the certificate matches any of the fingerprints
+func matchFingerprint(remoteCert *x509.Certificate, fingerprints []DTLSFingerprint) error {
+	for _, fp := range fingerprints {
 		hashAlgo, err := fingerprint.HashFromString(fp.Algorithm)
 		if err != nil {
 			return err
@@ -3,13 +3,21 @@
 package webrtc
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/pion/rtcp"
+	"github.com/pion/srtp"
 	"github.com/pion/transport/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // An invalid fingerprint MUST cause PeerConnectionState to go to PeerConnectionStateFailed
@@ -39,9 +47,14 @@ func TestInvalidFingerprintCausesFailed(t *testing.T) {
 	connectionHasFailed, closeFunc := context.WithCancel(context.Background())
 	pcAnswer.OnConnectionStateChange(func(connectionState PeerConnectionState) {
 		if connectionState == PeerConnectionStateFailed {
+			// The reason is available once the state is failed
+			lastError := pcAnswer.SCTP().Transport().LastError()
+			assert.Error(t, lastError)
+			assert.Contains(t, lastError.Error(), "no matching fingerprint")
 			closeFunc()
 		}
 	})
+	assert.NoError(t, pcAnswer.SCTP().Transport().LastError())
 
 	if _, err = pcOffer.CreateDataChannel("unusedDataChannel", nil); err != nil {
 		t.Fatal(err)
@@ -134,3 +147,266 @@ func TestPeerConnection_DTLSRoleSettingEngine(t *testing.T) {
 		runTest(DTLSRoleClient)
 	})
 }
+
+func TestPeerConnection_AnswerDTLSRole(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	createOffer := func(offerPC *PeerConnection) SessionDescription {
+		gatherComplete := make(chan struct{})
+		offerPC.OnICECandidate(func(candidate *ICECandidate) {
+			if candidate == nil {
+				close(gatherComplete)
+			}
+		})
+		_, err := offerPC.CreateDataChannel("initial_data_channel", nil)
+		require.NoError(t, err)
+
+		offer, err := offerPC.CreateOffer(nil)
+		require.NoError(t, err)
+		require.NoError(t, offerPC.SetLocalDescription(offer))
+		<-gatherComplete
+		return *offerPC.PendingLocalDescription()
+	}
+
+	dtlsRole := func(pc *PeerConnection) DTLSRole {
+		pc.dtlsTransport.lock.RLock()
+		defer pc.dtlsTransport.lock.RUnlock()
+		return pc.dtlsTransport.role()
+	}
+
+	runTest := func(t *testing.T, role DTLSRole, setup string) {
+		offerPC, answerPC, err := newPair()
+		require.NoError(t, err)
+
+		connected := make(chan struct{})
+		answerPC.OnConnectionStateChange(func(connectionState PeerConnectionState) {
+			if connectionState == PeerConnectionStateConnected {
+				close(connected)
+			}
+		})
+
+		require.NoError(t, answerPC.SetRemoteDescription(createOffer(offerPC)))
+
+		// An answer can't leave the role open
+		_, err = answerPC.CreateAnswer(&AnswerOptions{DTLSRole: DTLSRoleAuto})
+		assert.Error(t, err)
+
+		answer, err := answerPC.CreateAnswer(&AnswerOptions{DTLSRole: role})
+		require.NoError(t, err)
+		assert.Regexp(t, "(?m)^a=setup:"+setup+"\r$", answer.SDP)
+		assert.NotRegexp(t, "(?m)^a=setup:actpass", answer.SDP)
+
+		require.NoError(t, answerPC.SetLocalDescription(answer))
+		require.NoError(t, offerPC.SetRemoteDescription(answer))
+		<-connected
+
+		assert.Equal(t, role, dtlsRole(answerPC))
+		assert.NotEqual(t, role, dtlsRole(offerPC))
+
+		assert.NoError(t, offerPC.Close())
+		assert.NoError(t, answerPC.Close())
+	}
+
+	t.Run("Active", func(t *testing.T) {
+		runTest(t, DTLSRoleClient, "active")
+	})
+
+	t.Run("Passive", func(t *testing.T) {
+		runTest(t, DTLSRoleServer, "passive")
+	})
+
+	t.Run("ConflictingRemote", func(t *testing.T) {
+		offerPC, answerPC, err := newPair()
+		require.NoError(t, err)
+
+		offer := createOffer(offerPC)
+		offer.SDP = strings.Replace(offer.SDP, "a=setup:actpass", "a=setup:active", -1)
+		require.NoError(t, answerPC.SetRemoteDescription(offer))
+
+		_, err = answerPC.CreateAnswer(&AnswerOptions{DTLSRole: DTLSRoleClient})
+		assert.Error(t, err)
+
+		answer, err := answerPC.CreateAnswer(&AnswerOptions{DTLSRole: DTLSRoleServer})
+		require.NoError(t, err)
+		assert.Contains(t, answer.SDP, "a=setup:passive")
+
+		assert.NoError(t, offerPC.Close())
+		assert.NoError(t, answerPC.Close())
+	})
+}
+
+func TestDTLSTransport_GetRemoteCertificate(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	runTest := func(t *testing.T, s SettingEngine) {
+		api := NewAPI(WithSettingEngine(s))
+		offerPC, answerPC, err := api.newPair(Configuration{})
+		require.NoError(t, err)
+		assert.Nil(t, offerPC.dtlsTransport.GetRemoteCertificate())
+
+		connected := make(chan struct{})
+		answerPC.OnConnectionStateChange(func(connectionState PeerConnectionState) {
+			if connectionState == PeerConnectionStateConnected {
+				close(connected)
+			}
+		})
+		require.NoError(t, signalPair(offerPC, answerPC))
+		<-connected
+
+		assert.Equal(t, offerPC.configuration.Certificates[0].x509Cert.Raw, answerPC.dtlsTransport.GetRemoteCertificate())
+		assert.Eventually(t, func() bool {
+			return bytes.Equal(answerPC.configuration.Certificates[0].x509Cert.Raw, offerPC.dtlsTransport.GetRemoteCertificate())
+		}, 5*time.Second, 10*time.Millisecond)
+
+		assert.NoError(t, offerPC.Close())
+		assert.NoError(t, answerPC.Close())
+	}
+
+	t.Run("Verified", func(t *testing.T) {
+		runTest(t, SettingEngine{})
+	})
+
+	t.Run("NotVerified", func(t *testing.T) {
+		s := SettingEngine{}
+		s.DisableCertificateFingerprintVerification(true)
+		runTest(t, s)
+	})
+}
+
+func TestPeerConnection_RemoteFingerprintPin(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	runTest := func(t *testing.T, pinMatches bool) {
+		generateCertificate := func() *Certificate {
+			sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			assert.NoError(t, err)
+			cert, err := GenerateCertificate(sk)
+			assert.NoError(t, err)
+			return cert
+		}
+		offerCert, otherCert := generateCertificate(), generateCertificate()
+
+		pinnedCert := otherCert
+		if pinMatches {
+			pinnedCert = offerCert
+		}
+		pins, err := pinnedCert.GetFingerprints()
+		assert.NoError(t, err)
+
+		s := SettingEngine{}
+		s.SetRemoteFingerprintPin(pins...)
+
+		offerPC, err := NewPeerConnection(Configuration{Certificates: []Certificate{*offerCert}})
+		assert.NoError(t, err)
+
+		answerPC, err := NewAPI(WithSettingEngine(s)).NewPeerConnection(Configuration{})
+		assert.NoError(t, err)
+
+		_, err = answerPC.RemoteFingerprints()
+		assert.Error(t, err)
+
+		connectionState := make(chan PeerConnectionState, 1)
+		answerPC.OnConnectionStateChange(func(state PeerConnectionState) {
+			if state == PeerConnectionStateConnected || state == PeerConnectionStateFailed {
+				select {
+				case connectionState <- state:
+				default:
+				}
+			}
+		})
+
+		assert.NoError(t, signalPair(offerPC, answerPC))
+
+		// The fingerprint of the offer is exposed, and the pin decides if it is accepted
+		offerFingerprints, err := offerCert.GetFingerprints()
+		assert.NoError(t, err)
+		remoteFingerprints, err := answerPC.RemoteFingerprints()
+		assert.NoError(t, err)
+		assert.Equal(t, offerFingerprints, remoteFingerprints)
+
+		if pinMatches {
+			assert.Equal(t, PeerConnectionStateConnected, <-connectionState)
+		} else {
+			assert.Equal(t, PeerConnectionStateFailed, <-connectionState)
+		}
+
+		assert.NoError(t, offerPC.Close())
+		assert.NoError(t, answerPC.Close())
+	}
+
+	t.Run("Match", func(t *testing.T) {
+		runTest(t, true)
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		runTest(t, false)
+	})
+}
+
+func TestDTLSTransport_ExportKeyingMaterial(t *testing.T) {
+	lim := test.TimeOut(time.Second * 20)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	const (
+		labelExtractorDtlsSrtp = "EXTRACTOR-dtls_srtp"
+		keyLen                 = 16
+		saltLen                = 14
+	)
+
+	pc, err := NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+	_, err = pc.dtlsTransport.ExportKeyingMaterial(labelExtractorDtlsSrtp, nil, 2*(keyLen+saltLen))
+	assert.Error(t, err)
+	assert.NoError(t, pc.Close())
+
+	pcOffer, pcAnswer, local, _ := connectTrackPair(t)
+
+	material, err := pcAnswer.dtlsTransport.ExportKeyingMaterial(labelExtractorDtlsSrtp, nil, 2*(keyLen+saltLen))
+	require.NoError(t, err)
+	offerMaterial, err := pcOffer.dtlsTransport.ExportKeyingMaterial(labelExtractorDtlsSrtp, nil, 2*(keyLen+saltLen))
+	require.NoError(t, err)
+	assert.Equal(t, material, offerMaterial)
+
+	// The master key and salt the answerer writes with, laid out as
+	// client key, server key, client salt, server salt
+	pcAnswer.dtlsTransport.lock.RLock()
+	role, srtcpEndpoint := pcAnswer.dtlsTransport.role(), pcAnswer.dtlsTransport.srtcpEndpoint
+	pcAnswer.dtlsTransport.lock.RUnlock()
+
+	key, salt := material[keyLen:2*keyLen], material[2*keyLen+saltLen:]
+	if role == DTLSRoleClient {
+		key, salt = material[:keyLen], material[2*keyLen:2*keyLen+saltLen]
+	}
+
+	// RTCP protected outside of the answerer's SRTCP session is accepted by the offerer
+	srtpContext, err := srtp.CreateContext(key, salt, srtp.ProtectionProfileAes128CmHmacSha1_80)
+	require.NoError(t, err)
+	raw, err := (&rtcp.PictureLossIndication{SenderSSRC: 0x5EED, MediaSSRC: local.SSRC()}).Marshal()
+	require.NoError(t, err)
+	encrypted, err := srtpContext.EncryptRTCP(nil, raw, nil)
+	require.NoError(t, err)
+	_, err = srtcpEndpoint.Write(encrypted)
+	require.NoError(t, err)
+
+	for received := false; !received; {
+		pkts, err := pcOffer.GetSenders()[0].ReadRTCP()
+		require.NoError(t, err)
+		for _, p := range pkts {
+			if pli, ok := p.(*rtcp.PictureLossIndication); ok && pli.SenderSSRC == 0x5EED {
+				received = true
+			}
+		}
+	}
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
@@ -30,6 +30,14 @@ var (
 	// ErrExistingTrack indicates that a track already exists.
 	ErrExistingTrack = errors.New("track already exists")
 
+	// ErrSSRCInUse indicates that the SSRC of a new local track is already
+	// used by a track the PeerConnection sends.
+	ErrSSRCInUse = errors.New("SSRC is already used by a local track")
+
+	// ErrRemoteTrack indicates that a remote track was used where a local
+	// track is needed, e.g. to send it.
+	ErrRemoteTrack = errors.New("track is a remote track")
+
 	// ErrPrivateKeyType indicates that a particular private key encryption
 	// chosen to generate a certificate is not supported.
 	ErrPrivateKeyType = errors.New("private key type not supported")
@@ -62,6 +70,14 @@ var (
 	// specified for a data channel has been exceeded.
 	ErrMaxDataChannelID = errors.New("maximum number ID for datachannel specified")
 
+	// ErrMaxDataChannels indicates that a data channel can't be created because
+	// as many as SCTPTransport.MaxChannels are already open.
+	ErrMaxDataChannels = errors.New("maximum number of datachannels reached")
+
+	// ErrDataChannelMessageTooLarge indicates that a message larger than
+	// SCTPTransport.MaxMessageSize was passed to DataChannel.Send or SendText.
+	ErrDataChannelMessageTooLarge = errors.New("message is larger than the maximum message size")
+
 	// ErrNegotiatedWithoutID indicates that an attempt to create a data channel
 	// was made while setting the negotiated option to true without providing
 	// the negotiated channel ID.
@@ -76,6 +92,18 @@ var (
 	// ErrCodecNotFound is returned when a codec search to the Media Engine fails
 	ErrCodecNotFound = errors.New("codec not found")
 
+	// ErrUnregisteredPayloadType indicates that a Track was created with a
+	// PayloadType that isn't registered in the MediaEngine
+	ErrUnregisteredPayloadType = errors.New("payload type is not registered in the MediaEngine")
+
+	// ErrNoActiveSender indicates that no RTPSender of a Track started sending
+	// before the write deadline of the Track
+	ErrNoActiveSender = errors.New("no active RTPSender before the write deadline")
+
+	// ErrReceiverNotStarted indicates that RTCP feedback can't be sent by a
+	// RTPReceiver before Receive was called
+	ErrReceiverNotStarted = errors.New("RTPReceiver has not been started")
+
 	// ErrNoRemoteDescription indicates that an operation was rejected because
 	// the remote description is not set
 	ErrNoRemoteDescription = errors.New("remote description is not set")
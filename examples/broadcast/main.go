@@ -5,7 +5,6 @@ import (
 	"io"
 	"time"
 
-	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v2"
 
 	"github.com/pion/webrtc/v2/examples/internal/signal"
@@ -56,16 +55,10 @@ func main() {
 	// Set a handler for when a new remote track starts, this just distributes all our packets
 	// to connected peers
 	peerConnection.OnTrack(func(remoteTrack *webrtc.Track, receiver *webrtc.RTPReceiver) {
-		// Send a PLI on an interval so that the publisher is pushing a keyframe every rtcpPLIInterval
+		// Send a PLI when no keyframe arrived within rtcpPLIInterval so that the publisher is pushing
+		// a keyframe at least every rtcpPLIInterval
 		// This can be less wasteful by processing incoming RTCP events, then we would emit a NACK/PLI when a viewer requests it
-		go func() {
-			ticker := time.NewTicker(rtcpPLIInterval)
-			for range ticker.C {
-				if rtcpSendErr := peerConnection.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: remoteTrack.SSRC()}}); rtcpSendErr != nil {
-					fmt.Println(rtcpSendErr)
-				}
-			}
-		}()
+		receiver.SetKeyframeRequestTimeout(rtcpPLIInterval)
 
 		// Create a local track, all our SFU clients will be fed via this track
 		localTrack, newTrackErr := peerConnection.NewTrack(remoteTrack.PayloadType(), remoteTrack.SSRC(), "video", "pion")
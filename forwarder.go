@@ -0,0 +1,412 @@
+// +build !js
+
+package webrtc
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// Forwarder forwards the RTP of a remote Track to any number of RTPSenders, as
+// done by a Selective Forwarding Unit. Every packet is rewritten to the SSRC and
+// PayloadType of the Track of each RTPSender. The source can be switched, e.g.
+// between simulcast layers, while the sequence numbers and timestamps that are
+// sent stay continuous. Picture Loss Indications the RTPSenders receive are
+// forwarded to the source.
+//
+// Payloads and header extensions are forwarded unchanged, so end-to-end
+// encrypted media passes through opaquely. When frame marking has been
+// negotiated with MediaEngine.RegisterFrameMarking it is used to find the
+// keyframes instead of the payload. Header extension IDs are not rewritten, so
+// the subscribers must negotiate the same IDs as the source.
+//
+// The source is only read while there are subscribers. When the last one
+// unsubscribes, or its RTPSender is stopped (e.g. by RemoveTrack), reading and
+// requesting keyframes pause. The first new subscriber resumes forwarding from
+// the next keyframe, packets the source received in between are dropped.
+//
+// The Forwarder reads the source Track and the RTCP of the subscribed RTPSenders,
+// so they must not be read elsewhere. The packets are written to the Tracks of the
+// subscribed RTPSenders with WriteRTP, so they count in Track.Stats and Sender
+// Reports, and a write deadline set on such a Track holds up forwarding until one
+// of its RTPSenders is sending. The sequence numbers and timestamps sent continue
+// those of the first source, so nothing else should be written to these Tracks.
+type Forwarder struct {
+	mu sync.Mutex
+	wg sync.WaitGroup
+
+	source      *Track
+	subscribers []*RTPSender
+	rtcpReaders map[*RTPSender]bool
+	forwarding  bool
+	closed      bool
+
+	// State used to rewrite the packets of the source. switched is set until
+	// the first packet of a new source is forwarded
+	switched             bool
+	started              bool
+	sequenceNumberOffset uint16
+	timestampOffset      uint32
+	lastSequenceNumber   uint16
+	lastTimestamp        uint32
+	lastTime             time.Time
+}
+
+// NewForwarder creates a Forwarder that forwards the given remote Track
+func NewForwarder(source *Track) (*Forwarder, error) {
+	if err := checkForwarderSource(source); err != nil {
+		return nil, err
+	}
+
+	return &Forwarder{
+		source:      source,
+		rtcpReaders: map[*RTPSender]bool{},
+	}, nil
+}
+
+func checkForwarderSource(source *Track) error {
+	if source == nil {
+		return fmt.Errorf("Forwarder source must not be nil")
+	}
+
+	source.mu.RLock()
+	defer source.mu.RUnlock()
+	if source.receiver == nil {
+		return fmt.Errorf("Forwarder source must be a remote track")
+	}
+	return nil
+}
+
+// Source returns the Track that is currently forwarded
+func (f *Forwarder) Source() *Track {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.source
+}
+
+// SetSource switches the forwarded Track, e.g. to another simulcast layer. A
+// keyframe is requested from the new source if there are subscribers. For VP8, VP9 and H264 video, or
+// video with frame marking, nothing is forwarded from the new source until a
+// keyframe arrives, so subscribers can decode it right away.
+func (f *Forwarder) SetSource(source *Track) error {
+	if err := checkForwarderSource(source); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return fmt.Errorf("Forwarder has been closed")
+	} else if source == f.source {
+		f.mu.Unlock()
+		return nil
+	}
+
+	// Interrupt reading the current source, forward picks up the new one
+	if f.forwarding {
+		if err := f.source.SetReadDeadline(time.Now()); err != nil {
+			f.mu.Unlock()
+			return err
+		}
+	}
+	f.source = source
+	f.switched = true
+	subscribed := len(f.subscribers) != 0
+	f.startForwarding()
+	f.mu.Unlock()
+
+	if subscribed {
+		source.receiver.requestKeyframe(source)
+	}
+	return nil
+}
+
+// Subscribe starts forwarding to the given RTPSender. A keyframe is requested
+// from the source, so the new subscriber can start decoding.
+func (f *Forwarder) Subscribe(sender *RTPSender) error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return fmt.Errorf("Forwarder has been closed")
+	}
+
+	for _, s := range f.subscribers {
+		if s == sender {
+			f.mu.Unlock()
+			return fmt.Errorf("RTPSender is already subscribed")
+		}
+	}
+	f.subscribers = append(f.subscribers, sender)
+	f.startForwarding()
+
+	if !f.rtcpReaders[sender] {
+		f.rtcpReaders[sender] = true
+		go f.readRTCP(sender)
+	}
+	source := f.source
+	f.mu.Unlock()
+
+	source.receiver.requestKeyframe(source)
+	return nil
+}
+
+// Unsubscribe stops forwarding to the given RTPSender
+func (f *Forwarder) Unsubscribe(sender *RTPSender) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.removeSubscriber(sender) {
+		return fmt.Errorf("RTPSender is not subscribed")
+	}
+	return nil
+}
+
+// startForwarding starts reading the source if there are subscribers. f.mu must be held
+func (f *Forwarder) startForwarding() {
+	if f.forwarding || f.closed || len(f.subscribers) == 0 {
+		return
+	}
+
+	// Drop what the source received while paused and wait for a keyframe, the
+	// subscribers missed everything since
+	discardBuffered(f.source)
+	f.forwarding = true
+	f.switched = true
+	f.wg.Add(1)
+	go f.forward()
+}
+
+// removeSubscriber returns false if the RTPSender isn't subscribed. Reading the
+// source is interrupted once there are no subscribers left. f.mu must be held
+func (f *Forwarder) removeSubscriber(sender *RTPSender) bool {
+	for i, s := range f.subscribers {
+		if s == sender {
+			f.subscribers = append(f.subscribers[:i], f.subscribers[i+1:]...)
+			if len(f.subscribers) == 0 && f.forwarding {
+				_ = f.source.SetReadDeadline(time.Now())
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Close stops forwarding. It doesn't close the source or the RTPSenders
+func (f *Forwarder) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	f.subscribers = nil
+
+	source, forwarding := f.source, f.forwarding
+	f.mu.Unlock()
+
+	if !forwarding {
+		return nil
+	}
+
+	// Interrupt reading the source and allow it to be read again afterwards
+	if err := source.SetReadDeadline(time.Now()); err != nil {
+		return err
+	}
+	f.wg.Wait()
+	return source.SetReadDeadline(time.Time{})
+}
+
+// forward reads the current source until it ends, the Forwarder is closed or
+// there are no subscribers left
+func (f *Forwarder) forward() {
+	defer f.wg.Done()
+
+	var last *Track
+	p := &rtp.Packet{}
+	for {
+		f.mu.Lock()
+		if f.closed || len(f.subscribers) == 0 {
+			// Leave the source readable when pausing
+			if last != nil && !f.closed {
+				_ = last.SetReadDeadline(time.Time{})
+			}
+			f.forwarding = false
+			f.mu.Unlock()
+			return
+		}
+
+		source := f.source
+		if source != last {
+			// Clear the deadlines that interrupted reads when switching
+			if last != nil {
+				_ = last.SetReadDeadline(time.Time{})
+			}
+			if err := source.SetReadDeadline(time.Time{}); err != nil {
+				f.forwarding = false
+				f.mu.Unlock()
+				return
+			}
+			last = source
+		}
+		f.mu.Unlock()
+
+		if err := source.ReadRTPInto(p); err != nil {
+			if !f.handleReadError(source, err) {
+				return
+			}
+			continue
+		}
+
+		f.writeRTP(source, p)
+	}
+}
+
+// discardBuffered reads the packets the given source has already received.
+// Reads fail right away once the deadline passed, even if packets are buffered,
+// so it's set to shortly after now.
+func discardBuffered(source *Track) {
+	if err := source.SetReadDeadline(time.Now().Add(time.Millisecond)); err != nil {
+		return
+	}
+	b := make([]byte, receiveMTU)
+	for {
+		if _, err := source.Read(b); err != nil {
+			break
+		}
+	}
+	_ = source.SetReadDeadline(time.Time{})
+}
+
+// handleReadError returns true if forward should continue after failing to read the given source
+func (f *Forwarder) handleReadError(source *Track, err error) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case f.closed:
+	case f.source != source:
+		return true
+	default:
+		// The source was switched back before the interrupted read returned
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return source.SetReadDeadline(time.Time{}) == nil
+		}
+	}
+
+	f.forwarding = false
+	return false
+}
+
+// writeRTP rewrites a packet read from the given source and sends it to all subscribers
+func (f *Forwarder) writeRTP(source *Track, p *rtp.Packet) {
+	f.mu.Lock()
+	if source != f.source {
+		f.mu.Unlock()
+		return
+	}
+
+	if f.switched {
+		codec := source.Codec()
+		if !isForwarderSwitchPoint(source, codec, p) {
+			f.mu.Unlock()
+			return
+		}
+		f.switched = false
+
+		// Continue where the previous source stopped, advancing the timestamp by the time since its last packet
+		if f.started {
+			elapsed := uint32(1)
+			if codec != nil {
+				if e := uint32(time.Since(f.lastTime).Seconds() * float64(codec.ClockRate)); e > elapsed {
+					elapsed = e
+				}
+			}
+			f.sequenceNumberOffset = f.lastSequenceNumber + 1 - p.SequenceNumber
+			f.timestampOffset = f.lastTimestamp + elapsed - p.Timestamp
+		}
+	}
+
+	header := p.Header
+	header.SequenceNumber += f.sequenceNumberOffset
+	header.Timestamp += f.timestampOffset
+
+	f.started = true
+	f.lastSequenceNumber = header.SequenceNumber
+	f.lastTimestamp = header.Timestamp
+	f.lastTime = time.Now()
+
+	// A Track is written once, even if several of its RTPSenders are subscribed
+	tracks := []*Track{}
+	written := map[*Track]bool{}
+	for _, s := range f.subscribers {
+		if track := s.Track(); !written[track] {
+			written[track] = true
+			tracks = append(tracks, track)
+		}
+	}
+	f.mu.Unlock()
+
+	for _, track := range tracks {
+		// A Track whose RTPSenders have all been stopped fails, which doesn't affect the others
+		packet := &rtp.Packet{Header: header, Payload: p.Payload}
+		packet.SSRC = track.SSRC()
+		packet.PayloadType = track.PayloadType()
+		_ = track.WriteRTP(packet)
+	}
+}
+
+// isForwarderSwitchPoint returns true if forwarding a source can start at the
+// given packet. The frame marking header extension is preferred to parsing the
+// payload, which may be end-to-end encrypted.
+func isForwarderSwitchPoint(source *Track, codec *RTPCodec, p *rtp.Packet) bool {
+	source.mu.RLock()
+	frameMarkingID := source.frameMarkingID
+	source.mu.RUnlock()
+
+	if frameMarking, ok := oneByteHeaderExtension(&p.Header, frameMarkingID); ok {
+		return isFrameMarkingIndependent(frameMarking)
+	}
+	return codec == nil || codec.Type != RTPCodecTypeVideo || !canDetectKeyframe(codec.Name) || isKeyframe(codec.Name, p.Payload)
+}
+
+// readRTCP forwards the Picture Loss Indications of a subscriber to the source
+func (f *Forwarder) readRTCP(sender *RTPSender) {
+	for {
+		pkts, err := sender.ReadRTCP()
+		if err != nil {
+			// The RTPSender has been stopped
+			f.mu.Lock()
+			delete(f.rtcpReaders, sender)
+			f.removeSubscriber(sender)
+			f.mu.Unlock()
+			return
+		}
+
+		for _, p := range pkts {
+			if pli, ok := p.(*rtcp.PictureLossIndication); ok && pli.MediaSSRC == sender.Track().SSRC() {
+				f.requestKeyframe(sender)
+				break
+			}
+		}
+	}
+}
+
+// requestKeyframe asks the source for a keyframe on behalf of a subscriber
+func (f *Forwarder) requestKeyframe(sender *RTPSender) {
+	f.mu.Lock()
+	source := f.source
+	subscribed := false
+	for _, s := range f.subscribers {
+		subscribed = subscribed || s == sender
+	}
+	f.mu.Unlock()
+
+	if subscribed {
+		source.receiver.requestKeyframe(source)
+	}
+}
@@ -0,0 +1,373 @@
+// +build !js
+
+package webrtc
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/transport/test"
+	"github.com/pion/webrtc/v2/pkg/media"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// drainTrack reads all packets of a remote Track that have been received so far
+func drainTrack(t *testing.T, track *Track) {
+	require.NoError(t, track.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	for {
+		if _, err := track.ReadRTP(); err != nil {
+			netErr, ok := err.(net.Error)
+			require.True(t, ok)
+			require.True(t, netErr.Timeout())
+			break
+		}
+	}
+	require.NoError(t, track.SetReadDeadline(time.Time{}))
+}
+
+// readMarked reads from a remote Track until a packet with the given last payload byte arrives
+func readMarked(t *testing.T, track *Track, marker byte) *rtp.Packet {
+	for {
+		p, err := track.ReadRTP()
+		require.NoError(t, err)
+		if p.Payload[len(p.Payload)-1] == marker {
+			return p
+		}
+	}
+}
+
+// readPLIs sends the keyframe requests the given publisher receives to the returned channel
+func readPLIs(publisher *PeerConnection) chan *rtcp.PictureLossIndication {
+	plis := make(chan *rtcp.PictureLossIndication, 10)
+	go func() {
+		for {
+			pkts, err := publisher.GetSenders()[0].ReadRTCP()
+			if err != nil {
+				return
+			}
+			for _, p := range pkts {
+				if pli, ok := p.(*rtcp.PictureLossIndication); ok {
+					plis <- pli
+				}
+			}
+		}
+	}()
+	return plis
+}
+
+func TestForwarder(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	// Two publishers send the layers, the SFU forwards one of them to a viewer
+	publisherA, sfuA, layerLocalA, layerA := connectTrackPair(t)
+	publisherB, sfuB, layerLocalB, layerB := connectTrackPair(t)
+	drainTrack(t, layerA)
+	drainTrack(t, layerB)
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	sfuDown, viewer, err := api.newPair(Configuration{})
+	require.NoError(t, err)
+	_, err = viewer.AddTransceiverFromKind(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	require.NoError(t, err)
+	down, err := sfuDown.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "sfu")
+	require.NoError(t, err)
+	sender, err := sfuDown.AddTrack(down)
+	require.NoError(t, err)
+
+	viewerTracks := make(chan *Track, 1)
+	viewer.OnTrack(func(track *Track, r *RTPReceiver) {
+		viewerTracks <- track
+	})
+	require.NoError(t, signalPair(sfuDown, viewer))
+
+	plis := readPLIs(publisherB)
+
+	_, err = NewForwarder(down)
+	assert.Error(t, err)
+
+	f, err := NewForwarder(layerA)
+	require.NoError(t, err)
+	require.NoError(t, f.Subscribe(sender))
+	assert.Error(t, f.Subscribe(sender))
+
+	// The viewer only receives forwarded packets, the lowest bit of the VP8
+	// payload header is clear for keyframes
+	var viewerTrack *Track
+	for viewerTrack == nil {
+		select {
+		case viewerTrack = <-viewerTracks:
+		case <-time.After(20 * time.Millisecond):
+			assert.NoError(t, layerLocalA.WriteSample(media.Sample{Data: []byte{0xA0}, Samples: 1}))
+		}
+	}
+
+	// Packets are rewritten to the SSRC and PayloadType of the subscriber
+	assert.NoError(t, layerLocalA.WriteSample(media.Sample{Data: []byte{0xA1}, Samples: 1}))
+	p := readMarked(t, viewerTrack, 0xA1)
+	assert.Equal(t, down.SSRC(), p.SSRC)
+	assert.Equal(t, down.PayloadType(), p.PayloadType)
+	sequenceNumber, timestamp := p.SequenceNumber, p.Timestamp
+
+	// The packets are written to the Track of the subscriber
+	assert.Equal(t, sequenceNumber, down.Stats().LastSequenceNumber)
+
+	// Switching layers skips to the first keyframe and keeps the numbering continuous
+	require.NoError(t, f.SetSource(layerB))
+	assert.Equal(t, layerB, f.Source())
+	assert.NoError(t, layerLocalB.WriteSample(media.Sample{Data: []byte{0xB1}, Samples: 1}))
+	assert.NoError(t, layerLocalB.WriteSample(media.Sample{Data: []byte{0xB0}, Samples: 1}))
+	assert.NoError(t, layerLocalA.WriteSample(media.Sample{Data: []byte{0xA2}, Samples: 1}))
+	assert.NoError(t, layerLocalB.WriteSample(media.Sample{Data: []byte{0xB3}, Samples: 1}))
+
+	for i, marker := range []byte{0xB0, 0xB3} {
+		p, err = viewerTrack.ReadRTP()
+		require.NoError(t, err)
+		assert.Equal(t, marker, p.Payload[len(p.Payload)-1])
+		assert.Equal(t, down.SSRC(), p.SSRC)
+		assert.Equal(t, sequenceNumber+1+uint16(i), p.SequenceNumber)
+		assert.True(t, p.Timestamp-timestamp > 0 && p.Timestamp-timestamp < 1<<31)
+	}
+
+	// A keyframe request of the viewer is forwarded to the current layer
+	assert.Eventually(t, func() bool {
+		return len(plis) != 0
+	}, 5*time.Second, 10*time.Millisecond)
+	for len(plis) != 0 {
+		<-plis
+	}
+	assert.NoError(t, viewer.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: viewerTrack.SSRC()}}))
+	select {
+	case pli := <-plis:
+		assert.Equal(t, layerLocalB.SSRC(), pli.MediaSSRC)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "keyframe request wasn't forwarded")
+	}
+
+	// Nothing is forwarded after unsubscribing, and again after subscribing
+	require.NoError(t, f.Unsubscribe(sender))
+	assert.Error(t, f.Unsubscribe(sender))
+	assert.NoError(t, layerLocalB.WriteSample(media.Sample{Data: []byte{0xB4}, Samples: 1}))
+	time.Sleep(100 * time.Millisecond)
+
+	require.NoError(t, f.Subscribe(sender))
+	assert.NoError(t, layerLocalB.WriteSample(media.Sample{Data: []byte{0xB6}, Samples: 1}))
+	p, err = viewerTrack.ReadRTP()
+	require.NoError(t, err)
+	assert.Equal(t, byte(0xB6), p.Payload[len(p.Payload)-1])
+
+	// The source can be read again once the Forwarder is closed
+	assert.NoError(t, f.Close())
+	assert.Error(t, f.SetSource(layerA))
+	assert.NoError(t, layerLocalB.WriteSample(media.Sample{Data: []byte{0xB8}, Samples: 1}))
+	readMarked(t, layerB, 0xB8)
+
+	for _, pc := range []*PeerConnection{publisherA, sfuA, publisherB, sfuB, sfuDown, viewer} {
+		assert.NoError(t, pc.Close())
+	}
+}
+
+func TestForwarder_FrameMarking(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	api, apiB := NewAPI(), NewAPI()
+	api.mediaEngine.RegisterFrameMarking()
+	apiB.mediaEngine.RegisterFrameMarking()
+	publisherA, sfuA, layerLocalA, layerA := connectTrackPairWithAPI(t, api)
+	publisherB, sfuB, layerLocalB, layerB := connectTrackPairWithAPI(t, apiB)
+	drainTrack(t, layerA)
+	drainTrack(t, layerB)
+
+	extMap := fmt.Sprintf("a=extmap:%d %s", frameMarkingExtensionID, FrameMarkingURI)
+	assert.Contains(t, publisherA.LocalDescription().SDP, extMap)
+	assert.Contains(t, sfuA.LocalDescription().SDP, extMap)
+
+	sfuDown, viewer, err := api.newPair(Configuration{})
+	require.NoError(t, err)
+	_, err = viewer.AddTransceiverFromKind(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	require.NoError(t, err)
+	down, err := sfuDown.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "sfu")
+	require.NoError(t, err)
+	sender, err := sfuDown.AddTrack(down)
+	require.NoError(t, err)
+
+	viewerTracks := make(chan *Track, 1)
+	viewer.OnTrack(func(track *Track, r *RTPReceiver) {
+		viewerTracks <- track
+	})
+	require.NoError(t, signalPair(sfuDown, viewer))
+
+	f, err := NewForwarder(layerA)
+	require.NoError(t, err)
+	require.NoError(t, f.Subscribe(sender))
+
+	// The end-to-end encrypted payloads don't parse as VP8 keyframes, only the
+	// frame marking tells where the subscribers can start decoding
+	writeEncrypted := func(local *Track, marker byte, independent bool) {
+		frameMarking := byte(0xC0)
+		if independent {
+			frameMarking |= 0x20
+		}
+
+		p := local.Packetizer().Packetize([]byte{marker}, 1)[0]
+		p.Payload = []byte{0xE5, 0x9A, marker}
+		p.Extension = true
+		p.ExtensionProfile = 0xBEDE
+		p.ExtensionPayload = []byte{frameMarkingExtensionID << 4, frameMarking, 0x00, 0x00}
+		assert.NoError(t, local.WriteRTP(p))
+	}
+
+	var viewerTrack *Track
+	for viewerTrack == nil {
+		select {
+		case viewerTrack = <-viewerTracks:
+		case <-time.After(20 * time.Millisecond):
+			writeEncrypted(layerLocalA, 0xA0, true)
+		}
+	}
+
+	drainTrack(t, viewerTrack)
+
+	// Switching skips to the first independent frame, after which the payload
+	// and header extension of every packet pass through unchanged
+	require.NoError(t, f.SetSource(layerB))
+	writeEncrypted(layerLocalB, 0xB0, false)
+	writeEncrypted(layerLocalB, 0xB1, true)
+	writeEncrypted(layerLocalB, 0xB2, false)
+
+	for _, marker := range []byte{0xB1, 0xB2} {
+		p, err := viewerTrack.ReadRTP()
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0xE5, 0x9A, marker}, p.Payload)
+		assert.True(t, p.Extension)
+		assert.Equal(t, uint16(0xBEDE), p.ExtensionProfile)
+		assert.Equal(t, down.SSRC(), p.SSRC)
+		if marker == 0xB1 {
+			assert.Equal(t, []byte{frameMarkingExtensionID << 4, 0xE0, 0x00, 0x00}, p.ExtensionPayload)
+		} else {
+			assert.Equal(t, []byte{frameMarkingExtensionID << 4, 0xC0, 0x00, 0x00}, p.ExtensionPayload)
+		}
+	}
+
+	assert.NoError(t, f.Close())
+	for _, pc := range []*PeerConnection{publisherA, sfuA, publisherB, sfuB, sfuDown, viewer} {
+		assert.NoError(t, pc.Close())
+	}
+}
+
+func TestForwarder_Pause(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	publisherA, sfuA, layerLocalA, layerA := connectTrackPair(t)
+	publisherB, sfuB, layerLocalB, layerB := connectTrackPair(t)
+	drainTrack(t, layerA)
+	drainTrack(t, layerB)
+	plisA, plisB := readPLIs(publisherA), readPLIs(publisherB)
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	sfuDown, viewer, err := api.newPair(Configuration{})
+	require.NoError(t, err)
+	_, err = viewer.AddTransceiverFromKind(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	require.NoError(t, err)
+	down, err := sfuDown.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "sfu")
+	require.NoError(t, err)
+	sender, err := sfuDown.AddTrack(down)
+	require.NoError(t, err)
+
+	viewerTracks := make(chan *Track, 1)
+	viewer.OnTrack(func(track *Track, r *RTPReceiver) {
+		viewerTracks <- track
+	})
+	require.NoError(t, signalPair(sfuDown, viewer))
+
+	// Without subscribers the source isn't read
+	f, err := NewForwarder(layerA)
+	require.NoError(t, err)
+	assert.NoError(t, layerLocalA.WriteSample(media.Sample{Data: []byte{0xA1}, Samples: 1}))
+	readMarked(t, layerA, 0xA1)
+
+	// The first subscriber starts forwarding with a keyframe request
+	require.NoError(t, f.Subscribe(sender))
+	select {
+	case pli := <-plisA:
+		assert.Equal(t, layerLocalA.SSRC(), pli.MediaSSRC)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "keyframe wasn't requested")
+	}
+
+	var viewerTrack *Track
+	for viewerTrack == nil {
+		select {
+		case viewerTrack = <-viewerTracks:
+		case <-time.After(20 * time.Millisecond):
+			assert.NoError(t, layerLocalA.WriteSample(media.Sample{Data: []byte{0xA0}, Samples: 1}))
+		}
+	}
+
+	// Without subscribers reading pauses and no keyframes are requested
+	require.NoError(t, f.Unsubscribe(sender))
+	drainTrack(t, viewerTrack)
+	require.NoError(t, f.SetSource(layerB))
+	assert.NoError(t, layerLocalB.WriteSample(media.Sample{Data: []byte{0xB0}, Samples: 1}))
+	time.Sleep(200 * time.Millisecond)
+	assert.Len(t, plisB, 0)
+
+	// Subscribing again resumes with a keyframe request, what was received
+	// while paused is dropped
+	require.NoError(t, f.Subscribe(sender))
+	select {
+	case pli := <-plisB:
+		assert.Equal(t, layerLocalB.SSRC(), pli.MediaSSRC)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "keyframe wasn't requested")
+	}
+	assert.NoError(t, layerLocalB.WriteSample(media.Sample{Data: []byte{0xB2}, Samples: 1}))
+	p, err := viewerTrack.ReadRTP()
+	require.NoError(t, err)
+	assert.Equal(t, byte(0xB2), p.Payload[len(p.Payload)-1])
+	assert.Equal(t, down.SSRC(), p.SSRC)
+
+	// An RTPSender that is removed is unsubscribed
+	require.NoError(t, sfuDown.RemoveTrack(sender))
+	assert.Eventually(t, func() bool {
+		return f.Unsubscribe(sender) != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Even if it never started sending
+	unconnected, err := api.NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+	unsent, err := unconnected.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "unsent")
+	require.NoError(t, err)
+	unsentSender, err := unconnected.AddTrack(unsent)
+	require.NoError(t, err)
+	require.NoError(t, f.Subscribe(unsentSender))
+	require.NoError(t, unconnected.RemoveTrack(unsentSender))
+	assert.Eventually(t, func() bool {
+		return f.Unsubscribe(unsentSender) != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, unconnected.Close())
+
+	assert.NoError(t, f.Close())
+	for _, pc := range []*PeerConnection{publisherA, sfuA, publisherB, sfuB, sfuDown, viewer} {
+		assert.NoError(t, pc.Close())
+	}
+}
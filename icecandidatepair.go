@@ -1,6 +1,9 @@
 package webrtc
 
-import "fmt"
+import (
+	"fmt"
+	"net"
+)
 
 // ICECandidatePair represents an ICE Candidate pair
 type ICECandidatePair struct {
@@ -27,3 +30,27 @@ func NewICECandidatePair(local, remote *ICECandidate) *ICECandidatePair {
 		Remote:  remote,
 	}
 }
+
+// NetworkType returns the network type of the pair, which tells if it connects
+// over IPv4 or IPv6. Candidates whose address is a mDNS hostname are skipped.
+func (p *ICECandidatePair) NetworkType() (NetworkType, error) {
+	for _, c := range []*ICECandidate{p.Local, p.Remote} {
+		ip := net.ParseIP(c.Address)
+		if ip == nil {
+			continue
+		}
+
+		isIPv4 := ip.To4() != nil
+		switch {
+		case c.Protocol == ICEProtocolTCP && isIPv4:
+			return NetworkTypeTCP4, nil
+		case c.Protocol == ICEProtocolTCP:
+			return NetworkTypeTCP6, nil
+		case isIPv4:
+			return NetworkTypeUDP4, nil
+		default:
+			return NetworkTypeUDP6, nil
+		}
+	}
+	return NetworkType(Unknown), fmt.Errorf("unable to determine the network type of %s", p)
+}
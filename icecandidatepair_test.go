@@ -0,0 +1,35 @@
+package webrtc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestICECandidatePair_NetworkType(t *testing.T) {
+	candidate := func(address string, protocol ICEProtocol) *ICECandidate {
+		return &ICECandidate{Address: address, Protocol: protocol}
+	}
+	mdns := candidate("a9d3c8ad-1b6e-4a0f-9d4b-7c1f0e2b5d3a.local", ICEProtocolUDP)
+
+	testCases := []struct {
+		pair        *ICECandidatePair
+		shouldFail  bool
+		networkType NetworkType
+	}{
+		{NewICECandidatePair(candidate("192.168.0.1", ICEProtocolUDP), candidate("192.168.0.2", ICEProtocolUDP)), false, NetworkTypeUDP4},
+		{NewICECandidatePair(candidate("fe80::1", ICEProtocolUDP), candidate("fe80::2", ICEProtocolUDP)), false, NetworkTypeUDP6},
+		{NewICECandidatePair(candidate("192.168.0.1", ICEProtocolTCP), candidate("192.168.0.2", ICEProtocolTCP)), false, NetworkTypeTCP4},
+		{NewICECandidatePair(candidate("fe80::1", ICEProtocolTCP), candidate("fe80::2", ICEProtocolTCP)), false, NetworkTypeTCP6},
+		{NewICECandidatePair(mdns, candidate("fe80::2", ICEProtocolUDP)), false, NetworkTypeUDP6},
+		{NewICECandidatePair(mdns, mdns), true, NetworkType(Unknown)},
+	}
+
+	for i, testCase := range testCases {
+		networkType, err := testCase.pair.NetworkType()
+		if (err != nil) != testCase.shouldFail {
+			t.Error(err)
+		}
+		assert.Equal(t, testCase.networkType, networkType, "testCase: %d %v", i, testCase.pair)
+	}
+}
@@ -24,6 +24,9 @@ type ICEGatherer struct {
 
 	agent *ice.Agent
 
+	// gatheredCandidates are the candidates emitted by a trickle gathering so far
+	gatheredCandidates []ICECandidate
+
 	onLocalCandidateHdlr atomic.Value // func(candidate *ICECandidate)
 	onStateChangeHdlr    atomic.Value // func(state ICEGathererState)
 
@@ -34,15 +37,9 @@ type ICEGatherer struct {
 // This constructor is part of the ORTC API. It is not
 // meant to be used together with the basic WebRTC API.
 func (api *API) NewICEGatherer(opts ICEGatherOptions) (*ICEGatherer, error) {
-	var validatedServers []*ice.URL
-	if len(opts.ICEServers) > 0 {
-		for _, server := range opts.ICEServers {
-			url, err := server.urls()
-			if err != nil {
-				return nil, err
-			}
-			validatedServers = append(validatedServers, url...)
-		}
+	validatedServers, err := validateICEServers(opts.ICEServers)
+	if err != nil {
+		return nil, err
 	}
 
 	return &ICEGatherer{
@@ -54,6 +51,39 @@ func (api *API) NewICEGatherer(opts ICEGatherOptions) (*ICEGatherer, error) {
 	}, nil
 }
 
+func validateICEServers(servers []ICEServer) ([]*ice.URL, error) {
+	var validatedServers []*ice.URL
+	for _, server := range servers {
+		url, err := server.urls()
+		if err != nil {
+			return nil, err
+		}
+		validatedServers = append(validatedServers, url...)
+	}
+	return validatedServers, nil
+}
+
+// setICEServers replaces the ICE servers used the next time gathering starts,
+// a gathering that has already started keeps using the previous servers
+func (g *ICEGatherer) setICEServers(servers []ICEServer) error {
+	validatedServers, err := validateICEServers(servers)
+	if err != nil {
+		return err
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.validatedServers = validatedServers
+	return nil
+}
+
+// setGatherPolicy replaces the policy used the next time gathering starts
+func (g *ICEGatherer) setGatherPolicy(policy ICETransportPolicy) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.gatherPolicy = policy
+}
+
 func (g *ICEGatherer) createAgent() error {
 	g.lock.Lock()
 	defer g.lock.Unlock()
@@ -84,6 +114,8 @@ func (g *ICEGatherer) createAgent() error {
 		multicastDNSMode = ice.MulticastDNSModeQueryAndGather
 	}
 
+	usernameFragment, password := g.api.settingEngine.iceCredentials()
+
 	config := &ice.AgentConfig{
 		Trickle:                   g.api.settingEngine.candidates.ICETrickle,
 		Lite:                      g.api.settingEngine.candidates.ICELite,
@@ -105,8 +137,8 @@ func (g *ICEGatherer) createAgent() error {
 		Net:                       g.api.settingEngine.vnet,
 		MulticastDNSMode:          multicastDNSMode,
 		MulticastDNSHostName:      g.api.settingEngine.candidates.MulticastDNSHostName,
-		LocalUfrag:                g.api.settingEngine.candidates.UsernameFragment,
-		LocalPwd:                  g.api.settingEngine.candidates.Password,
+		LocalUfrag:                usernameFragment,
+		LocalPwd:                  password,
 	}
 
 	requestedNetworkTypes := g.api.settingEngine.candidates.ICENetworkTypes
@@ -159,6 +191,10 @@ func (g *ICEGatherer) Gather() error {
 				g.log.Warnf("Failed to convert ice.Candidate: %s", err)
 				return
 			}
+			g.lock.Lock()
+			g.gatheredCandidates = append(g.gatheredCandidates, c)
+			g.lock.Unlock()
+
 			onLocalCandidateHdlr(&c)
 		} else {
 			g.setState(ICEGathererStateComplete)
@@ -215,6 +251,26 @@ func (g *ICEGatherer) GetLocalCandidates() ([]ICECandidate, error) {
 	return newICECandidatesFromICE(iceCandidates)
 }
 
+// getGatheredCandidates returns the local candidates that have been gathered so
+// far. Unlike GetLocalCandidates it doesn't wait for the ICE agent, so it can be
+// called from the OnLocalCandidate handler.
+func (g *ICEGatherer) getGatheredCandidates() ([]ICECandidate, error) {
+	if g.State() == ICEGathererStateNew {
+		return []ICECandidate{}, nil
+	}
+
+	g.lock.Lock()
+	isTrickle := g.api.settingEngine.candidates.ICETrickle
+	gathered := append([]ICECandidate{}, g.gatheredCandidates...)
+	g.lock.Unlock()
+
+	// Without trickle the agent gathers all candidates before it is created
+	if !isTrickle {
+		return g.GetLocalCandidates()
+	}
+	return gathered, nil
+}
+
 // OnLocalCandidate sets an event handler which fires when a new local ICE candidate is available
 // Take note that the handler is gonna be called with a nil pointer when gathering is finished.
 func (g *ICEGatherer) OnLocalCandidate(f func(*ICECandidate)) {
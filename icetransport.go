@@ -29,6 +29,9 @@ type ICETransport struct {
 
 	state ICETransportState
 
+	// selectedCandidatePair is the pair the ICE agent last selected
+	selectedCandidatePair *ICECandidatePair
+
 	gatherer *ICEGatherer
 	conn     *ice.Conn
 	mux      *mux.Mux
@@ -46,10 +49,6 @@ type ICETransport struct {
 //
 // }
 //
-// func (t *ICETransport) GetSelectedCandidatePair() ICECandidatePair {
-//
-// }
-//
 // func (t *ICETransport) GetLocalParameters() ICEParameters {
 //
 // }
@@ -102,7 +101,11 @@ func (t *ICETransport) Start(gatherer *ICEGatherer, params ICEParameters, role *
 			t.log.Warnf("Unable to convert ICE candidates to ICECandidates: %s", err)
 			return
 		}
-		t.onSelectedCandidatePairChange(NewICECandidatePair(&candidates[0], &candidates[1]))
+		pair := NewICECandidatePair(&candidates[0], &candidates[1])
+		t.lock.Lock()
+		t.selectedCandidatePair = pair
+		t.lock.Unlock()
+		t.onSelectedCandidatePairChange(pair)
 	}); err != nil {
 		return err
 	}
@@ -165,6 +168,14 @@ func (t *ICETransport) Stop() error {
 	return nil
 }
 
+// GetSelectedCandidatePair returns the candidate pair that is used to send
+// and receive, or nil if no pair has been selected yet
+func (t *ICETransport) GetSelectedCandidatePair() *ICECandidatePair {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.selectedCandidatePair
+}
+
 // OnSelectedCandidatePairChange sets a handler that is invoked when a new
 // ICE candidate pair is selected
 func (t *ICETransport) OnSelectedCandidatePairChange(f func(*ICECandidatePair)) {
@@ -260,8 +271,8 @@ func (t *ICETransport) NewEndpoint(f mux.MatchFunc) *mux.Endpoint {
 func (t *ICETransport) ensureGatherer() error {
 	if t.gatherer == nil {
 		return errors.New("gatherer not started")
-	} else if t.gatherer.getAgent() == nil && t.gatherer.api.settingEngine.candidates.ICETrickle {
-		// Special case for trickle=true. (issue-707)
+	} else if candidates := t.gatherer.api.settingEngine.candidates; t.gatherer.getAgent() == nil && (candidates.ICETrickle || candidates.DeferGathering) {
+		// Special case for trickle=true (issue-707) and deferred gathering
 		if err := t.gatherer.createAgent(); err != nil {
 			return err
 		}
@@ -273,6 +284,7 @@ func (t *ICETransport) ensureGatherer() error {
 func (t *ICETransport) collectStats(collector *statsReportCollector) {
 	t.lock.Lock()
 	conn := t.conn
+	m := t.mux
 	t.lock.Unlock()
 
 	collector.Collecting()
@@ -287,6 +299,10 @@ func (t *ICETransport) collectStats(collector *statsReportCollector) {
 		stats.BytesSent = conn.BytesSent()
 		stats.BytesReceived = conn.BytesReceived()
 	}
+	if m != nil {
+		stats.PacketsSent = m.PacketsSent()
+		stats.PacketsReceived = m.PacketsReceived()
+	}
 
 	collector.Collect(stats.ID, stats)
 }
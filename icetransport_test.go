@@ -4,6 +4,7 @@ package webrtc
 
 import (
 	"math/rand"
+	"net"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -64,3 +65,42 @@ func TestICETransport_OnSelectedCandidatePairChange(t *testing.T) {
 
 	closePairNow(t, pcOffer, pcAnswer)
 }
+
+func TestICETransport_GetSelectedCandidatePair(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	s := SettingEngine{}
+	s.SetNetworkTypes([]NetworkType{NetworkTypeUDP4})
+	pcOffer, pcAnswer, err := NewAPI(WithSettingEngine(s)).newPair(Configuration{})
+	assert.NoError(t, err)
+	assert.Nil(t, pcOffer.iceTransport.GetSelectedCandidatePair())
+
+	connected := make(chan struct{})
+	pcOffer.OnICEConnectionStateChange(func(state ICEConnectionState) {
+		if state == ICEConnectionStateConnected {
+			close(connected)
+		}
+	})
+
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+	<-connected
+
+	// Only IPv4 candidates are gathered
+	candidates, err := pcOffer.iceGatherer.GetLocalCandidates()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, candidates)
+	for _, c := range candidates {
+		assert.NotNil(t, net.ParseIP(c.Address).To4(), "candidate: %s", c)
+	}
+
+	pair := pcOffer.iceTransport.GetSelectedCandidatePair()
+	if assert.NotNil(t, pair) {
+		networkType, err := pair.NetworkType()
+		assert.NoError(t, err)
+		assert.Equal(t, NetworkTypeUDP4, networkType)
+	}
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
@@ -3,6 +3,7 @@ package mux
 import (
 	"io"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/ice"
@@ -43,6 +44,8 @@ func (e *Endpoint) Write(p []byte) (int, error) {
 		return 0, nil
 	} else if err == ice.ErrClosed {
 		return 0, io.ErrClosedPipe
+	} else if err == nil {
+		atomic.AddUint32(&e.mux.packetsSent, 1)
 	}
 
 	return n, err
@@ -4,6 +4,7 @@ package mux
 import (
 	"net"
 	"sync"
+	"sync/atomic"
 
 	"github.com/pion/logging"
 	"github.com/pion/transport/packetio"
@@ -28,6 +29,10 @@ type Mux struct {
 	bufferSize int
 	closedCh   chan struct{}
 
+	// Packets read from and written to nextConn, updated atomically
+	packetsSent     uint32
+	packetsReceived uint32
+
 	log logging.LeveledLogger
 }
 
@@ -72,6 +77,17 @@ func (m *Mux) RemoveEndpoint(e *Endpoint) {
 	delete(m.endpoints, e)
 }
 
+// PacketsSent returns the number of packets the Endpoints have written
+func (m *Mux) PacketsSent() uint32 {
+	return atomic.LoadUint32(&m.packetsSent)
+}
+
+// PacketsReceived returns the number of packets read from the underlying conn,
+// including those no Endpoint matched
+func (m *Mux) PacketsReceived() uint32 {
+	return atomic.LoadUint32(&m.packetsReceived)
+}
+
 // Close closes the Mux and all associated Endpoints.
 func (m *Mux) Close() error {
 	m.lock.Lock()
@@ -107,6 +123,7 @@ func (m *Mux) readLoop() {
 		if err != nil {
 			return
 		}
+		atomic.AddUint32(&m.packetsReceived, 1)
 
 		err = m.dispatch(buf[:n])
 		if err != nil {
@@ -9,7 +9,12 @@ import (
 
 // RandSeq generates a random alpha numeric sequence of the requested length
 func RandSeq(n int) string {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return RandSeqWith(rand.New(rand.NewSource(time.Now().UnixNano())), n)
+}
+
+// RandSeqWith generates a random alpha numeric sequence of the requested length
+// from the given source of randomness
+func RandSeqWith(r *rand.Rand, n int) string {
 	letters := []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
 	b := make([]rune, n)
 	for i := range b {
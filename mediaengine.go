@@ -4,6 +4,7 @@ package webrtc
 
 import (
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -22,13 +23,49 @@ const (
 	DefaultPayloadTypeVP9  = 98
 	DefaultPayloadTypeH264 = 102
 
+	// payloadTypeH264ConstrainedBaseline is the PayloadType Chrome offers the
+	// constrained baseline H264 profile with
+	payloadTypeH264ConstrainedBaseline = 125
+
 	mediaNameAudio = "audio"
 	mediaNameVideo = "video"
 )
 
+// FrameMarkingURI is the URI of the frame marking RTP header extension, which
+// describes the frames of a video stream independently of the payload.
+// https://tools.ietf.org/html/draft-ietf-avtext-framemarking-10
+const FrameMarkingURI = "urn:ietf:params:rtp-hdrext:framemarking"
+
+// frameMarkingExtensionID is the ID the frame marking extension is offered with
+const frameMarkingExtensionID = 7
+
+// PlayoutDelayURI is the URI of the playout delay RTP header extension, which
+// tells the receiver the minimum and maximum delay to render video frames with.
+// http://www.webrtc.org/experiments/rtp-hdrext/playout-delay
+const PlayoutDelayURI = "http://www.webrtc.org/experiments/rtp-hdrext/playout-delay"
+
+// playoutDelayExtensionID is the ID the playout delay extension is offered with
+const playoutDelayExtensionID = 6
+
+// SDESRTPStreamIDURI is the URI of the RTP header extension that carries the
+// RID of a RTP stream, which identifies the layers of a simulcast set.
+// https://tools.ietf.org/html/rfc8852
+const SDESRTPStreamIDURI = "urn:ietf:params:rtp-hdrext:sdes:rtp-stream-id"
+
+// oneByteHeaderProfile is the profile of RFC 8285 one-byte header extensions
+const oneByteHeaderProfile = 0xBEDE
+
 // MediaEngine defines the codecs supported by a PeerConnection
 type MediaEngine struct {
-	codecs []*RTPCodec
+	codecs           []*RTPCodec
+	headerExtensions []mediaEngineHeaderExtension
+}
+
+// mediaEngineHeaderExtension is a RTP header extension enabled for a kind of
+// media, with the ID it is offered with
+type mediaEngineHeaderExtension struct {
+	RTPHeaderExtensionParameters
+	kind RTPCodecType
 }
 
 // RegisterCodec registers a codec to a media engine
@@ -52,6 +89,103 @@ func (m *MediaEngine) RegisterDefaultCodecs() {
 	m.RegisterCodec(NewRTPH264Codec(DefaultPayloadTypeH264, 90000))
 }
 
+// RegisterBrowserCodecs is a helper that registers the codecs browsers offer,
+// with the PayloadTypes and parameters Chrome uses for them. Remote codecs are
+// matched by their name and parameters, so this accepts VP8, VP9 and both the
+// baseline and constrained baseline H264 profiles of a browser offer. Only H264
+// with packetization-mode=1 is registered, as the H264 payloader fragments NAL
+// units. RTX isn't registered, retransmissions aren't supported.
+func (m *MediaEngine) RegisterBrowserCodecs() {
+	// Audio Codecs in order of preference
+	m.RegisterCodec(NewRTPOpusCodec(DefaultPayloadTypeOpus, 48000))
+	m.RegisterCodec(NewRTPG722Codec(DefaultPayloadTypeG722, 8000))
+	m.RegisterCodec(NewRTPPCMUCodec(DefaultPayloadTypePCMU, 8000))
+	m.RegisterCodec(NewRTPPCMACodec(DefaultPayloadTypePCMA, 8000))
+
+	// Video Codecs in order of preference
+	m.RegisterCodec(NewRTPVP8Codec(DefaultPayloadTypeVP8, 90000))
+	m.RegisterCodec(NewRTPCodecExt(RTPCodecTypeVideo, VP9, 90000, 0, "profile-id=0", DefaultPayloadTypeVP9, defaultVideoRTCPFeedback(), &codecs.VP9Payloader{}))
+	m.RegisterCodec(NewRTPH264Codec(DefaultPayloadTypeH264, 90000))
+	m.RegisterCodec(NewRTPH264CodecExt(payloadTypeH264ConstrainedBaseline, 90000, defaultVideoRTCPFeedback(),
+		"level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f"))
+}
+
+// RegisterFrameMarking enables the frame marking RTP header extension for video.
+// It is needed to forward end-to-end encrypted media, which can't be parsed to
+// find keyframes. Answers only accept the extension when the remote offered it.
+func (m *MediaEngine) RegisterFrameMarking() {
+	m.registerHeaderExtension(FrameMarkingURI, RTPCodecTypeVideo, frameMarkingExtensionID)
+}
+
+// RegisterPlayoutDelay enables the playout delay RTP header extension for
+// video, which carries the delays set with Track.SetPlayoutDelay. Answers only
+// accept the extension when the remote offered it.
+func (m *MediaEngine) RegisterPlayoutDelay() {
+	m.registerHeaderExtension(PlayoutDelayURI, RTPCodecTypeVideo, playoutDelayExtensionID)
+}
+
+// RegisterHeaderExtension enables the RTP header extension with the given URI
+// for a kind of media. It is offered and, if the remote offered it, accepted in
+// the answer. Answers only include the extensions that have been enabled, all
+// other extensions of the offer are rejected. The extension isn't added to
+// or parsed from the packets, this is up to the application.
+func (m *MediaEngine) RegisterHeaderExtension(uri string, kind RTPCodecType) error {
+	if kind != RTPCodecTypeAudio && kind != RTPCodecTypeVideo {
+		return fmt.Errorf("header extensions can only be registered for audio or video, not %s", kind)
+	} else if _, err := url.Parse(uri); err != nil {
+		return err
+	}
+
+	if !m.registerHeaderExtension(uri, kind, 0) {
+		return fmt.Errorf("no ID left to offer header extension %s with", uri)
+	}
+	return nil
+}
+
+// registerHeaderExtension enables a header extension, it is offered with the
+// preferred ID if that is free. It returns false if no ID is left.
+func (m *MediaEngine) registerHeaderExtension(uri string, kind RTPCodecType, preferredID int) bool {
+	used := map[int]bool{sdp.ExtMapValueTransportCC: true}
+	for _, headerExtension := range m.headerExtensions {
+		if headerExtension.URI != uri {
+			used[headerExtension.ID] = true
+			continue
+		}
+
+		// An extension enabled for both kinds is offered with the same ID
+		if headerExtension.kind == kind {
+			return true
+		}
+		preferredID = headerExtension.ID
+	}
+
+	id := preferredID
+	for candidate := 1; id == 0 || used[id]; candidate++ {
+		if candidate > 14 {
+			return false
+		}
+		id = candidate
+	}
+
+	m.headerExtensions = append(m.headerExtensions, mediaEngineHeaderExtension{
+		RTPHeaderExtensionParameters: RTPHeaderExtensionParameters{URI: uri, ID: id},
+		kind:                         kind,
+	})
+	return true
+}
+
+// getHeaderExtensionsByKind returns the RTP header extensions enabled for the
+// given kind with the IDs they are offered with
+func (m *MediaEngine) getHeaderExtensionsByKind(kind RTPCodecType) []RTPHeaderExtensionParameters {
+	headerExtensions := []RTPHeaderExtensionParameters{}
+	for _, headerExtension := range m.headerExtensions {
+		if headerExtension.kind == kind {
+			headerExtensions = append(headerExtensions, headerExtension.RTPHeaderExtensionParameters)
+		}
+	}
+	return headerExtensions
+}
+
 // PopulateFromSDP finds all codecs in a session description and adds them to a MediaEngine, using dynamic
 // payload types and parameters from the sdp.
 func (m *MediaEngine) PopulateFromSDP(sd SessionDescription) error {
@@ -116,17 +250,61 @@ func (m *MediaEngine) getCodec(payloadType uint8) (*RTPCodec, error) {
 
 func (m *MediaEngine) getCodecSDP(sdpCodec sdp.Codec) (*RTPCodec, error) {
 	for _, codec := range m.codecs {
-		if codec.Name == sdpCodec.Name &&
-			codec.ClockRate == sdpCodec.ClockRate &&
-			(sdpCodec.EncodingParameters == "" ||
-				strconv.Itoa(int(codec.Channels)) == sdpCodec.EncodingParameters) &&
-			codec.SDPFmtpLine == sdpCodec.Fmtp { // pion/webrtc#43
+		if codecMatchesSDP(codec, sdpCodec) {
 			return codec, nil
 		}
 	}
 	return nil, ErrCodecNotFound
 }
 
+func codecMatchesSDP(codec *RTPCodec, sdpCodec sdp.Codec) bool {
+	return codec.Name == sdpCodec.Name &&
+		codec.ClockRate == sdpCodec.ClockRate &&
+		(sdpCodec.EncodingParameters == "" ||
+			strconv.Itoa(int(codec.Channels)) == sdpCodec.EncodingParameters) &&
+		codec.SDPFmtpLine == sdpCodec.Fmtp // pion/webrtc#43
+}
+
+// mirrorPayloadTypes returns the codecs that are also in the remote media
+// section, using the PayloadType the remote assigned to them. Codecs the remote
+// doesn't support are left out, as they can't be used anyway.
+func mirrorPayloadTypes(codecs []*RTPCodec, remote *sdp.MediaDescription) ([]*RTPCodec, error) {
+	// Only look up codecs in this media section
+	remoteDescription := &sdp.SessionDescription{MediaDescriptions: []*sdp.MediaDescription{remote}}
+
+	mirrored := []*RTPCodec{}
+	payloadTypes := map[uint8]*RTPCodec{}
+	for _, format := range remote.MediaName.Formats {
+		pt, err := strconv.Atoi(format)
+		if err != nil {
+			return nil, fmt.Errorf("format parse error")
+		}
+
+		payloadType := uint8(pt)
+		remoteCodec, err := remoteDescription.GetCodecForPayloadType(payloadType)
+		if err != nil {
+			continue
+		}
+
+		for _, codec := range codecs {
+			if !codecMatchesSDP(codec, remoteCodec) {
+				continue
+			}
+
+			if existing, ok := payloadTypes[payloadType]; ok {
+				return nil, fmt.Errorf("remote payload type %d matches both %s and %s", payloadType, existing.Name, codec.Name)
+			}
+
+			mirroredCodec := *codec
+			mirroredCodec.PayloadType = payloadType
+			mirrored = append(mirrored, &mirroredCodec)
+			payloadTypes[payloadType] = codec
+		}
+	}
+
+	return mirrored, nil
+}
+
 // GetCodecsByKind returns all codecs of a chosen kind in the codecs list
 func (m *MediaEngine) GetCodecsByKind(kind RTPCodecType) []*RTPCodec {
 	var codecs []*RTPCodec
@@ -197,14 +375,16 @@ func NewRTPOpusCodec(payloadType uint8, clockrate uint32) *RTPCodec {
 	return c
 }
 
-// NewRTPVP8Codec is a helper to create an VP8 codec
+// NewRTPVP8Codec is a helper to create an VP8 codec, it advertises NACK,
+// PLI, FIR and REMB feedback
 func NewRTPVP8Codec(payloadType uint8, clockrate uint32) *RTPCodec {
-	c := NewRTPCodec(RTPCodecTypeVideo,
+	c := NewRTPCodecExt(RTPCodecTypeVideo,
 		VP8,
 		clockrate,
 		0,
 		"",
 		payloadType,
+		defaultVideoRTCPFeedback(),
 		&codecs.VP8Payloader{})
 	return c
 }
@@ -222,26 +402,30 @@ func NewRTPVP8CodecExt(payloadType uint8, clockrate uint32, rtcpfb []RTCPFeedbac
 	return c
 }
 
-// NewRTPVP9Codec is a helper to create an VP9 codec
+// NewRTPVP9Codec is a helper to create an VP9 codec, it advertises NACK,
+// PLI, FIR and REMB feedback
 func NewRTPVP9Codec(payloadType uint8, clockrate uint32) *RTPCodec {
-	c := NewRTPCodec(RTPCodecTypeVideo,
+	c := NewRTPCodecExt(RTPCodecTypeVideo,
 		VP9,
 		clockrate,
 		0,
 		"",
 		payloadType,
+		defaultVideoRTCPFeedback(),
 		&codecs.VP9Payloader{})
 	return c
 }
 
-// NewRTPH264Codec is a helper to create an H264 codec
+// NewRTPH264Codec is a helper to create an H264 codec, it advertises NACK,
+// PLI, FIR and REMB feedback
 func NewRTPH264Codec(payloadType uint8, clockrate uint32) *RTPCodec {
-	c := NewRTPCodec(RTPCodecTypeVideo,
+	c := NewRTPCodecExt(RTPCodecTypeVideo,
 		H264,
 		clockrate,
 		0,
 		"level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f",
 		payloadType,
+		defaultVideoRTCPFeedback(),
 		&codecs.H264Payloader{})
 	return c
 }
@@ -327,6 +511,33 @@ func NewRTPCodec(
 	}
 }
 
+// hasRTCPFeedback returns true if the codec supports the given RTCPFeedback
+func (c *RTPCodec) hasRTCPFeedback(feedbackType, parameter string) bool {
+	for _, feedback := range c.RTCPFeedback {
+		if feedback.Type == feedbackType && feedback.Parameter == parameter {
+			return true
+		}
+	}
+	return false
+}
+
+// ConvertTimestamp converts a RTP timestamp from the clock rate of this codec
+// to the clock rate of target. RTP timestamps start at a random offset, so this
+// should be used on the difference between two timestamps of the same stream.
+// It returns an error if either codec is nil or has no clock rate.
+// https://tools.ietf.org/html/rfc3550#section-5.1
+func (c *RTPCodec) ConvertTimestamp(timestamp uint32, target *RTPCodec) (uint32, error) {
+	switch {
+	case c == nil || target == nil:
+		return 0, fmt.Errorf("codecs to convert timestamps between must not be nil")
+	case c.ClockRate == 0:
+		return 0, fmt.Errorf("codec %s has no clock rate", c.Name)
+	case target.ClockRate == 0:
+		return 0, fmt.Errorf("codec %s has no clock rate", target.Name)
+	}
+	return uint32(uint64(timestamp) * uint64(target.ClockRate) / uint64(c.ClockRate)), nil
+}
+
 // NewRTPCodecExt is used to define a new codec
 func NewRTPCodecExt(
 	codecType RTPCodecType,
@@ -372,3 +583,183 @@ type RTPCapabilities struct {
 	Codecs           []RTPCodecCapability
 	HeaderExtensions []RTPHeaderExtensionCapability
 }
+
+// canDetectKeyframe returns true if isKeyframe supports the given codec
+func canDetectKeyframe(codecName string) bool {
+	return strings.EqualFold(codecName, VP8) || strings.EqualFold(codecName, VP9) || strings.EqualFold(codecName, H264)
+}
+
+// isKeyframe returns true if the RTP payload of the given codec starts a keyframe
+func isKeyframe(codecName string, payload []byte) bool {
+	switch {
+	case strings.EqualFold(codecName, VP8):
+		return isVP8Keyframe(payload)
+	case strings.EqualFold(codecName, VP9):
+		return isVP9Keyframe(payload)
+	case strings.EqualFold(codecName, H264):
+		return isH264Keyframe(payload)
+	}
+	return false
+}
+
+// https://tools.ietf.org/html/rfc7741#section-4.2
+func isVP8Keyframe(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+
+	// Only the first packet of the first partition contains the frame header
+	if payload[0]&0x10 == 0 || payload[0]&0x07 != 0 {
+		return false
+	}
+
+	i := 1
+	if payload[0]&0x80 != 0 {
+		if len(payload) < 2 {
+			return false
+		}
+		extension := payload[1]
+		i++
+
+		if extension&0x80 != 0 { // PictureID
+			if len(payload) <= i {
+				return false
+			}
+			if payload[i]&0x80 != 0 {
+				i++
+			}
+			i++
+		}
+		if extension&0x40 != 0 { // TL0PICIDX
+			i++
+		}
+		if extension&0x30 != 0 { // TID/KEYIDX
+			i++
+		}
+	}
+
+	// The inverse key frame flag of the VP8 payload header
+	return len(payload) > i && payload[i]&0x01 == 0
+}
+
+// https://tools.ietf.org/html/draft-ietf-payload-vp9-10#section-4.2
+func isVP9Keyframe(payload []byte) bool {
+	// Start of a frame that is not inter-picture predicted
+	return len(payload) > 0 && payload[0]&0x40 == 0 && payload[0]&0x08 != 0
+}
+
+// https://tools.ietf.org/html/rfc6184#section-5.2
+func isH264Keyframe(payload []byte) bool {
+	const (
+		naluTypeIDR  = 5
+		naluTypeSPS  = 7
+		naluTypeSTAP = 24
+		naluTypeFUA  = 28
+	)
+
+	if len(payload) < 1 {
+		return false
+	}
+
+	switch naluType := payload[0] & 0x1F; naluType {
+	case naluTypeIDR, naluTypeSPS:
+		return true
+	case naluTypeSTAP:
+		for i := 1; i+2 < len(payload); {
+			size := int(payload[i])<<8 | int(payload[i+1])
+			if t := payload[i+2] & 0x1F; t == naluTypeIDR || t == naluTypeSPS {
+				return true
+			}
+			i += 2 + size
+		}
+	case naluTypeFUA:
+		// The start of a fragmented IDR
+		return len(payload) > 1 && payload[1]&0x80 != 0 && payload[1]&0x1F == naluTypeIDR
+	}
+	return false
+}
+
+// oneByteHeaderExtension returns the element with the given ID of the RFC 8285
+// one-byte header extension of a packet
+func oneByteHeaderExtension(header *rtp.Header, id uint8) ([]byte, bool) {
+	if !header.Extension || header.ExtensionProfile != oneByteHeaderProfile || id == 0 {
+		return nil, false
+	}
+
+	payload := header.ExtensionPayload
+	for i := 0; i < len(payload); {
+		elementID := payload[i] >> 4
+		switch elementID {
+		case 0: // Padding
+			i++
+			continue
+		case 15:
+			return nil, false
+		}
+
+		length := int(payload[i]&0x0F) + 1
+		if i+1+length > len(payload) {
+			return nil, false
+		}
+		if elementID == id {
+			return payload[i+1 : i+1+length], true
+		}
+		i += 1 + length
+	}
+	return nil, false
+}
+
+// withOneByteHeaderExtension returns a copy of the header with an element added
+// to its RFC 8285 one-byte header extension. The header is returned unchanged if
+// it already has an element with the ID or uses a different extension profile.
+func withOneByteHeaderExtension(header *rtp.Header, id uint8, element []byte) *rtp.Header {
+	if header.Extension && header.ExtensionProfile != oneByteHeaderProfile {
+		return header
+	} else if _, ok := oneByteHeaderExtension(header, id); ok {
+		return header
+	}
+
+	// Keep the existing elements, but not the padding after them
+	end := 0
+	if header.Extension {
+		payload := header.ExtensionPayload
+		for i := 0; i < len(payload) && payload[i]>>4 != 15; {
+			if payload[i] == 0 {
+				i++
+				continue
+			}
+			i += 1 + int(payload[i]&0x0F) + 1
+			end = i
+		}
+		if end > len(payload) {
+			return header
+		}
+	}
+
+	payload := append([]byte{}, header.ExtensionPayload[:end]...)
+	payload = append(payload, id<<4|byte(len(element)-1))
+	payload = append(payload, element...)
+	for len(payload)%4 != 0 {
+		payload = append(payload, 0)
+	}
+
+	extended := *header
+	extended.Extension = true
+	extended.ExtensionProfile = oneByteHeaderProfile
+	extended.ExtensionPayload = payload
+	return &extended
+}
+
+// playoutDelayElement encodes the minimum and maximum delay of the playout delay
+// header extension, which are 12 bit values in units of 10ms
+// http://www.webrtc.org/experiments/rtp-hdrext/playout-delay
+func playoutDelayElement(min, max uint16) []byte {
+	return []byte{byte(min >> 4), byte(min<<4) | byte(max>>8&0x0F), byte(max)}
+}
+
+// isFrameMarkingIndependent returns true if a frame marking extension marks the
+// start of a frame that can be decoded without the previous ones
+// https://tools.ietf.org/html/draft-ietf-avtext-framemarking-10#section-3
+func isFrameMarkingIndependent(extension []byte) bool {
+	return len(extension) > 0 && extension[0]&0x80 != 0 && extension[0]&0x20 != 0
+}
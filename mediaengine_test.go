@@ -3,11 +3,15 @@
 package webrtc
 
 import (
+	"fmt"
 	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/pion/rtp"
 	"github.com/pion/sdp/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCodecRegistration(t *testing.T) {
@@ -108,3 +112,374 @@ func TestOpusCase(t *testing.T) {
 	assert.True(t, regexp.MustCompile(`(?m)^a=rtpmap:\d+ opus/48000/2`).MatchString(offer.SDP))
 	assert.NoError(t, pc.Close())
 }
+
+func TestRTPCodec_ConvertTimestamp(t *testing.T) {
+	video := NewRTPVP8Codec(DefaultPayloadTypeVP8, 90000)
+	audio := NewRTPOpusCodec(DefaultPayloadTypeOpus, 48000)
+
+	for _, testCase := range []struct {
+		from, to  *RTPCodec
+		timestamp uint32
+		expected  uint32
+	}{
+		// One second of video is one second of audio
+		{video, audio, 90000, 48000},
+		{audio, video, 48000, 90000},
+		// A 30fps frame interval is 1600 ticks at 48kHz
+		{video, audio, 3000, 1600},
+		// Deltas that would overflow 32bit intermediate math still convert
+		{video, audio, 0xFFFFFFFF / 90000 * 90000, 0xFFFFFFFF / 90000 * 48000},
+		{video, video, 0xFFFFFFFF, 0xFFFFFFFF},
+		{video, audio, 0, 0},
+	} {
+		converted, err := testCase.from.ConvertTimestamp(testCase.timestamp, testCase.to)
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, converted)
+	}
+
+	// Codecs without a clock rate and missing codecs can't be converted between
+	var missing *RTPCodec
+	for _, codecs := range [][2]*RTPCodec{{&RTPCodec{}, audio}, {video, &RTPCodec{}}, {video, nil}, {missing, audio}} {
+		_, err := codecs[0].ConvertTimestamp(90000, codecs[1])
+		assert.Error(t, err)
+	}
+}
+
+func TestMirrorPayloadTypes(t *testing.T) {
+	remote := (&sdp.MediaDescription{}).
+		WithCodec(105, VP8, 90000, 0, "").
+		WithCodec(115, H264, 90000, 0, "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f").
+		WithCodec(116, "rtx", 90000, 0, "apt=115")
+
+	m := MediaEngine{}
+	m.RegisterDefaultCodecs()
+
+	mirrored, err := mirrorPayloadTypes(m.GetCodecsByKind(RTPCodecTypeVideo), remote)
+	assert.NoError(t, err)
+
+	payloadTypes := map[string]uint8{}
+	for _, codec := range mirrored {
+		payloadTypes[codec.Name] = codec.PayloadType
+	}
+	assert.Equal(t, map[string]uint8{VP8: 105, H264: 115}, payloadTypes)
+
+	// The codecs of the MediaEngine are not modified
+	codec, err := m.getCodec(DefaultPayloadTypeVP8)
+	assert.NoError(t, err)
+	assert.Equal(t, VP8, codec.Name)
+
+	// Two local codecs can't use the same remote PayloadType
+	_, err = mirrorPayloadTypes([]*RTPCodec{NewRTPVP8Codec(96, 90000), NewRTPVP8Codec(97, 90000)}, remote)
+	assert.Error(t, err)
+}
+
+func TestMediaEngine_RegisterBrowserCodecs(t *testing.T) {
+	// The media sections of an offer from Chrome
+	chromeOffer := `v=0
+o=- 4596489990601351948 2 IN IP4 127.0.0.1
+s=-
+t=0 0
+m=audio 9 UDP/TLS/RTP/SAVPF 111 103 104 9 0 8 106 105 13 110 112 113 126
+c=IN IP4 0.0.0.0
+a=rtpmap:111 opus/48000/2
+a=rtcp-fb:111 transport-cc
+a=fmtp:111 minptime=10;useinbandfec=1
+a=rtpmap:103 ISAC/16000
+a=rtpmap:104 ISAC/32000
+a=rtpmap:9 G722/8000
+a=rtpmap:0 PCMU/8000
+a=rtpmap:8 PCMA/8000
+a=rtpmap:106 CN/32000
+a=rtpmap:105 CN/16000
+a=rtpmap:13 CN/8000
+a=rtpmap:110 telephone-event/48000
+a=rtpmap:112 telephone-event/32000
+a=rtpmap:113 telephone-event/16000
+a=rtpmap:126 telephone-event/8000
+m=video 9 UDP/TLS/RTP/SAVPF 96 97 98 99 100 101 102 122 127 121 125 107 108 109
+c=IN IP4 0.0.0.0
+a=rtpmap:96 VP8/90000
+a=rtcp-fb:96 goog-remb
+a=rtcp-fb:96 transport-cc
+a=rtcp-fb:96 ccm fir
+a=rtcp-fb:96 nack
+a=rtcp-fb:96 nack pli
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=96
+a=rtpmap:98 VP9/90000
+a=fmtp:98 profile-id=0
+a=rtpmap:99 rtx/90000
+a=fmtp:99 apt=98
+a=rtpmap:100 VP9/90000
+a=fmtp:100 profile-id=2
+a=rtpmap:101 rtx/90000
+a=fmtp:101 apt=100
+a=rtpmap:102 H264/90000
+a=fmtp:102 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f
+a=rtpmap:122 rtx/90000
+a=fmtp:122 apt=102
+a=rtpmap:127 H264/90000
+a=fmtp:127 level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=42001f
+a=rtpmap:121 rtx/90000
+a=fmtp:121 apt=127
+a=rtpmap:125 H264/90000
+a=fmtp:125 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f
+a=rtpmap:107 rtx/90000
+a=fmtp:107 apt=125
+a=rtpmap:108 H264/90000
+a=fmtp:108 level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=42e01f
+a=rtpmap:109 rtx/90000
+a=fmtp:109 apt=108
+`
+	parsed := sdp.SessionDescription{}
+	require.NoError(t, parsed.Unmarshal([]byte(strings.Replace(chromeOffer, "\n", "\r\n", -1))))
+	require.Len(t, parsed.MediaDescriptions, 2)
+
+	m := MediaEngine{}
+	m.RegisterBrowserCodecs()
+
+	intersect := func(kind RTPCodecType, media *sdp.MediaDescription) []string {
+		mirrored, err := mirrorPayloadTypes(m.GetCodecsByKind(kind), media)
+		require.NoError(t, err)
+
+		codecs := []string{}
+		for _, codec := range mirrored {
+			codecs = append(codecs, fmt.Sprintf("%d %s %s", codec.PayloadType, codec.Name, codec.SDPFmtpLine))
+		}
+		return codecs
+	}
+
+	assert.Equal(t, []string{
+		"111 opus minptime=10;useinbandfec=1",
+		"9 G722 ",
+		"0 PCMU ",
+		"8 PCMA ",
+	}, intersect(RTPCodecTypeAudio, parsed.MediaDescriptions[0]))
+
+	assert.Equal(t, []string{
+		"96 VP8 ",
+		"98 VP9 profile-id=0",
+		"102 H264 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f",
+		"125 H264 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+	}, intersect(RTPCodecTypeVideo, parsed.MediaDescriptions[1]))
+
+	// The PayloadTypes are the ones Chrome uses, so they are kept without mirroring
+	for _, codec := range append(m.GetCodecsByKind(RTPCodecTypeAudio), m.GetCodecsByKind(RTPCodecTypeVideo)...) {
+		remoteCodec, err := parsed.GetCodecForPayloadType(codec.PayloadType)
+		require.NoError(t, err)
+		assert.True(t, codecMatchesSDP(codec, remoteCodec), "codec: %s", codec.Name)
+	}
+}
+
+func TestPeerConnection_MirrorRemotePayloadTypes(t *testing.T) {
+	offerMediaEngine := MediaEngine{}
+	offerMediaEngine.RegisterCodec(NewRTPOpusCodec(109, 48000))
+	offerMediaEngine.RegisterCodec(NewRTPVP8Codec(120, 90000))
+	pcOffer, err := NewAPI(WithMediaEngine(offerMediaEngine)).NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	s := SettingEngine{}
+	s.SetMirrorRemotePayloadTypes(true)
+	answerAPI := NewAPI(WithSettingEngine(s))
+	answerAPI.mediaEngine.RegisterDefaultCodecs()
+	pcAnswer, err := answerAPI.NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	for _, kind := range []RTPCodecType{RTPCodecTypeAudio, RTPCodecTypeVideo} {
+		_, err = pcOffer.AddTransceiverFromKind(kind)
+		assert.NoError(t, err)
+		_, err = pcAnswer.AddTransceiverFromKind(kind, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+		assert.NoError(t, err)
+	}
+
+	offer, err := pcOffer.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcAnswer.SetRemoteDescription(offer))
+
+	answer, err := pcAnswer.CreateAnswer(nil)
+	assert.NoError(t, err)
+
+	parsed, err := answer.Unmarshal()
+	assert.NoError(t, err)
+
+	formats := map[string][]string{}
+	for _, media := range parsed.MediaDescriptions {
+		formats[media.MediaName.Media] = media.MediaName.Formats
+	}
+	assert.Equal(t, []string{"109"}, formats[mediaNameAudio])
+	assert.Equal(t, []string{"120"}, formats[mediaNameVideo])
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestIsKeyframe(t *testing.T) {
+	testCases := []struct {
+		codec    string
+		payload  []byte
+		keyframe bool
+	}{
+		{VP8, []byte{0x10, 0x00}, true},
+		{VP8, []byte{0x10, 0x01}, false},
+		{VP8, []byte{0x00, 0x00}, false},
+		{VP8, []byte{0x90, 0x80, 0x81, 0x02, 0x00}, true},
+		{VP8, []byte{0x90, 0xE0, 0x01, 0x02, 0x03, 0x01}, false},
+		{VP8, []byte{0x90, 0x80}, false},
+		{VP9, []byte{0x88}, true},
+		{VP9, []byte{0xC8}, false},
+		{VP9, []byte{0x80}, false},
+		{H264, []byte{0x65, 0x00}, true},
+		{H264, []byte{0x67, 0x00}, true},
+		{H264, []byte{0x61, 0x00}, false},
+		{H264, []byte{0x78, 0x00, 0x01, 0x09, 0x00, 0x02, 0x67, 0x00}, true},
+		{H264, []byte{0x78, 0x00, 0x01, 0x09, 0x00, 0x02, 0x61, 0x00}, false},
+		{H264, []byte{0x7C, 0x85, 0x00}, true},
+		{H264, []byte{0x7C, 0x05, 0x00}, false},
+		{Opus, []byte{0x00}, false},
+		{VP8, []byte{}, false},
+	}
+
+	for i, testCase := range testCases {
+		assert.Equal(t, testCase.keyframe, isKeyframe(testCase.codec, testCase.payload), "testCase: %d", i)
+	}
+}
+
+func TestDefaultRTCPFeedback(t *testing.T) {
+	pc, err := NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	for _, kind := range []RTPCodecType{RTPCodecTypeAudio, RTPCodecTypeVideo} {
+		_, err = pc.AddTransceiverFromKind(kind)
+		assert.NoError(t, err)
+	}
+
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+
+	parsed := &sdp.SessionDescription{}
+	assert.NoError(t, parsed.Unmarshal([]byte(offer.SDP)))
+	for _, media := range parsed.MediaDescriptions {
+		var feedback []string
+		for _, attr := range media.Attributes {
+			if attr.Key == "rtcp-fb" && strings.HasPrefix(attr.Value, "96 ") {
+				feedback = append(feedback, attr.Value)
+			} else if attr.Key == "rtcp-fb" {
+				assert.Equal(t, "video", media.MediaName.Media)
+			}
+		}
+
+		if media.MediaName.Media == "video" {
+			assert.Equal(t, []string{"96 nack", "96 nack pli", "96 ccm fir", "96 goog-remb"}, feedback)
+		} else {
+			assert.Empty(t, feedback)
+		}
+	}
+	assert.NoError(t, pc.Close())
+}
+
+func TestWithOneByteHeaderExtension(t *testing.T) {
+	element := []byte{0x01, 0x02, 0x03}
+
+	header := &rtp.Header{}
+	extended := withOneByteHeaderExtension(header, 6, element)
+	assert.False(t, header.Extension)
+	assert.True(t, extended.Extension)
+	assert.Equal(t, uint16(0xBEDE), extended.ExtensionProfile)
+	assert.Equal(t, []byte{0x62, 0x01, 0x02, 0x03}, extended.ExtensionPayload)
+
+	// Existing elements are kept, the padding is moved to the end
+	header = &rtp.Header{Extension: true, ExtensionProfile: 0xBEDE, ExtensionPayload: []byte{0x70, 0xC0, 0x00, 0x00}}
+	extended = withOneByteHeaderExtension(header, 6, element)
+	assert.Equal(t, []byte{0x70, 0xC0, 0x62, 0x01, 0x02, 0x03, 0x00, 0x00}, extended.ExtensionPayload)
+	assert.Equal(t, []byte{0x70, 0xC0, 0x00, 0x00}, header.ExtensionPayload)
+
+	// Elements that are already set and other profiles are left alone
+	header = &rtp.Header{Extension: true, ExtensionProfile: 0xBEDE, ExtensionPayload: []byte{0x62, 0x00, 0x00, 0x00}}
+	assert.Equal(t, header, withOneByteHeaderExtension(header, 6, element))
+	header = &rtp.Header{Extension: true, ExtensionProfile: 0x1000, ExtensionPayload: []byte{0x06, 0x01, 0x00, 0x00}}
+	assert.Equal(t, header, withOneByteHeaderExtension(header, 6, element))
+}
+
+func TestMediaEngine_RegisterHeaderExtension(t *testing.T) {
+	const (
+		audioLevelURI  = "urn:ietf:params:rtp-hdrext:ssrc-audio-level"
+		absSendTimeURI = "http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time"
+	)
+
+	m := MediaEngine{}
+	assert.Error(t, m.RegisterHeaderExtension(absSendTimeURI, RTPCodecType(0)))
+	for id := 1; id <= 13; id++ {
+		assert.NoError(t, m.RegisterHeaderExtension(fmt.Sprintf("urn:test:%d", id), RTPCodecTypeVideo))
+	}
+	assert.Error(t, m.RegisterHeaderExtension(absSendTimeURI, RTPCodecTypeVideo), "all IDs but the one of transport-cc are in use")
+
+	offerer := MediaEngine{}
+	offerer.RegisterDefaultCodecs()
+	offerer.RegisterFrameMarking()
+	offerer.RegisterPlayoutDelay()
+	assert.NoError(t, offerer.RegisterHeaderExtension(audioLevelURI, RTPCodecTypeAudio))
+	assert.NoError(t, offerer.RegisterHeaderExtension(absSendTimeURI, RTPCodecTypeVideo))
+	assert.NoError(t, offerer.RegisterHeaderExtension(absSendTimeURI, RTPCodecTypeAudio))
+
+	answerer := MediaEngine{}
+	answerer.RegisterDefaultCodecs()
+	answerer.RegisterPlayoutDelay()
+	assert.NoError(t, answerer.RegisterHeaderExtension(absSendTimeURI, RTPCodecTypeVideo))
+	assert.NoError(t, answerer.RegisterHeaderExtension("urn:test:not-offered", RTPCodecTypeVideo))
+
+	pcOffer, err := NewAPI(WithMediaEngine(offerer)).NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+	pcAnswer, err := NewAPI(WithMediaEngine(answerer)).NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+
+	for _, kind := range []RTPCodecType{RTPCodecTypeVideo, RTPCodecTypeAudio} {
+		_, err = pcOffer.AddTransceiverFromKind(kind)
+		require.NoError(t, err)
+	}
+	offer, err := pcOffer.CreateOffer(nil)
+	require.NoError(t, err)
+	require.NoError(t, pcAnswer.SetRemoteDescription(offer))
+	answer, err := pcAnswer.CreateAnswer(nil)
+	require.NoError(t, err)
+
+	parsedOffer, parsedAnswer := sdp.SessionDescription{}, sdp.SessionDescription{}
+	require.NoError(t, parsedOffer.Unmarshal([]byte(offer.SDP)))
+	require.NoError(t, parsedAnswer.Unmarshal([]byte(answer.SDP)))
+
+	// Only the extensions enabled by both are answered, with the IDs of the offer
+	offeredVideo := parsedOffer.MediaDescriptions[0]
+	assert.Len(t, headerExtensionsFromSDP(offeredVideo), 3)
+	assert.Equal(t, []RTPHeaderExtensionParameters{
+		{URI: PlayoutDelayURI, ID: int(headerExtensionIDFromSDP(offeredVideo, PlayoutDelayURI))},
+		{URI: absSendTimeURI, ID: int(headerExtensionIDFromSDP(offeredVideo, absSendTimeURI))},
+	}, headerExtensionsFromSDP(parsedAnswer.MediaDescriptions[0]))
+
+	assert.Len(t, headerExtensionsFromSDP(parsedOffer.MediaDescriptions[1]), 2)
+	assert.Empty(t, headerExtensionsFromSDP(parsedAnswer.MediaDescriptions[1]))
+
+	// An extension enabled for audio and video is offered with the same ID
+	assert.Equal(t, headerExtensionIDFromSDP(offeredVideo, absSendTimeURI), headerExtensionIDFromSDP(parsedOffer.MediaDescriptions[1], absSendTimeURI))
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+
+	// Plan B offers the extensions in the audio and video media sections too
+	pcPlanB, err := NewAPI(WithMediaEngine(offerer)).NewPeerConnection(Configuration{SDPSemantics: SDPSemanticsPlanB})
+	require.NoError(t, err)
+	for _, kind := range []RTPCodecType{RTPCodecTypeVideo, RTPCodecTypeVideo, RTPCodecTypeAudio, RTPCodecTypeAudio} {
+		_, err = pcPlanB.AddTransceiverFromKind(kind)
+		require.NoError(t, err)
+	}
+	offer, err = pcPlanB.CreateOffer(nil)
+	require.NoError(t, err)
+
+	parsedOffer = sdp.SessionDescription{}
+	require.NoError(t, parsedOffer.Unmarshal([]byte(offer.SDP)))
+	require.Len(t, parsedOffer.MediaDescriptions, 3)
+	assert.Equal(t, "video", parsedOffer.MediaDescriptions[0].MediaName.Media)
+	assert.Len(t, headerExtensionsFromSDP(parsedOffer.MediaDescriptions[0]), 3)
+	assert.Equal(t, "audio", parsedOffer.MediaDescriptions[1].MediaName.Media)
+	assert.Len(t, headerExtensionsFromSDP(parsedOffer.MediaDescriptions[1]), 2)
+
+	assert.NoError(t, pcPlanB.Close())
+}
@@ -12,6 +12,16 @@ type OfferAnswerOptions struct {
 // creation process.
 type AnswerOptions struct {
 	OfferAnswerOptions
+
+	// DTLSRole overrides the role announced in the a=setup attribute of the
+	// answer, DTLSRoleClient for active and DTLSRoleServer for passive. The
+	// DTLS transport takes the role that is announced. When unset the role of
+	// SettingEngine.SetAnsweringDTLSRole is used.
+	DTLSRole DTLSRole
+
+	// RejectDataChannels answers the application media section of the offer
+	// with port 0, so neither side starts SCTP and no DataChannels are opened.
+	RejectDataChannels bool
 }
 
 // OfferOptions structure describes the options used to control the offer
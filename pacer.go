@@ -0,0 +1,117 @@
+// +build !js
+
+package webrtc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// pacerQueueSize is the number of packets a pacer holds, packets written while
+// it is full are dropped
+const pacerQueueSize = 1024
+
+// pacingFactor is how much faster than a Receiver Estimated Maximum Bitrate the
+// pacer sends, so bursts of an encoder within the estimate don't build a queue
+const pacingFactor = 2.5
+
+type pacedPacket struct {
+	header  rtp.Header
+	payload []byte
+}
+
+// pacer is a leaky bucket that spreads the packets written to it over time, so
+// they leave at most at the bitrate of the pacer instead of in bursts. bitrate
+// is the configured one, estimate the one derived from the Receiver Estimated
+// Maximum Bitrate of the remote. The lower of both is used.
+type pacer struct {
+	mu       sync.Mutex
+	bitrate  uint64
+	estimate uint64
+
+	queue chan pacedPacket
+	write func(header *rtp.Header, payload []byte) error
+}
+
+func newPacer(bitrate uint64, write func(header *rtp.Header, payload []byte) error) *pacer {
+	return &pacer{
+		bitrate: bitrate,
+		queue:   make(chan pacedPacket, pacerQueueSize),
+		write:   write,
+	}
+}
+
+func (p *pacer) getBitrate() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.estimate != 0 && p.estimate < p.bitrate {
+		return p.estimate
+	}
+	return p.bitrate
+}
+
+func (p *pacer) setBitrate(bitrate uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bitrate = bitrate
+}
+
+func (p *pacer) setEstimate(estimate uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.estimate = estimate
+}
+
+// enqueue copies the packet into the queue, it returns false if the queue is full
+func (p *pacer) enqueue(header *rtp.Header, payload []byte) bool {
+	packet := pacedPacket{header: *header, payload: append([]byte{}, payload...)}
+	packet.header.CSRC = append([]uint32{}, header.CSRC...)
+	packet.header.ExtensionPayload = append([]byte{}, header.ExtensionPayload...)
+
+	select {
+	case p.queue <- packet:
+		return true
+	default:
+		return false
+	}
+}
+
+// run writes the queued packets until done is closed. After each packet the
+// pacer waits as long as sending it takes at the bitrate, time the queue was
+// empty doesn't allow a burst afterwards.
+func (p *pacer) run(done <-chan interface{}, onError func(error)) {
+	next := time.Now()
+	for {
+		var packet pacedPacket
+		select {
+		case <-done:
+			return
+		case packet = <-p.queue:
+		}
+
+		if wait := time.Until(next); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		if err := p.write(&packet.header, packet.payload); err != nil {
+			onError(err)
+		}
+
+		now := time.Now()
+		if next.Before(now) {
+			next = now
+		}
+		if bitrate := p.getBitrate(); bitrate > 0 {
+			bits := (packet.header.MarshalSize() + len(packet.payload)) * 8
+			next = next.Add(time.Duration(float64(bits) / float64(bitrate) * float64(time.Second)))
+		}
+	}
+}
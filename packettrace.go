@@ -0,0 +1,48 @@
+// +build !js
+
+package webrtc
+
+import (
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// PacketTrace describes a RTP or RTCP packet that was sent or received, it is
+// passed to the tracer set with SettingEngine.SetPacketTracer
+type PacketTrace struct {
+	// Outbound is true for packets that were sent and false for received ones
+	Outbound bool
+
+	// RTP is the header of a RTP packet, it is nil for RTCP
+	RTP *rtp.Header
+
+	// RTCP holds the packets of a compound RTCP packet, it is nil for RTP
+	RTCP []rtcp.Packet
+}
+
+// traceRTP passes the header of a RTP packet to the packet tracer
+func (e *SettingEngine) traceRTP(outbound bool, header *rtp.Header) {
+	if e.packetTracer != nil {
+		e.packetTracer(PacketTrace{Outbound: outbound, RTP: header})
+	}
+}
+
+// traceRawRTP passes the header of a received RTP packet to the packet tracer,
+// it is only unmarshaled if a tracer is set
+func (e *SettingEngine) traceRawRTP(raw []byte) {
+	if e.packetTracer == nil {
+		return
+	}
+
+	header := &rtp.Header{}
+	if err := header.Unmarshal(raw); err == nil {
+		e.packetTracer(PacketTrace{RTP: header})
+	}
+}
+
+// traceRTCP passes a compound RTCP packet to the packet tracer
+func (e *SettingEngine) traceRTCP(outbound bool, pkts []rtcp.Packet) {
+	if e.packetTracer != nil {
+		e.packetTracer(PacketTrace{Outbound: outbound, RTCP: pkts})
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"fmt"
-	mathRand "math/rand"
 	"strconv"
 	"strings"
 	"sync"
@@ -17,6 +16,7 @@ import (
 	"github.com/pion/logging"
 	"github.com/pion/rtcp"
 	"github.com/pion/sdp/v2"
+	"github.com/pion/srtp"
 
 	"github.com/pion/webrtc/v2/internal/util"
 	"github.com/pion/webrtc/v2/pkg/rtcerr"
@@ -53,11 +53,22 @@ type PeerConnection struct {
 
 	rtpTransceivers []*RTPTransceiver
 
+	// earlyReceivers have received media before SetLocalDescription was
+	// called, their Tracks are announced once it is. The packets are kept in
+	// the bounded buffers of the SRTP streams until then.
+	earlyReceivers []*RTPReceiver
+
 	onSignalingStateChangeHandler     func(SignalingState)
 	onICEConnectionStateChangeHandler func(ICEConnectionState)
 	onConnectionStateChangeHandler    func(PeerConnectionState)
 	onTrackHandler                    func(*Track, *RTPReceiver)
 	onDataChannelHandler              func(*DataChannel)
+	onRTCPHandler                     func([]rtcp.Packet, uint32, *RTPReceiver, *RTPSender)
+	onSSRCCollisionHandler            func(uint32)
+	onNegotiationNeededHandler        func()
+
+	// RTCP streams accepted for SSRCs that no RTPSender or RTPReceiver claimed
+	unhandledRTCPStreams []*srtp.ReadStreamSRTCP
 
 	iceGatherer   *ICEGatherer
 	iceTransport  *ICETransport
@@ -116,7 +127,7 @@ func (api *API) NewPeerConnection(configuration Configuration) (*PeerConnection,
 		return nil, err
 	}
 
-	if !pc.api.settingEngine.candidates.ICETrickle {
+	if !pc.api.settingEngine.candidates.ICETrickle && !pc.api.settingEngine.candidates.DeferGathering {
 		if err = pc.iceGatherer.Gather(); err != nil {
 			return nil, err
 		}
@@ -132,6 +143,7 @@ func (api *API) NewPeerConnection(configuration Configuration) (*PeerConnection,
 		return nil, err
 	}
 	pc.dtlsTransport = dtlsTransport
+	pc.dtlsTransport.setOnUnhandledRTCP(pc.onRTCP)
 
 	// Create the SCTP transport
 	pc.sctpTransport = pc.api.NewSCTPTransport(pc.dtlsTransport)
@@ -248,6 +260,16 @@ func (pc *PeerConnection) OnICECandidate(f func(*ICECandidate)) {
 	pc.iceGatherer.OnLocalCandidate(f)
 }
 
+// GetLocalCandidates returns the local ICE candidates that have been gathered
+// so far, in the order they were passed to the OnICECandidate handler. It
+// doesn't wait for gathering to complete and may be called from the handler.
+func (pc *PeerConnection) GetLocalCandidates() ([]ICECandidate, error) {
+	if pc.isClosed.get() {
+		return nil, &rtcerr.InvalidStateError{Err: ErrConnectionClosed}
+	}
+	return pc.iceGatherer.getGatheredCandidates()
+}
+
 // OnICEGatheringStateChange sets an event handler which is invoked when the
 // ICE candidate gathering state has changed.
 func (pc *PeerConnection) OnICEGatheringStateChange(f func(ICEGathererState)) {
@@ -273,6 +295,190 @@ func (pc *PeerConnection) onTrack(t *Track, r *RTPReceiver) {
 	}
 }
 
+// OnNegotiationNeeded sets an event handler which is called when a change
+// to the PeerConnection, such as RemoveTrack, requires a new offer/answer
+// exchange to take effect.
+func (pc *PeerConnection) OnNegotiationNeeded(f func()) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.onNegotiationNeededHandler = f
+}
+
+func (pc *PeerConnection) onNegotiationNeeded() {
+	pc.mu.Lock()
+	pc.negotiationNeeded = true
+	hdlr := pc.onNegotiationNeededHandler
+	pc.mu.Unlock()
+
+	if hdlr != nil {
+		go hdlr()
+	}
+}
+
+// clearNegotiationNeeded is called once an answer is applied
+func (pc *PeerConnection) clearNegotiationNeeded() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.negotiationNeeded = false
+}
+
+// OnSSRCCollision sets an event handler which is called for every SSRC of a
+// remote description that is used by more than one remote track, or that is
+// also used by a local Track. Remote tracks with a colliding SSRC can't be
+// told apart and aren't announced via OnTrack.
+func (pc *PeerConnection) OnSSRCCollision(f func(ssrc uint32)) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.onSSRCCollisionHandler = f
+}
+
+// checkSSRCCollisions calls the OnSSRCCollision handler for the colliding SSRCs of a remote description
+func (pc *PeerConnection) checkSSRCCollisions(remote *sdp.SessionDescription) {
+	collisions := ssrcCollisionsFromSDP(remote)
+
+	localSSRCs := map[uint32]bool{}
+	for _, t := range pc.GetTransceivers() {
+		if sender := t.Sender(); sender != nil && sender.Track() != nil {
+			localSSRCs[sender.Track().SSRC()] = true
+		}
+	}
+	for ssrc := range trackDetailsFromSDP(pc.log, remote) {
+		if localSSRCs[ssrc] {
+			collisions = append(collisions, ssrc)
+		}
+	}
+
+	pc.mu.RLock()
+	hdlr := pc.onSSRCCollisionHandler
+	pc.mu.RUnlock()
+
+	for _, ssrc := range collisions {
+		pc.log.Warnf("SSRC %d of the remote description collides", ssrc)
+		if hdlr != nil {
+			go hdlr(ssrc)
+		}
+	}
+}
+
+// OnRTCP sets an event handler which is called with the RTCP packets that
+// nothing else handles, like Goodbye or application-defined packets sent in a
+// compound packet. The ssrc is the SSRC the packets were demultiplexed on.
+//
+// For the SSRC of a started RTPReceiver or RTPSender, the handler is called with
+// it and the packets it doesn't handle itself, e.g. every packet but the Source
+// Description for a RTPReceiver and the feedback it reacts to for a RTPSender.
+// A Goodbye that ends the Track of a RTPReceiver is passed on too. The handler
+// is called with nil for both for RTCP of a SSRC no started RTPReceiver or
+// RTPSender has, with all of its packets. Such a SSRC may still be announced
+// in the remote description, e.g. for a repair flow or a Track that hasn't
+// started, where it can be looked up.
+//
+// RTCP is demultiplexed by the destination SSRCs of the packets in it, so a
+// compound packet for several SSRCs is passed once for each of them.
+func (pc *PeerConnection) OnRTCP(f func(pkts []rtcp.Packet, ssrc uint32, receiver *RTPReceiver, sender *RTPSender)) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.onRTCPHandler = f
+}
+
+func (pc *PeerConnection) onRTCP(pkts []rtcp.Packet, ssrc uint32, receiver *RTPReceiver, sender *RTPSender) {
+	pc.mu.RLock()
+	hdlr := pc.onRTCPHandler
+	pc.mu.RUnlock()
+
+	if hdlr != nil {
+		hdlr(pkts, ssrc, receiver, sender)
+	}
+}
+
+// readUnhandledRTCP reads RTCP from a stream accepted by drainSRTP and dispatches
+// it to the OnRTCP handler until the stream is closed
+func (pc *PeerConnection) readUnhandledRTCP(stream *srtp.ReadStreamSRTCP, ssrc uint32) {
+	pc.mu.Lock()
+	if pc.isClosed.get() {
+		pc.mu.Unlock()
+		if err := stream.Close(); err != nil {
+			pc.log.Warnf("Failed to close RTCP stream for ssrc(%d): %v", ssrc, err)
+		}
+		return
+	}
+	pc.unhandledRTCPStreams = append(pc.unhandledRTCPStreams, stream)
+	pc.mu.Unlock()
+
+	b := make([]byte, receiveMTU)
+	for {
+		i, err := stream.Read(b)
+		if err != nil {
+			return
+		}
+
+		pkts, err := rtcp.Unmarshal(b[:i])
+		if err != nil {
+			pc.log.Warnf("Failed to unmarshal RTCP for ssrc(%d): %v", ssrc, err)
+			continue
+		}
+		pc.api.settingEngine.traceRTCP(false, pkts)
+		pc.onRTCP(pkts, ssrc, nil, nil)
+	}
+}
+
+// InjectRTCP handles RTCP packets as if they had been received from the remote,
+// which allows testing how an application reacts to feedback like PLI, REMB or
+// NACK. Like received RTCP the packets are dispatched by their destination
+// SSRCs to the RTPSenders and RTPReceivers that have been started, RTCP they
+// don't handle and RTCP for other SSRCs is passed to the OnRTCP handler.
+//
+// InjectRTCP is only meant for tests. The injected packets bypass SRTP, so in
+// production they would be indistinguishable from feedback the remote sent.
+func (pc *PeerConnection) InjectRTCP(pkts []rtcp.Packet) error {
+	if pc.isClosed.get() {
+		return &rtcerr.InvalidStateError{Err: ErrConnectionClosed}
+	}
+
+	raw, err := rtcp.Marshal(pkts)
+	if err != nil {
+		return err
+	}
+
+	dispatched := map[uint32]bool{}
+	for _, p := range pkts {
+		for _, ssrc := range p.DestinationSSRC() {
+			if dispatched[ssrc] {
+				continue
+			}
+			dispatched[ssrc] = true
+
+			if handled, err := pc.injectRTCP(raw, ssrc); err != nil {
+				return err
+			} else if !handled {
+				pc.onRTCP(pkts, ssrc, nil, nil)
+			}
+		}
+	}
+	return nil
+}
+
+// injectRTCP passes RTCP to the started RTPSenders and RTPReceivers of the
+// given SSRC, it returns false if there are none
+func (pc *PeerConnection) injectRTCP(raw []byte, ssrc uint32) (bool, error) {
+	handled := false
+	for _, t := range pc.GetTransceivers() {
+		if sender := t.Sender(); sender != nil && sender.hasSent() && sender.Track().SSRC() == ssrc {
+			if err := sender.receiveRTCP(raw, ssrc); err != nil {
+				return handled, err
+			}
+			handled = true
+		}
+		if receiver := t.Receiver(); receiver != nil && receiver.haveReceived() && receiver.Track() != nil && receiver.Track().SSRC() == ssrc {
+			if err := receiver.receiveRTCP(raw, ssrc); err != nil {
+				return handled, err
+			}
+			handled = true
+		}
+	}
+	return handled, nil
+}
+
 // OnICEConnectionStateChange sets an event handler which is called
 // when an ICE connection state is changed.
 func (pc *PeerConnection) OnICEConnectionStateChange(f func(ICEConnectionState)) {
@@ -283,6 +489,7 @@ func (pc *PeerConnection) OnICEConnectionStateChange(f func(ICEConnectionState))
 
 func (pc *PeerConnection) onICEConnectionStateChange(cs ICEConnectionState) {
 	pc.mu.Lock()
+	reconnected := pc.iceConnectionState == ICEConnectionStateDisconnected && cs == ICEConnectionStateConnected
 	pc.iceConnectionState = cs
 	hdlr := pc.onICEConnectionStateChangeHandler
 	pc.mu.Unlock()
@@ -291,6 +498,24 @@ func (pc *PeerConnection) onICEConnectionStateChange(cs ICEConnectionState) {
 	if hdlr != nil {
 		go hdlr(cs)
 	}
+
+	if reconnected && pc.api.settingEngine.keyframeRequestOnReconnect {
+		go pc.requestKeyframes()
+	}
+}
+
+// requestKeyframes sends a Picture Loss Indication for every remote video Track
+func (pc *PeerConnection) requestKeyframes() {
+	for _, t := range pc.GetTransceivers() {
+		receiver := t.Receiver()
+		if receiver == nil {
+			continue
+		}
+
+		if track := receiver.Track(); track != nil && track.Kind() == RTPCodecTypeVideo {
+			receiver.requestKeyframe(track)
+		}
+	}
 }
 
 // OnConnectionStateChange sets an event handler which is called
@@ -302,18 +527,24 @@ func (pc *PeerConnection) OnConnectionStateChange(f func(PeerConnectionState)) {
 }
 
 // SetConfiguration updates the configuration of this PeerConnection object.
+// The configuration is only updated if all of it is valid. An updated
+// ICETransportPolicy and ICEServers, like TURN servers with refreshed
+// credentials, are used the next time candidates are gathered.
 func (pc *PeerConnection) SetConfiguration(configuration Configuration) error {
 	// https://www.w3.org/TR/webrtc/#dom-rtcpeerconnection-setconfiguration (step #2)
 	if pc.isClosed.get() {
 		return &rtcerr.InvalidStateError{Err: ErrConnectionClosed}
 	}
 
+	// Only apply the configuration once all of it has been validated
+	updated := pc.configuration
+
 	// https://www.w3.org/TR/webrtc/#set-the-configuration (step #3)
 	if configuration.PeerIdentity != "" {
 		if configuration.PeerIdentity != pc.configuration.PeerIdentity {
 			return &rtcerr.InvalidModificationError{Err: ErrModifyingPeerIdentity}
 		}
-		pc.configuration.PeerIdentity = configuration.PeerIdentity
+		updated.PeerIdentity = configuration.PeerIdentity
 	}
 
 	// https://www.w3.org/TR/webrtc/#set-the-configuration (step #4)
@@ -327,7 +558,7 @@ func (pc *PeerConnection) SetConfiguration(configuration Configuration) error {
 				return &rtcerr.InvalidModificationError{Err: ErrModifyingCertificates}
 			}
 		}
-		pc.configuration.Certificates = configuration.Certificates
+		updated.Certificates = configuration.Certificates
 	}
 
 	// https://www.w3.org/TR/webrtc/#set-the-configuration (step #5)
@@ -335,7 +566,7 @@ func (pc *PeerConnection) SetConfiguration(configuration Configuration) error {
 		if configuration.BundlePolicy != pc.configuration.BundlePolicy {
 			return &rtcerr.InvalidModificationError{Err: ErrModifyingBundlePolicy}
 		}
-		pc.configuration.BundlePolicy = configuration.BundlePolicy
+		updated.BundlePolicy = configuration.BundlePolicy
 	}
 
 	// https://www.w3.org/TR/webrtc/#set-the-configuration (step #6)
@@ -343,7 +574,7 @@ func (pc *PeerConnection) SetConfiguration(configuration Configuration) error {
 		if configuration.RTCPMuxPolicy != pc.configuration.RTCPMuxPolicy {
 			return &rtcerr.InvalidModificationError{Err: ErrModifyingRTCPMuxPolicy}
 		}
-		pc.configuration.RTCPMuxPolicy = configuration.RTCPMuxPolicy
+		updated.RTCPMuxPolicy = configuration.RTCPMuxPolicy
 	}
 
 	// https://www.w3.org/TR/webrtc/#set-the-configuration (step #7)
@@ -352,12 +583,12 @@ func (pc *PeerConnection) SetConfiguration(configuration Configuration) error {
 			pc.LocalDescription() != nil {
 			return &rtcerr.InvalidModificationError{Err: ErrModifyingICECandidatePoolSize}
 		}
-		pc.configuration.ICECandidatePoolSize = configuration.ICECandidatePoolSize
+		updated.ICECandidatePoolSize = configuration.ICECandidatePoolSize
 	}
 
 	// https://www.w3.org/TR/webrtc/#set-the-configuration (step #8)
 	if configuration.ICETransportPolicy != ICETransportPolicy(Unknown) {
-		pc.configuration.ICETransportPolicy = configuration.ICETransportPolicy
+		updated.ICETransportPolicy = configuration.ICETransportPolicy
 	}
 
 	// https://www.w3.org/TR/webrtc/#set-the-configuration (step #11)
@@ -368,8 +599,16 @@ func (pc *PeerConnection) SetConfiguration(configuration Configuration) error {
 				return err
 			}
 		}
-		pc.configuration.ICEServers = configuration.ICEServers
+		updated.ICEServers = configuration.ICEServers
+
+		// Fresh credentials, e.g. of time-limited TURN servers, are used by future allocations
+		if err := pc.iceGatherer.setICEServers(updated.ICEServers); err != nil {
+			return err
+		}
 	}
+
+	pc.iceGatherer.setGatherPolicy(updated.ICETransportPolicy)
+	pc.configuration = updated
 	return nil
 }
 
@@ -408,21 +647,19 @@ func (pc *PeerConnection) CreateOffer(options *OfferOptions) (SessionDescription
 	if pc.currentRemoteDescription == nil {
 		d, err = pc.generateUnmatchedSDP(useIdentity)
 	} else {
-		d, err = pc.generateMatchedSDP(useIdentity, true /*includeUnmatched */, connectionRoleFromDtlsRole(defaultDtlsRoleOffer))
+		d, err = pc.generateMatchedSDP(useIdentity, true /*includeUnmatched */, false /* rejectDataChannels */, connectionRoleFromDtlsRole(defaultDtlsRoleOffer))
 	}
 	if err != nil {
 		return SessionDescription{}, err
 	}
 
-	sdpBytes, err := d.Marshal()
-	if err != nil {
-		return SessionDescription{}, err
+	if transform := pc.api.settingEngine.sdpTransform; transform != nil {
+		transform(d)
 	}
 
-	desc := SessionDescription{
-		Type:   SDPTypeOffer,
-		SDP:    string(sdpBytes),
-		parsed: d,
+	desc, err := newSessionDescription(SDPTypeOffer, d)
+	if err != nil {
+		return SessionDescription{}, err
 	}
 	pc.lastOffer = desc.SDP
 	return desc, nil
@@ -517,10 +754,9 @@ func (pc *PeerConnection) createICETransport() *ICETransport {
 // CreateAnswer starts the PeerConnection and generates the localDescription
 func (pc *PeerConnection) CreateAnswer(options *AnswerOptions) (SessionDescription, error) {
 	useIdentity := pc.idpLoginURL != nil
+	remoteDescription := pc.RemoteDescription()
 	switch {
-	case options != nil:
-		return SessionDescription{}, fmt.Errorf("TODO handle options")
-	case pc.RemoteDescription() == nil:
+	case remoteDescription == nil:
 		return SessionDescription{}, &rtcerr.InvalidStateError{Err: ErrNoRemoteDescription}
 	case useIdentity:
 		return SessionDescription{}, fmt.Errorf("TODO handle identity provider")
@@ -528,25 +764,36 @@ func (pc *PeerConnection) CreateAnswer(options *AnswerOptions) (SessionDescripti
 		return SessionDescription{}, &rtcerr.InvalidStateError{Err: ErrConnectionClosed}
 	}
 
-	connectionRole := connectionRoleFromDtlsRole(pc.api.settingEngine.answeringDTLSRole)
+	dtlsRole := pc.api.settingEngine.answeringDTLSRole
+	if options != nil && options.DTLSRole != DTLSRole(0) {
+		// An answer must pick a role, and the inverse of the one the remote requested
+		switch remoteRole := dtlsRoleFromRemoteSDP(remoteDescription.parsed); {
+		case options.DTLSRole != DTLSRoleClient && options.DTLSRole != DTLSRoleServer:
+			return SessionDescription{}, &rtcerr.InvalidAccessError{Err: fmt.Errorf("answer DTLSRole must be DTLSRoleClient or DTLSRoleServer")}
+		case remoteRole == options.DTLSRole:
+			return SessionDescription{}, &rtcerr.InvalidAccessError{Err: fmt.Errorf("answer DTLSRole %s conflicts with the role of the remote", options.DTLSRole)}
+		}
+		dtlsRole = options.DTLSRole
+	}
+
+	connectionRole := connectionRoleFromDtlsRole(dtlsRole)
 	if connectionRole == sdp.ConnectionRole(0) {
 		connectionRole = connectionRoleFromDtlsRole(defaultDtlsRoleAnswer)
 	}
 
-	d, err := pc.generateMatchedSDP(useIdentity, false /*includeUnmatched */, connectionRole)
+	rejectDataChannels := options != nil && options.RejectDataChannels
+	d, err := pc.generateMatchedSDP(useIdentity, false /*includeUnmatched */, rejectDataChannels, connectionRole)
 	if err != nil {
 		return SessionDescription{}, err
 	}
 
-	sdpBytes, err := d.Marshal()
-	if err != nil {
-		return SessionDescription{}, err
+	if transform := pc.api.settingEngine.sdpTransform; transform != nil {
+		transform(d)
 	}
 
-	desc := SessionDescription{
-		Type:   SDPTypeAnswer,
-		SDP:    string(sdpBytes),
-		parsed: d,
+	desc, err := newSessionDescription(SDPTypeAnswer, d)
+	if err != nil {
+		return SessionDescription{}, err
 	}
 	pc.lastAnswer = desc.SDP
 	return desc, nil
@@ -685,6 +932,13 @@ func (pc *PeerConnection) SetLocalDescription(desc SessionDescription) error {
 	if err := pc.setDescription(&desc, stateChangeOpSetLocal); err != nil {
 		return err
 	}
+	if desc.Type == SDPTypeAnswer || desc.Type == SDPTypePranswer {
+		pc.setPayloadTypesFromAnswer(desc.parsed)
+	}
+	if desc.Type == SDPTypeAnswer {
+		pc.clearNegotiationNeeded()
+		pc.announceEarlyTracks()
+	}
 
 	// To support all unittests which are following the future trickle=true
 	// setup while also support the old trickle=false synchronous gathering
@@ -721,30 +975,53 @@ func (pc *PeerConnection) SetRemoteDescription(desc SessionDescription) error {
 		return &rtcerr.InvalidStateError{Err: ErrConnectionClosed}
 	}
 
-	currentTransceivers := append([]*RTPTransceiver{}, pc.GetTransceivers()...)
 	haveRemoteDescription := pc.currentRemoteDescription != nil
 
 	desc.parsed = &sdp.SessionDescription{}
 	if err := desc.parsed.Unmarshal([]byte(desc.SDP)); err != nil {
 		return err
 	}
+	var localOffer *sdp.SessionDescription
+	if localDescription := pc.LocalDescription(); localDescription != nil && (desc.Type == SDPTypeAnswer || desc.Type == SDPTypePranswer) {
+		localOffer = localDescription.parsed
+	}
+	fillMissingMids(desc.parsed, localOffer)
+
+	// The ICE role is validated before the description is applied, so an
+	// invalid one leaves the PeerConnection as it was
+	weOffer := desc.Type != SDPTypeOffer
+	var iceRole ICERole
+	if !haveRemoteDescription {
+		var err error
+		if iceRole, err = pc.iceRoleFromRemoteSDP(weOffer, desc.parsed); err != nil {
+			return err
+		}
+	}
+
 	if err := pc.setDescription(&desc, stateChangeOpSetRemote); err != nil {
 		return err
 	}
-
-	if haveRemoteDescription {
-		pc.startRenegotation(currentTransceivers)
-		return nil
+	pc.dtlsTransport.setReducedSizeRTCP(rtcpReducedSizeFromSDP(desc.parsed))
+	pc.checkSSRCCollisions(desc.parsed)
+	if desc.Type == SDPTypeAnswer || desc.Type == SDPTypePranswer {
+		pc.setHeaderExtensionsFromAnswer(desc.parsed)
+		pc.setPayloadTypesFromAnswer(desc.parsed)
+	}
+	if desc.Type == SDPTypeAnswer {
+		pc.clearNegotiationNeeded()
+		pc.stopRejectedTransceivers(desc.parsed)
 	}
 
-	weOffer := true
-	if desc.Type == SDPTypeOffer {
-		weOffer = false
+	if desc.Type == SDPTypeOffer && pc.api.settingEngine.answerRecvonly && !descriptionIsPlanB(&desc) {
+		if err := pc.addRecvonlyTransceivers(desc.parsed); err != nil {
+			return err
+		}
 	}
+	currentTransceivers := append([]*RTPTransceiver{}, pc.GetTransceivers()...)
 
-	remoteIsLite := false
-	if liteValue, haveRemoteIs := desc.parsed.Attribute(sdp.AttrKeyICELite); haveRemoteIs && liteValue == sdp.AttrKeyICELite {
-		remoteIsLite = true
+	if haveRemoteDescription {
+		pc.startRenegotation(currentTransceivers)
+		return nil
 	}
 
 	fingerprint, fingerprintHash, err := extractFingerprint(desc.parsed)
@@ -763,20 +1040,200 @@ func (pc *PeerConnection) SetRemoteDescription(desc SessionDescription) error {
 		}
 	}
 
+	// When answering Tracks can still be added until the answer is created, so the
+	// transceivers are only looked up once the connection is established.
+	if !weOffer {
+		currentTransceivers = nil
+	}
+
+	// Start the networking in a new routine since it will block until
+	// the connection is actually established.
+	pc.startTransports(iceRole, dtlsRoleFromRemoteSDP(desc.parsed), remoteUfrag, remotePwd, fingerprint, fingerprintHash, currentTransceivers, trackDetailsFromSDP(pc.log, desc.parsed))
+	return nil
+}
+
+// iceRoleFromRemoteSDP returns the ICE role of the PeerConnection, the one set
+// with SettingEngine.SetICERole unless it is invalid for the remote description
+func (pc *PeerConnection) iceRoleFromRemoteSDP(weOffer bool, remote *sdp.SessionDescription) (ICERole, error) {
+	remoteIsLite := false
+	if liteValue, haveRemoteIs := remote.Attribute(sdp.AttrKeyICELite); haveRemoteIs && liteValue == sdp.AttrKeyICELite {
+		remoteIsLite = true
+	}
+
 	iceRole := ICERoleControlled
-	// If one of the agents is lite and the other one is not, the lite agent must be the controlling agent.
+	// If one of the agents is lite and the other one is not, the full agent must be the controlling agent.
 	// If both or neither agents are lite the offering agent is controlling.
 	// RFC 8445 S6.1.1
 	if (weOffer && remoteIsLite == pc.api.settingEngine.candidates.ICELite) || (remoteIsLite && !pc.api.settingEngine.candidates.ICELite) {
 		iceRole = ICERoleControlling
 	}
+	if role := pc.api.settingEngine.iceRole; role != ICERole(0) {
+		if remoteIsLite != pc.api.settingEngine.candidates.ICELite && role != iceRole {
+			return iceRole, &rtcerr.InvalidModificationError{Err: fmt.Errorf("ICE role %s is invalid when only one agent is lite", role)}
+		}
+		iceRole = role
+	}
+	return iceRole, nil
+}
+
+// stopRejectedTransceivers stops the RTPTransceivers of the media sections of
+// our offer that the answer rejected with port 0 or left out. The media sections
+// of an answer are matched by their position, as rejected ones may have no mid.
+func (pc *PeerConnection) stopRejectedTransceivers(answer *sdp.SessionDescription) {
+	localDescription := pc.LocalDescription()
+	if localDescription == nil || localDescription.parsed == nil {
+		return
+	}
+
+	for i, media := range localDescription.parsed.MediaDescriptions {
+		midValue := getMidValue(media)
+		if midValue == "" || (i < len(answer.MediaDescriptions) && answer.MediaDescriptions[i].MediaName.Port.Value != 0) {
+			continue
+		}
+
+		for _, t := range pc.GetTransceivers() {
+			if t.getMid() != midValue || t.Direction() == RTPTransceiverDirectionInactive {
+				continue
+			}
+
+			pc.log.Debugf("Media section %s has been rejected by the answer, stopping its RTPTransceiver", midValue)
+			if err := t.Stop(); err != nil {
+				pc.log.Warnf("Failed to stop RTPTransceiver of rejected media section %s: %v", midValue, err)
+			}
+		}
+	}
+}
+
+// setHeaderExtensionsFromAnswer updates the header extensions of the
+// RTPTransceivers in the media sections of our offer
+func (pc *PeerConnection) setHeaderExtensionsFromAnswer(answer *sdp.SessionDescription) {
+	for _, media := range answer.MediaDescriptions {
+		midValue := getMidValue(media)
+		for _, t := range pc.GetTransceivers() {
+			if midValue != "" && t.getMid() == midValue {
+				t.setHeaderExtensions(headerExtensionsFromSDP(media))
+			}
+		}
+	}
+}
+
+// setPayloadTypesFromAnswer updates the negotiated PayloadTypes of the
+// RTPTransceivers in the media sections of an answer, local or remote
+func (pc *PeerConnection) setPayloadTypesFromAnswer(answer *sdp.SessionDescription) {
+	for _, media := range answer.MediaDescriptions {
+		midValue := getMidValue(media)
+		for _, t := range pc.GetTransceivers() {
+			if midValue == "" || t.getMid() != midValue {
+				continue
+			}
+
+			codecs, err := mirrorPayloadTypes(pc.api.mediaEngine.GetCodecsByKind(t.kind), media)
+			if err != nil {
+				pc.log.Warnf("Failed to read the payload types of media section %s: %v", midValue, err)
+				continue
+			}
+
+			payloadTypes := map[uint8]*RTPCodec{}
+			for _, codec := range codecs {
+				payloadTypes[codec.PayloadType] = codec
+			}
+			t.setPayloadTypes(payloadTypes)
+		}
+	}
+}
+
+// addRecvonlyTransceivers adds a recvonly transceiver for every media section
+// of a remote offer that sends media and has no matching local transceiver
+func (pc *PeerConnection) addRecvonlyTransceivers(desc *sdp.SessionDescription) error {
+	var t *RTPTransceiver
+	localTransceivers := append([]*RTPTransceiver{}, pc.GetTransceivers()...)
+	for _, media := range desc.MediaDescriptions {
+		kind := NewRTPCodecType(media.MediaName.Media)
+		direction := getPeerDirection(media)
+		if kind == 0 || (direction != RTPTransceiverDirectionSendrecv && direction != RTPTransceiverDirectionSendonly) {
+			continue
+		}
+
+		if t, localTransceivers = satisfyTypeAndDirection(kind, direction, localTransceivers); t.Direction() != RTPTransceiverDirectionInactive {
+			continue
+		}
+
+		if _, err := pc.AddTransceiverFromKind(kind, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly}); err != nil {
+			return err
+		}
+	}
 
-	// Start the networking in a new routine since it will block until
-	// the connection is actually established.
-	pc.startTransports(iceRole, dtlsRoleFromRemoteSDP(desc.parsed), remoteUfrag, remotePwd, fingerprint, fingerprintHash, currentTransceivers, trackDetailsFromSDP(pc.log, desc.parsed))
 	return nil
 }
 
+// MirrorRemoteOffer configures a RTPTransceiver for every audio and video media
+// section of the remote offer, so the answer that is created next mirrors the
+// offer as a forwarding SFU needs it. The media sections of the answer use the
+// codecs of the offer that are registered in the MediaEngine with the
+// PayloadTypes of the offer, in the order of the offer, accept all offered RTP
+// header extensions with their IDs, and receive the offered simulcast layers
+// with the same restrictions. Existing RTPTransceivers are matched like
+// CreateAnswer does, RTPTransceivers are added to receive the media sections
+// the remote sends without one. Media sections the remote only receives need
+// an existing RTPTransceiver with a Track, they are answered inactive otherwise.
+// The returned RTPTransceivers are in the order of the media sections. Only
+// Unified Plan offers can be mirrored.
+func (pc *PeerConnection) MirrorRemoteOffer() ([]*RTPTransceiver, error) {
+	remoteDescription := pc.RemoteDescription()
+	switch {
+	case pc.isClosed.get():
+		return nil, &rtcerr.InvalidStateError{Err: ErrConnectionClosed}
+	case remoteDescription == nil || remoteDescription.Type != SDPTypeOffer:
+		return nil, &rtcerr.InvalidStateError{Err: fmt.Errorf("MirrorRemoteOffer requires a remote offer")}
+	case descriptionIsPlanB(remoteDescription):
+		return nil, &rtcerr.TypeError{Err: ErrIncorrectSDPSemantics}
+	}
+
+	mirrored := []*RTPTransceiver{}
+	localTransceivers := append([]*RTPTransceiver{}, pc.GetTransceivers()...)
+	for _, media := range remoteDescription.parsed.MediaDescriptions {
+		kind := NewRTPCodecType(media.MediaName.Media)
+		direction := getPeerDirection(media)
+		midValue := getMidValue(media)
+		if kind == 0 || direction == RTPTransceiverDirection(Unknown) || media.MediaName.Port.Value == 0 {
+			continue
+		}
+
+		var t *RTPTransceiver
+		if t, localTransceivers = findByMid(midValue, kind, localTransceivers); t == nil {
+			t, localTransceivers = satisfyTypeAndDirection(kind, direction, localTransceivers)
+		}
+		if t.Direction() == RTPTransceiverDirectionInactive {
+			if direction != RTPTransceiverDirectionSendrecv && direction != RTPTransceiverDirectionSendonly {
+				continue
+			}
+
+			var err error
+			if t, err = pc.AddTransceiverFromKind(kind, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly}); err != nil {
+				return nil, err
+			}
+		}
+
+		// The layers the remote sends are received
+		rids := []RIDParameters{}
+		if _, simulcast := media.Attribute("simulcast"); simulcast {
+			for _, rid := range ridsFromSDP(pc.log, media) {
+				if rid.Direction == "send" {
+					rids = append(rids, rid)
+				}
+			}
+		}
+		if err := t.SetSimulcastReceive(rids); err != nil {
+			return nil, err
+		}
+
+		t.setMid(midValue)
+		t.mirrorRemote.set(true)
+		mirrored = append(mirrored, t)
+	}
+	return mirrored, nil
+}
+
 func (pc *PeerConnection) startReceiver(incoming trackDetails, receiver *RTPReceiver) {
 	err := receiver.Receive(RTPReceiveParameters{
 		Encodings: RTPDecodingParameters{
@@ -792,39 +1249,72 @@ func (pc *PeerConnection) startReceiver(incoming trackDetails, receiver *RTPRece
 	receiver.Track().mu.Lock()
 	receiver.Track().id = incoming.id
 	receiver.Track().label = incoming.label
+	receiver.Track().frameMarkingID = incoming.frameMarkingID
+	receiver.Track().rtxSSRC = incoming.rtxSSRC
+	receiver.Track().simulcast = incoming.simulcast
 	receiver.Track().mu.Unlock()
 
+	receiver.mu.Lock()
+	receiver.rids = incoming.rids
+	receiver.mu.Unlock()
+
 	go func() {
 		if err = receiver.Track().determinePayloadType(); err != nil {
 			pc.log.Warnf("Could not determine PayloadType for SSRC %d", receiver.Track().SSRC())
 			return
 		}
 
-		pc.mu.RLock()
-		defer pc.mu.RUnlock()
-
+		pc.mu.Lock()
 		if pc.currentLocalDescription == nil {
-			pc.log.Warnf("SetLocalDescription not called, unable to handle incoming media streams")
+			pc.log.Debugf("SetLocalDescription not called, OnTrack for SSRC %d is delayed until it is", receiver.Track().SSRC())
+			pc.earlyReceivers = append(pc.earlyReceivers, receiver)
+			pc.mu.Unlock()
 			return
 		}
+		pc.mu.Unlock()
 
-		codec, err := pc.api.mediaEngine.getCodec(receiver.Track().PayloadType())
-		if err != nil {
-			pc.log.Warnf("no codec could be found for payloadType %d", receiver.Track().PayloadType())
-			return
-		}
+		pc.announceTrack(receiver)
+	}()
+}
 
-		receiver.Track().mu.Lock()
-		receiver.Track().kind = codec.Type
-		receiver.Track().codec = codec
-		receiver.Track().mu.Unlock()
+// announceTrack fires OnTrack for a receiver once the PayloadType of its Track is known
+func (pc *PeerConnection) announceTrack(receiver *RTPReceiver) {
+	codec, err := receiver.getCodec(receiver.Track().PayloadType())
+	if err != nil {
+		pc.log.Warnf("no codec could be found for payloadType %d", receiver.Track().PayloadType())
+		return
+	}
 
-		if pc.onTrackHandler != nil {
-			pc.onTrack(receiver.Track(), receiver)
-		} else {
-			pc.log.Warnf("OnTrack unset, unable to handle incoming media streams")
-		}
-	}()
+	receiver.Track().mu.Lock()
+	receiver.Track().kind = codec.Type
+	receiver.Track().codec = codec
+	receiver.Track().mu.Unlock()
+
+	pc.mu.RLock()
+	hdlr := pc.onTrackHandler
+	pc.mu.RUnlock()
+	if hdlr != nil {
+		pc.onTrack(receiver.Track(), receiver)
+	} else {
+		pc.log.Warnf("OnTrack unset, unable to handle incoming media streams")
+	}
+}
+
+// announceEarlyTracks fires OnTrack for the receivers that have received media
+// before the local description was applied
+func (pc *PeerConnection) announceEarlyTracks() {
+	pc.mu.Lock()
+	if pc.currentLocalDescription == nil {
+		pc.mu.Unlock()
+		return
+	}
+	earlyReceivers := pc.earlyReceivers
+	pc.earlyReceivers = nil
+	pc.mu.Unlock()
+
+	for _, receiver := range earlyReceivers {
+		pc.announceTrack(receiver)
+	}
 }
 
 // startRTPReceivers opens knows inbound SRTP streams from the RemoteDescription
@@ -882,17 +1372,20 @@ func (pc *PeerConnection) startRTPReceivers(incomingTracks map[uint32]trackDetai
 	}
 }
 
-// startRTPSenders starts all outbound RTP streams
+// startRTPSenders starts all outbound RTP streams the remote receives
 func (pc *PeerConnection) startRTPSenders(currentTransceivers []*RTPTransceiver) {
 	for _, tranceiver := range currentTransceivers {
-		if tranceiver.Sender() != nil && !tranceiver.Sender().hasSent() {
+		if tranceiver.Sender() != nil && !tranceiver.Sender().hasSent() && pc.remoteReceives(tranceiver.getMid()) {
 			err := tranceiver.Sender().Send(RTPSendParameters{
 				Encodings: RTPEncodingParameters{
-					RTPCodingParameters{
+					RTPCodingParameters: RTPCodingParameters{
 						SSRC:        tranceiver.Sender().track.SSRC(),
 						PayloadType: tranceiver.Sender().track.PayloadType(),
 					},
-				}})
+				},
+				HeaderExtensions: pc.sendHeaderExtensions(tranceiver),
+				RTCPFeedback:     pc.sendRTCPFeedback(tranceiver),
+			})
 			if err != nil {
 				pc.log.Warnf("Failed to start Sender: %s", err)
 			}
@@ -900,11 +1393,65 @@ func (pc *PeerConnection) startRTPSenders(currentTransceivers []*RTPTransceiver)
 	}
 }
 
+// rtxPrimarySSRC returns the SSRC of the remote track the RTX repair flow with
+// the given SSRC belongs to, as grouped by a=ssrc-group:FID
+func (pc *PeerConnection) rtxPrimarySSRC(rtxSSRC uint32) (uint32, bool) {
+	remoteDescription := pc.RemoteDescription()
+	if remoteDescription == nil {
+		return 0, false
+	}
+
+	for ssrc, incoming := range trackDetailsFromSDP(pc.log, remoteDescription.parsed) {
+		if incoming.rtxSSRC == rtxSSRC {
+			return ssrc, true
+		}
+	}
+	return 0, false
+}
+
+// remoteReceives returns false if the remote description has no media section
+// with the given mid, or the remote doesn't receive on it because it is
+// inactive or sendonly
+func (pc *PeerConnection) remoteReceives(mid string) bool {
+	remoteDescription := pc.RemoteDescription()
+	if mid == "" || remoteDescription == nil {
+		return false
+	}
+
+	for _, media := range remoteDescription.parsed.MediaDescriptions {
+		if getMidValue(media) != mid {
+			continue
+		} else if media.MediaName.Port.Value == 0 {
+			return false
+		}
+
+		switch getPeerDirection(media) {
+		case RTPTransceiverDirectionInactive, RTPTransceiverDirectionSendonly:
+			return false
+		}
+		return true
+	}
+	return false
+}
+
 // Start SCTP subsystem
 func (pc *PeerConnection) startSCTP() {
 	// Start sctp
+	remoteMaxMessageSize := uint32(defaultMaxMessageSize)
+	if remoteDescription := pc.RemoteDescription(); remoteDescription != nil && remoteDescription.parsed != nil {
+		remoteMaxMessageSize = maxMessageSizeFromSDP(remoteDescription.parsed)
+		if dataChannelsRejected(remoteDescription.parsed) {
+			pc.log.Debug("DataChannels have been rejected by the remote, not starting SCTP")
+			return
+		}
+	}
+	if localDescription := pc.CurrentLocalDescription(); localDescription != nil && localDescription.parsed != nil && dataChannelsRejected(localDescription.parsed) {
+		pc.log.Debug("DataChannels have been rejected, not starting SCTP")
+		return
+	}
+
 	if err := pc.sctpTransport.Start(SCTPCapabilities{
-		MaxMessageSize: 0,
+		MaxMessageSize: remoteMaxMessageSize,
 	}); err != nil {
 		pc.log.Warnf("Failed to start SCTP: %s", err)
 		if err = pc.sctpTransport.Stop(); err != nil {
@@ -957,6 +1504,9 @@ func (pc *PeerConnection) drainSRTP() {
 				if onlyMediaSection.MediaName.Media == RTPCodecTypeAudio.String() {
 					incoming.kind = RTPCodecTypeAudio
 				}
+				// Layers that are identified by a=rid instead of a=ssrc arrive undeclared
+				_, incoming.simulcast = onlyMediaSection.Attribute("simulcast")
+				incoming.rids = ridsFromSDP(pc.log, onlyMediaSection)
 
 				t, err := pc.AddTransceiverFromKind(incoming.kind, RtpTransceiverInit{
 					Direction: RTPTransceiverDirectionSendrecv,
@@ -987,7 +1537,9 @@ func (pc *PeerConnection) drainSRTP() {
 				return
 			}
 
-			if !handleUndeclaredSSRC(ssrc) {
+			if primary, ok := pc.rtxPrimarySSRC(ssrc); ok {
+				pc.log.Debugf("Incoming RTP ssrc(%d) is the RTX repair flow of ssrc(%d)", ssrc, primary)
+			} else if !handleUndeclaredSSRC(ssrc) {
 				pc.log.Warnf("Incoming unhandled RTP ssrc(%d), OnTrack will not be fired", ssrc)
 			}
 		}
@@ -1001,12 +1553,13 @@ func (pc *PeerConnection) drainSRTP() {
 				return
 			}
 
-			_, ssrc, err := srtcpSession.AcceptStream()
+			stream, ssrc, err := srtcpSession.AcceptStream()
 			if err != nil {
 				pc.log.Warnf("Failed to accept RTCP %v", err)
 				return
 			}
-			pc.log.Warnf("Incoming unhandled RTCP ssrc(%d), OnTrack will not be fired", ssrc)
+			pc.log.Debugf("Incoming unhandled RTCP ssrc(%d), dispatching to OnRTCP", ssrc)
+			go pc.readUnhandledRTCP(stream, ssrc)
 		}
 	}()
 }
@@ -1025,6 +1578,31 @@ func (pc *PeerConnection) RemoteDescription() *SessionDescription {
 	return pc.currentRemoteDescription
 }
 
+// RemoteFingerprints returns the DTLS certificate fingerprints the remote announced
+// in the RemoteDescription
+func (pc *PeerConnection) RemoteFingerprints() ([]DTLSFingerprint, error) {
+	desc := pc.RemoteDescription()
+	if desc == nil || desc.parsed == nil {
+		return nil, &rtcerr.InvalidStateError{Err: ErrNoRemoteDescription}
+	}
+
+	fingerprint, fingerprintHash, err := extractFingerprint(desc.parsed)
+	if err != nil {
+		return nil, err
+	}
+	return []DTLSFingerprint{{Algorithm: fingerprintHash, Value: strings.ToLower(fingerprint)}}, nil
+}
+
+// RemoteICEOptions returns the ICE options, like "trickle", the remote announced
+// with a=ice-options in the RemoteDescription, or nil if it announced none.
+func (pc *PeerConnection) RemoteICEOptions() []string {
+	desc := pc.RemoteDescription()
+	if desc == nil || desc.parsed == nil {
+		return nil
+	}
+	return extractICEOptions(desc.parsed)
+}
+
 // AddICECandidate accepts an ICE candidate string and adds it
 // to the existing set of candidates
 func (pc *PeerConnection) AddICECandidate(candidate ICECandidateInit) error {
@@ -1047,6 +1625,13 @@ func (pc *PeerConnection) AddICECandidate(candidate ICECandidateInit) error {
 	return pc.iceTransport.AddRemoteCandidate(iceCandidate)
 }
 
+// ICERole returns the role the ICE agent of the PeerConnection plays in
+// nominating the candidate pair. It is zero until the ICE transport has been
+// started by setting the remote description.
+func (pc *PeerConnection) ICERole() ICERole {
+	return pc.iceTransport.Role()
+}
+
 // ICEConnectionState returns the ICE connection state of the
 // PeerConnection instance.
 func (pc *PeerConnection) ICEConnectionState() ICEConnectionState {
@@ -1084,6 +1669,11 @@ func (pc *PeerConnection) GetReceivers() []*RTPReceiver {
 	return result
 }
 
+// SCTP returns the SCTPTransport the DataChannels of the PeerConnection are sent over
+func (pc *PeerConnection) SCTP() *SCTPTransport {
+	return pc.sctpTransport
+}
+
 // GetTransceivers returns the RTCRtpTransceiver that are currently attached to this RTCPeerConnection
 func (pc *PeerConnection) GetTransceivers() []*RTPTransceiver {
 	pc.mu.Lock()
@@ -1093,11 +1683,34 @@ func (pc *PeerConnection) GetTransceivers() []*RTPTransceiver {
 }
 
 // AddTrack adds a Track to the PeerConnection
+//
+// The Track is added to the first transceiver of the same kind that isn't sending
+// yet, otherwise a new sendrecv transceiver is created. When answering, AddTrack
+// can be called between SetRemoteDescription and CreateAnswer. A recvonly
+// transceiver of the same kind then becomes sendrecv, and a new transceiver is
+// matched by CreateAnswer with the first offered media section of the same kind
+// that no other transceiver has been matched with. Adding a Track the
+// PeerConnection already sends, a Track with the SSRC of one it sends, or a
+// remote Track, is an InvalidAccessError.
 func (pc *PeerConnection) AddTrack(track *Track) (*RTPSender, error) {
 	if pc.isClosed.get() {
 		return nil, &rtcerr.InvalidStateError{Err: ErrConnectionClosed}
 	}
 
+	track.mu.RLock()
+	isRemote := track.receiver != nil
+	track.mu.RUnlock()
+	if isRemote {
+		return nil, &rtcerr.InvalidAccessError{Err: ErrRemoteTrack}
+	}
+
+	switch existing := pc.sendingTrackWithSSRC(track.SSRC()); {
+	case existing == track:
+		return nil, &rtcerr.InvalidAccessError{Err: ErrExistingTrack}
+	case existing != nil:
+		return nil, &rtcerr.InvalidAccessError{Err: ErrSSRCInUse}
+	}
+
 	var transceiver *RTPTransceiver
 	for _, t := range pc.GetTransceivers() {
 		if !t.stopped && t.kind == track.Kind() && t.Sender() == nil {
@@ -1132,7 +1745,10 @@ func (pc *PeerConnection) AddTransceiver(trackOrKind RTPCodecType, init ...RtpTr
 	return pc.AddTransceiverFromKind(trackOrKind, init...)
 }
 
-// RemoveTrack removes a Track from the PeerConnection
+// RemoveTrack removes a Track from the PeerConnection. The track is detached
+// from the sender, the direction of its transceiver changes from sendrecv to
+// recvonly (or from sendonly to inactive) and OnNegotiationNeeded fires so the
+// change can be signaled with a new offer.
 func (pc *PeerConnection) RemoveTrack(sender *RTPSender) error {
 	if pc.isClosed.get() {
 		return &rtcerr.InvalidStateError{Err: ErrConnectionClosed}
@@ -1152,7 +1768,12 @@ func (pc *PeerConnection) RemoveTrack(sender *RTPSender) error {
 		return err
 	}
 
-	return transceiver.setSendingTrack(nil)
+	if err := transceiver.setSendingTrack(nil); err != nil {
+		return err
+	}
+
+	pc.onNegotiationNeeded()
+	return nil
 }
 
 // AddTransceiverFromKind Create a new RTCRtpTransceiver(SendRecv or RecvOnly) and add it to the set of transceivers.
@@ -1175,7 +1796,8 @@ func (pc *PeerConnection) AddTransceiverFromKind(kind RTPCodecType, init ...RtpT
 			return nil, fmt.Errorf("no %s codecs found", kind.String())
 		}
 
-		track, err := pc.NewTrack(codecs[0].PayloadType, mathRand.Uint32(), util.RandSeq(trackDefaultIDLength), util.RandSeq(trackDefaultLabelLength))
+		s := pc.api.settingEngine
+		track, err := pc.NewTrack(codecs[0].PayloadType, s.randUint32(), s.randSeq(trackDefaultIDLength), s.randSeq(trackDefaultLabelLength))
 		if err != nil {
 			return nil, err
 		}
@@ -1262,9 +1884,14 @@ func (pc *PeerConnection) CreateDataChannel(label string, options *DataChannelIn
 		Ordered: true,
 	}
 
+	maxChannels := pc.sctpTransport.MaxChannels()
+
 	// https://w3c.github.io/webrtc-pc/#peer-to-peer-data-api (Step #19)
 	if options != nil {
 		params.ID = options.ID
+		if params.ID != nil && *params.ID >= maxChannels {
+			return nil, &rtcerr.OperationError{Err: ErrMaxDataChannelID}
+		}
 	}
 
 	if options != nil {
@@ -1312,6 +1939,16 @@ func (pc *PeerConnection) CreateDataChannel(label string, options *DataChannelIn
 	}
 
 	pc.sctpTransport.lock.Lock()
+	open := 0
+	for _, dc := range pc.sctpTransport.dataChannels {
+		if dc.ReadyState() != DataChannelStateClosed {
+			open++
+		}
+	}
+	if open >= int(maxChannels) {
+		pc.sctpTransport.lock.Unlock()
+		return nil, &rtcerr.OperationError{Err: ErrMaxDataChannels}
+	}
 	pc.sctpTransport.dataChannels = append(pc.sctpTransport.dataChannels, d)
 	pc.sctpTransport.dataChannelsRequested++
 	pc.sctpTransport.lock.Unlock()
@@ -1332,27 +1969,11 @@ func (pc *PeerConnection) SetIdentityProvider(provider string) error {
 }
 
 // WriteRTCP sends a user provided RTCP packet to the connected peer
-// If no peer is connected the packet is discarded
+// If no peer is connected the packet is discarded. The packets are sent
+// reduced-size if the remote negotiated a=rtcp-rsize, otherwise an empty
+// Receiver Report is put in front of them unless they start with a report.
 func (pc *PeerConnection) WriteRTCP(pkts []rtcp.Packet) error {
-	raw, err := rtcp.Marshal(pkts)
-	if err != nil {
-		return err
-	}
-
-	srtcpSession, err := pc.dtlsTransport.getSRTCPSession()
-	if err != nil {
-		return nil
-	}
-
-	writeStream, err := srtcpSession.OpenWriteStream()
-	if err != nil {
-		return fmt.Errorf("WriteRTCP failed to open WriteStream: %v", err)
-	}
-
-	if _, err := writeStream.Write(raw); err != nil {
-		return err
-	}
-	return nil
+	return pc.dtlsTransport.writeRTCP(pkts)
 }
 
 // Close ends the PeerConnection
@@ -1383,6 +2004,15 @@ func (pc *PeerConnection) Close() error {
 		}
 	}
 
+	pc.mu.Lock()
+	for _, s := range pc.unhandledRTCPStreams {
+		if err := s.Close(); err != nil {
+			closeErrs = append(closeErrs, err)
+		}
+	}
+	pc.unhandledRTCPStreams = nil
+	pc.mu.Unlock()
+
 	// https://www.w3.org/TR/webrtc/#dom-rtcpeerconnection-close (step #6)
 	if pc.sctpTransport != nil {
 		pc.sctpTransport.lock.Lock()
@@ -1417,16 +2047,59 @@ func (pc *PeerConnection) Close() error {
 	return util.FlattenErrs(closeErrs)
 }
 
-// NewTrack Creates a new Track
+// NewTrack Creates a new Track. The payloadType must be registered in the
+// MediaEngine of the API the PeerConnection was created with, the Track uses
+// the codec registered for it. The SSRC is up to the caller, usually random,
+// but it may be deterministic. ErrSSRCInUse is returned if a Track this
+// PeerConnection sends has the same SSRC. Tracks that haven't been added yet
+// aren't known to the PeerConnection, AddTrack checks the SSRC again.
 func (pc *PeerConnection) NewTrack(payloadType uint8, ssrc uint32, id, label string) (*Track, error) {
-	codec, err := pc.api.mediaEngine.getCodec(payloadType)
+	codec, err := pc.getTrackCodec(payloadType, ssrc)
 	if err != nil {
 		return nil, err
+	}
+
+	return newTrack(payloadType, ssrc, id, label, codec, codec.ClockRate, pc.api.settingEngine.newSequencer())
+}
+
+// NewTrackWithClockRate creates a new Track like NewTrack, but uses the given
+// RTP clock rate instead of the one of the codec
+func (pc *PeerConnection) NewTrackWithClockRate(payloadType uint8, ssrc uint32, id, label string, clockRate uint32) (*Track, error) {
+	codec, err := pc.getTrackCodec(payloadType, ssrc)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTrack(payloadType, ssrc, id, label, codec, clockRate, pc.api.settingEngine.newSequencer())
+}
+
+// getTrackCodec returns the codec registered in the MediaEngine a new Track with
+// the given PayloadType sends, and checks that the SSRC of the Track is unused
+func (pc *PeerConnection) getTrackCodec(payloadType uint8, ssrc uint32) (*RTPCodec, error) {
+	if pc.sendingTrackWithSSRC(ssrc) != nil {
+		return nil, ErrSSRCInUse
+	}
+
+	codec, err := pc.api.mediaEngine.getCodec(payloadType)
+	if err == ErrCodecNotFound {
+		return nil, ErrUnregisteredPayloadType
+	} else if err != nil {
+		return nil, err
 	} else if codec.Payloader == nil {
 		return nil, fmt.Errorf("codec payloader not set")
 	}
 
-	return NewTrack(payloadType, ssrc, id, label, codec)
+	return codec, nil
+}
+
+// sendingTrackWithSSRC returns the Track with the given SSRC one of the RTPSenders sends
+func (pc *PeerConnection) sendingTrackWithSSRC(ssrc uint32) *Track {
+	for _, t := range pc.GetTransceivers() {
+		if sender := t.Sender(); sender != nil && sender.Track() != nil && sender.Track().SSRC() == ssrc {
+			return sender.Track()
+		}
+	}
+	return nil
 }
 
 func (pc *PeerConnection) newRTPTransceiver(
@@ -1435,7 +2108,7 @@ func (pc *PeerConnection) newRTPTransceiver(
 	direction RTPTransceiverDirection,
 	kind RTPCodecType,
 ) *RTPTransceiver {
-	t := &RTPTransceiver{kind: kind}
+	t := &RTPTransceiver{kind: kind, mediaEngine: pc.api.mediaEngine, onNegotiationNeeded: pc.onNegotiationNeeded}
 	t.setReceiver(receiver)
 	t.setSender(sender)
 	t.setDirection(direction)
@@ -1479,6 +2152,47 @@ func (pc *PeerConnection) PendingRemoteDescription() *SessionDescription {
 	return pc.pendingRemoteDescription
 }
 
+// LocalDescriptionParsed returns the parsed form of LocalDescription, or nil
+// if there is none. It is a copy the caller may modify, the SDP isn't parsed
+// again.
+func (pc *PeerConnection) LocalDescriptionParsed() *sdp.SessionDescription {
+	return pc.LocalDescription().parsedCopy()
+}
+
+// RemoteDescriptionParsed returns the parsed form of RemoteDescription, or nil
+// if there is none. It is a copy the caller may modify.
+func (pc *PeerConnection) RemoteDescriptionParsed() *sdp.SessionDescription {
+	return pc.RemoteDescription().parsedCopy()
+}
+
+// CurrentLocalDescriptionParsed returns the parsed form of
+// CurrentLocalDescription, or nil if there is none. It is a copy the caller
+// may modify.
+func (pc *PeerConnection) CurrentLocalDescriptionParsed() *sdp.SessionDescription {
+	return pc.CurrentLocalDescription().parsedCopy()
+}
+
+// PendingLocalDescriptionParsed returns the parsed form of
+// PendingLocalDescription, or nil if there is none. It is a copy the caller
+// may modify.
+func (pc *PeerConnection) PendingLocalDescriptionParsed() *sdp.SessionDescription {
+	return pc.PendingLocalDescription().parsedCopy()
+}
+
+// CurrentRemoteDescriptionParsed returns the parsed form of
+// CurrentRemoteDescription, or nil if there is none. It is a copy the caller
+// may modify.
+func (pc *PeerConnection) CurrentRemoteDescriptionParsed() *sdp.SessionDescription {
+	return pc.CurrentRemoteDescription().parsedCopy()
+}
+
+// PendingRemoteDescriptionParsed returns the parsed form of
+// PendingRemoteDescription, or nil if there is none. It is a copy the caller
+// may modify.
+func (pc *PeerConnection) PendingRemoteDescriptionParsed() *sdp.SessionDescription {
+	return pc.PendingRemoteDescription().parsedCopy()
+}
+
 // SignalingState attribute returns the signaling state of the
 // PeerConnection instance.
 func (pc *PeerConnection) SignalingState() SignalingState {
@@ -1549,6 +2263,12 @@ func (pc *PeerConnection) GetStats() StatsReport {
 		pc.sctpTransport.collectStats(statsCollector)
 	}
 
+	for _, t := range pc.rtpTransceivers {
+		if sender := t.Sender(); sender != nil && sender.hasSent() {
+			sender.collectStats(statsCollector)
+		}
+	}
+
 	stats := PeerConnectionStats{
 		Timestamp:             statsTimestampNow(),
 		Type:                  StatsTypePeerConnection,
@@ -1586,6 +2306,21 @@ func (pc *PeerConnection) startTransports(iceRole ICERole, dtlsRole DTLSRole, re
 			return
 		}
 
+		// When the remote left the role open it takes the inverse of the one in our answer
+		if dtlsRole == DTLSRoleAuto {
+			pc.mu.RLock()
+			localDescription := pc.currentLocalDescription
+			pc.mu.RUnlock()
+			if localDescription != nil {
+				switch dtlsRoleFromRemoteSDP(localDescription.parsed) {
+				case DTLSRoleClient:
+					dtlsRole = DTLSRoleServer
+				case DTLSRoleServer:
+					dtlsRole = DTLSRoleClient
+				}
+			}
+		}
+
 		// Start the dtls transport
 		err = pc.dtlsTransport.Start(DTLSParameters{
 			Role:         dtlsRole,
@@ -1597,6 +2332,10 @@ func (pc *PeerConnection) startTransports(iceRole ICERole, dtlsRole DTLSRole, re
 			return
 		}
 
+		if currentTransceivers == nil {
+			currentTransceivers = append([]*RTPTransceiver{}, pc.GetTransceivers()...)
+		}
+
 		pc.startRTPReceivers(incomingTracks, currentTransceivers)
 		pc.startRTPSenders(currentTransceivers)
 		pc.drainSRTP()
@@ -1684,26 +2423,133 @@ func (pc *PeerConnection) generateUnmatchedSDP(useIdentity bool) (*sdp.SessionDe
 		}
 
 		if len(video) > 1 {
-			mediaSections = append(mediaSections, mediaSection{id: "video", transceivers: video})
+			for _, t := range video {
+				t.setMid("video")
+			}
+			mediaSections = append(mediaSections, mediaSection{id: "video", transceivers: video, headerExtensions: pc.headerExtensions(RTPCodecTypeVideo, nil)})
 		}
 		if len(audio) > 1 {
-			mediaSections = append(mediaSections, mediaSection{id: "audio", transceivers: audio})
+			for _, t := range audio {
+				t.setMid("audio")
+			}
+			mediaSections = append(mediaSections, mediaSection{id: "audio", transceivers: audio, headerExtensions: pc.headerExtensions(RTPCodecTypeAudio, nil)})
 		}
 		mediaSections = append(mediaSections, mediaSection{id: "data", data: true})
 	} else {
 		for _, t := range pc.GetTransceivers() {
-			mediaSections = append(mediaSections, mediaSection{id: strconv.Itoa(len(mediaSections)), transceivers: []*RTPTransceiver{t}})
+			t.setMid(strconv.Itoa(len(mediaSections)))
+			mediaSections = append(mediaSections, mediaSection{id: t.getMid(), transceivers: []*RTPTransceiver{t}, headerExtensions: pc.transceiverHeaderExtensions(t, nil)})
 		}
 
 		mediaSections = append(mediaSections, mediaSection{id: strconv.Itoa(len(mediaSections)), data: true})
 	}
 
-	return populateSDP(d, isPlanB, pc.api.settingEngine.candidates.ICELite, pc.api.mediaEngine, connectionRoleFromDtlsRole(defaultDtlsRoleOffer), candidates, iceParams, mediaSections, pc.ICEGatheringState())
+	return populateSDP(d, isPlanB, pc.api.settingEngine.candidates.ICELite, pc.api.settingEngine.candidates.ICEOptions, pc.api.mediaEngine, connectionRoleFromDtlsRole(defaultDtlsRoleOffer), candidates, iceParams, mediaSections, pc.ICEGatheringState())
+}
+
+// headerExtensions returns the RTP header extensions of a media section of the
+// given kind. When answering the remote media section only the extensions it
+// offered are included, with its IDs.
+func (pc *PeerConnection) headerExtensions(kind RTPCodecType, remoteMedia *sdp.MediaDescription) []RTPHeaderExtensionParameters {
+	headerExtensions := []RTPHeaderExtensionParameters{}
+	for _, headerExtension := range pc.api.mediaEngine.getHeaderExtensionsByKind(kind) {
+		if remoteMedia != nil {
+			id := headerExtensionIDFromSDP(remoteMedia, headerExtension.URI)
+			if id == 0 {
+				continue
+			}
+			headerExtension.ID = int(id)
+		}
+		headerExtensions = append(headerExtensions, headerExtension)
+	}
+	return headerExtensions
+}
+
+// transceiverHeaderExtensions returns the RTP header extensions of the media
+// section of a RTPTransceiver. The RID header extension is added for one that
+// receives simulcast, unless the remote media section doesn't include it.
+func (pc *PeerConnection) transceiverHeaderExtensions(t *RTPTransceiver, remoteMedia *sdp.MediaDescription) []RTPHeaderExtensionParameters {
+	headerExtensions := pc.headerExtensions(t.kind, remoteMedia)
+	if len(t.getSimulcastReceive()) == 0 {
+		return headerExtensions
+	}
+
+	used := map[int]bool{sdp.ExtMapValueTransportCC: true}
+	for _, headerExtension := range headerExtensions {
+		if headerExtension.URI == SDESRTPStreamIDURI {
+			return headerExtensions
+		}
+		used[headerExtension.ID] = true
+	}
+
+	id := 0
+	if remoteMedia != nil {
+		id = int(headerExtensionIDFromSDP(remoteMedia, SDESRTPStreamIDURI))
+	} else {
+		for free := 1; free < 15; free++ {
+			if !used[free] {
+				id = free
+				break
+			}
+		}
+	}
+	if id == 0 {
+		return headerExtensions
+	}
+	return append(headerExtensions, RTPHeaderExtensionParameters{URI: SDESRTPStreamIDURI, ID: id})
+}
+
+// sendHeaderExtensions returns the negotiated RTP header extensions a
+// RTPTransceiver adds to the packets it sends
+func (pc *PeerConnection) sendHeaderExtensions(t *RTPTransceiver) []RTPHeaderExtensionParameters {
+	headerExtensions := []RTPHeaderExtensionParameters{}
+	for _, enabled := range pc.api.mediaEngine.getHeaderExtensionsByKind(t.kind) {
+		for _, headerExtension := range t.HeaderExtensions() {
+			if headerExtension.URI == enabled.URI {
+				headerExtensions = append(headerExtensions, headerExtension)
+			}
+		}
+	}
+	return headerExtensions
+}
+
+// sendRTCPFeedback returns the RTCP feedback the remote description has for
+// the payload type the RTPSender of the RTPTransceiver sends with
+func (pc *PeerConnection) sendRTCPFeedback(t *RTPTransceiver) []RTCPFeedback {
+	feedback := []RTCPFeedback{}
+	remoteDescription := pc.RemoteDescription()
+	if remoteDescription == nil || remoteDescription.parsed == nil {
+		return feedback
+	}
+
+	for _, media := range remoteDescription.parsed.MediaDescriptions {
+		if getMidValue(media) != t.getMid() {
+			continue
+		}
+
+		// Only look up the codec in this media section
+		mediaDescription := &sdp.SessionDescription{MediaDescriptions: []*sdp.MediaDescription{media}}
+		codec, err := mediaDescription.GetCodecForPayloadType(t.Sender().Track().PayloadType())
+		if err != nil {
+			return feedback
+		}
+		for _, rtcpFeedback := range codec.RTCPFeedback {
+			split := strings.SplitN(rtcpFeedback, " ", 2)
+			if len(split) == 2 {
+				feedback = append(feedback, RTCPFeedback{Type: split[0], Parameter: split[1]})
+			} else {
+				feedback = append(feedback, RTCPFeedback{Type: split[0]})
+			}
+		}
+		break
+	}
+	return feedback
 }
 
 // generateMatchedSDP generates a SDP and takes the remote state into account
-// this is used everytime we have a RemoteDescription
-func (pc *PeerConnection) generateMatchedSDP(useIdentity bool, includeUnmatched bool, connectionRole sdp.ConnectionRole) (*sdp.SessionDescription, error) {
+// this is used everytime we have a RemoteDescription. An application media
+// section stays rejected once it has been, or if rejectDataChannels is set.
+func (pc *PeerConnection) generateMatchedSDP(useIdentity bool, includeUnmatched bool, rejectDataChannels bool, connectionRole sdp.ConnectionRole) (*sdp.SessionDescription, error) {
 	d := sdp.NewJSEPSessionDescription(useIdentity)
 	if err := addFingerprints(d, pc.configuration.Certificates[0]); err != nil {
 		return nil, err
@@ -1731,7 +2577,8 @@ func (pc *PeerConnection) generateMatchedSDP(useIdentity bool, includeUnmatched
 		}
 
 		if media.MediaName.Media == "application" {
-			mediaSections = append(mediaSections, mediaSection{id: midValue, data: true})
+			rejected := rejectDataChannels || media.MediaName.Port.Value == 0
+			mediaSections = append(mediaSections, mediaSection{id: midValue, data: true, rejected: rejected})
 			continue
 		}
 
@@ -1741,7 +2588,15 @@ func (pc *PeerConnection) generateMatchedSDP(useIdentity bool, includeUnmatched
 			continue
 		}
 
-		t, localTransceivers = satisfyTypeAndDirection(kind, direction, localTransceivers)
+		// A transceiver keeps its media section across renegotiations, even
+		// if its direction changed since (e.g. after RemoveTrack)
+		t = nil
+		if !detectedPlanB {
+			t, localTransceivers = findByMid(midValue, kind, localTransceivers)
+		}
+		if t == nil {
+			t, localTransceivers = satisfyTypeAndDirection(kind, direction, localTransceivers)
+		}
 		mediaTransceivers := []*RTPTransceiver{t}
 		switch pc.configuration.SDPSemantics {
 		case SDPSemanticsUnifiedPlanWithFallback:
@@ -1771,13 +2626,27 @@ func (pc *PeerConnection) generateMatchedSDP(useIdentity bool, includeUnmatched
 			}
 		}
 
-		mediaSections = append(mediaSections, mediaSection{id: midValue, transceivers: mediaTransceivers})
+		headerExtensions := headerExtensionsFromSDP(media)
+		for _, t := range mediaTransceivers {
+			t.setMid(midValue)
+			t.setHeaderExtensions(headerExtensions)
+		}
+
+		section := mediaSection{id: midValue, transceivers: mediaTransceivers, headerExtensions: pc.transceiverHeaderExtensions(mediaTransceivers[0], media)}
+		if mediaTransceivers[0].mirrorRemote.get() {
+			section.headerExtensions = headerExtensions
+		}
+		if pc.api.settingEngine.mirrorRemotePayloadTypes || mediaTransceivers[0].mirrorRemote.get() {
+			section.remoteMedia = media
+		}
+		mediaSections = append(mediaSections, section)
 	}
 
 	// If we are offering also include unmatched local transceivers
 	if !detectedPlanB && includeUnmatched {
 		for _, t := range localTransceivers {
-			mediaSections = append(mediaSections, mediaSection{id: strconv.Itoa(len(mediaSections)), transceivers: []*RTPTransceiver{t}})
+			t.setMid(strconv.Itoa(len(mediaSections)))
+			mediaSections = append(mediaSections, mediaSection{id: t.getMid(), transceivers: []*RTPTransceiver{t}, headerExtensions: pc.transceiverHeaderExtensions(t, nil)})
 		}
 	}
 
@@ -1785,5 +2654,5 @@ func (pc *PeerConnection) generateMatchedSDP(useIdentity bool, includeUnmatched
 		pc.log.Info("Plan-B Offer detected; responding with Plan-B Answer")
 	}
 
-	return populateSDP(d, detectedPlanB, pc.api.settingEngine.candidates.ICELite, pc.api.mediaEngine, connectionRole, candidates, iceParams, mediaSections, pc.ICEGatheringState())
+	return populateSDP(d, detectedPlanB, pc.api.settingEngine.candidates.ICELite, pc.api.settingEngine.candidates.ICEOptions, pc.api.mediaEngine, connectionRole, candidates, iceParams, mediaSections, pc.ICEGatheringState())
 }
@@ -20,6 +20,7 @@ import (
 	"github.com/pion/transport/test"
 	"github.com/pion/webrtc/v2/pkg/rtcerr"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // newPair creates two new peer connections (an offerer and an answerer) using
@@ -247,6 +248,54 @@ func TestPeerConnection_SetConfiguration_Go(t *testing.T) {
 	}
 }
 
+func TestPeerConnection_SetConfiguration_ICEServerCredentials(t *testing.T) {
+	turnServer := func(password string) []ICEServer {
+		return []ICEServer{{
+			URLs:           []string{"turn:127.0.0.1:3478"},
+			Username:       "unittest",
+			Credential:     password,
+			CredentialType: ICECredentialTypePassword,
+		}}
+	}
+
+	s := SettingEngine{}
+	s.DeferICEGathering(true)
+	pc, err := NewAPI(WithSettingEngine(s)).NewPeerConnection(Configuration{ICEServers: turnServer("expired")})
+	assert.NoError(t, err)
+
+	// Refreshed credentials are used once gathering starts
+	assert.NoError(t, pc.SetConfiguration(Configuration{ICEServers: turnServer("refreshed")}))
+	assert.Equal(t, turnServer("refreshed"), pc.GetConfiguration().ICEServers)
+	assert.Equal(t, 1, len(pc.iceGatherer.validatedServers))
+	assert.Equal(t, "refreshed", pc.iceGatherer.validatedServers[0].Password)
+
+	// Invalid servers are rejected without replacing the current ones
+	assert.Error(t, pc.SetConfiguration(Configuration{ICEServers: []ICEServer{{URLs: []string{"turn:127.0.0.1:3478"}}}}))
+	assert.Equal(t, "refreshed", pc.iceGatherer.validatedServers[0].Password)
+
+	assert.NoError(t, pc.Close())
+}
+
+func TestPeerConnection_SetConfiguration_ICETransportPolicy(t *testing.T) {
+	pc, err := NewPeerConnection(Configuration{BundlePolicy: BundlePolicyBalanced})
+	assert.NoError(t, err)
+
+	// Nothing is updated if any part of the configuration is invalid
+	err = pc.SetConfiguration(Configuration{
+		ICETransportPolicy: ICETransportPolicyRelay,
+		BundlePolicy:       BundlePolicyMaxBundle,
+	})
+	assert.Equal(t, &rtcerr.InvalidModificationError{Err: ErrModifyingBundlePolicy}, err)
+	assert.Equal(t, ICETransportPolicyAll, pc.GetConfiguration().ICETransportPolicy)
+	assert.Equal(t, ICETransportPolicyAll, pc.iceGatherer.gatherPolicy)
+
+	assert.NoError(t, pc.SetConfiguration(Configuration{ICETransportPolicy: ICETransportPolicyRelay}))
+	assert.Equal(t, ICETransportPolicyRelay, pc.GetConfiguration().ICETransportPolicy)
+	assert.Equal(t, ICETransportPolicyRelay, pc.iceGatherer.gatherPolicy)
+
+	assert.NoError(t, pc.Close())
+}
+
 func TestPeerConnection_EventHandlers_Go(t *testing.T) {
 	lim := test.TimeOut(time.Second * 5)
 	defer lim.Stop()
@@ -605,6 +654,45 @@ func TestPeerConnection_OfferingLite(t *testing.T) {
 	})
 
 	<-iceComplete
+
+	// The lite agent advertises itself and only responds to checks
+	assert.Contains(t, offerPC.LocalDescription().SDP, "a=ice-lite")
+	assert.NotContains(t, answerPC.LocalDescription().SDP, "a=ice-lite")
+	assert.Equal(t, ICERoleControlled, offerPC.iceTransport.Role())
+	assert.Equal(t, ICERoleControlling, answerPC.iceTransport.Role())
+
+	assert.NoError(t, offerPC.Close())
+	assert.NoError(t, answerPC.Close())
+}
+
+func TestPeerConnection_ICEOptions(t *testing.T) {
+	s := SettingEngine{}
+	s.SetICEOptions("trickle", "renomination")
+	offerPC, err := NewAPI(WithSettingEngine(s)).NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	answerPC, err := NewAPI().NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	_, err = offerPC.CreateDataChannel("data", nil)
+	assert.NoError(t, err)
+
+	offer, err := offerPC.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.Contains(t, offer.SDP, "a=ice-options:trickle renomination\r\n")
+	assert.NoError(t, offerPC.SetLocalDescription(offer))
+
+	assert.NoError(t, answerPC.SetRemoteDescription(offer))
+	assert.Equal(t, []string{"trickle", "renomination"}, answerPC.RemoteICEOptions())
+
+	// Without options no attribute is generated
+	answer, err := answerPC.CreateAnswer(nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, answer.SDP, "a=ice-options")
+
+	assert.NoError(t, offerPC.SetRemoteDescription(answer))
+	assert.Nil(t, offerPC.RemoteICEOptions())
+
 	assert.NoError(t, offerPC.Close())
 	assert.NoError(t, answerPC.Close())
 }
@@ -641,10 +729,89 @@ func TestPeerConnection_AnsweringLite(t *testing.T) {
 	})
 
 	<-iceComplete
+
+	// The lite agent advertises itself and only responds to checks
+	assert.Contains(t, answerPC.LocalDescription().SDP, "a=ice-lite")
+	assert.NotContains(t, offerPC.LocalDescription().SDP, "a=ice-lite")
+	assert.Equal(t, ICERoleControlling, offerPC.iceTransport.Role())
+	assert.Equal(t, ICERoleControlled, answerPC.iceTransport.Role())
+
 	assert.NoError(t, offerPC.Close())
 	assert.NoError(t, answerPC.Close())
 }
 
+func TestPeerConnection_ICERole(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	assert.Error(t, (&SettingEngine{}).SetICERole(ICERole(0)))
+
+	runTest := func(t *testing.T, offerRole, answerRole ICERole) {
+		offerSettings, answerSettings := SettingEngine{}, SettingEngine{}
+		if offerRole == ICERoleControlled {
+			assert.NoError(t, offerSettings.SetICERole(offerRole))
+			assert.NoError(t, answerSettings.SetICERole(answerRole))
+		}
+
+		offerPC, err := NewAPI(WithSettingEngine(offerSettings)).NewPeerConnection(Configuration{})
+		require.NoError(t, err)
+		answerPC, err := NewAPI(WithSettingEngine(answerSettings)).NewPeerConnection(Configuration{})
+		require.NoError(t, err)
+		assert.Equal(t, ICERole(0), offerPC.ICERole())
+
+		connected := make(chan struct{})
+		answerPC.OnICEConnectionStateChange(func(iceState ICEConnectionState) {
+			if iceState == ICEConnectionStateConnected {
+				close(connected)
+			}
+		})
+
+		require.NoError(t, signalPair(offerPC, answerPC))
+		<-connected
+
+		assert.Equal(t, offerRole, offerPC.ICERole())
+		assert.Equal(t, answerRole, answerPC.ICERole())
+
+		assert.NoError(t, offerPC.Close())
+		assert.NoError(t, answerPC.Close())
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		runTest(t, ICERoleControlling, ICERoleControlled)
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		runTest(t, ICERoleControlled, ICERoleControlling)
+	})
+
+	// A lite agent can't be controlling when the remote is a full agent
+	t.Run("InvalidLite", func(t *testing.T) {
+		s := SettingEngine{}
+		s.SetLite(true)
+		assert.NoError(t, s.SetICERole(ICERoleControlling))
+
+		offerPC, err := NewPeerConnection(Configuration{})
+		require.NoError(t, err)
+		answerPC, err := NewAPI(WithSettingEngine(s)).NewPeerConnection(Configuration{})
+		require.NoError(t, err)
+
+		_, err = offerPC.CreateDataChannel("data", nil)
+		require.NoError(t, err)
+		offer, err := offerPC.CreateOffer(nil)
+		require.NoError(t, err)
+		require.NoError(t, offerPC.SetLocalDescription(offer))
+		err = answerPC.SetRemoteDescription(offer)
+		assert.IsType(t, &rtcerr.InvalidModificationError{}, err)
+
+		// The offer isn't applied
+		assert.Nil(t, answerPC.RemoteDescription())
+		assert.Equal(t, SignalingStateStable, answerPC.SignalingState())
+
+		assert.NoError(t, offerPC.Close())
+		assert.NoError(t, answerPC.Close())
+	})
+}
+
 func TestOnICEGatheringStateChange(t *testing.T) {
 	seenGathering := &atomicBool{}
 	seenComplete := &atomicBool{}
@@ -851,3 +1018,138 @@ func TestPopulateLocalCandidates(t *testing.T) {
 		assert.NoError(t, pc.Close())
 	})
 }
+
+func TestPeerConnection_ParsedDescriptions(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	pcOffer, pcAnswer, err := newPair()
+	assert.NoError(t, err)
+
+	connected := make(chan struct{})
+	pcAnswer.OnICEConnectionStateChange(func(state ICEConnectionState) {
+		if state == ICEConnectionStateConnected {
+			close(connected)
+		}
+	})
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+
+	for _, pc := range []*PeerConnection{pcOffer, pcAnswer} {
+		for _, desc := range []*SessionDescription{pc.CurrentLocalDescription(), pc.CurrentRemoteDescription()} {
+			parsed, err := desc.Unmarshal()
+			assert.NoError(t, err)
+
+			// The parsed form matches the string form
+			sdpBytes, err := parsed.Marshal()
+			assert.NoError(t, err)
+			assert.Equal(t, desc.SDP, string(sdpBytes))
+		}
+
+		assert.Equal(t, pc.CurrentRemoteDescription().parsed, pc.CurrentRemoteDescriptionParsed())
+		assert.Equal(t, pc.RemoteDescription().parsed, pc.RemoteDescriptionParsed())
+		assert.Equal(t, pc.CurrentLocalDescription().parsed, pc.CurrentLocalDescriptionParsed())
+		assert.Equal(t, pc.LocalDescription().parsed, pc.LocalDescriptionParsed())
+		assert.Nil(t, pc.PendingLocalDescriptionParsed())
+		assert.Nil(t, pc.PendingRemoteDescriptionParsed())
+
+		// The caller owns what is returned, the PeerConnection isn't affected by changes
+		parsed := pc.CurrentRemoteDescriptionParsed()
+		require.NotNil(t, parsed)
+		assert.True(t, parsed != pc.currentRemoteDescription.parsed)
+		parsed.MediaDescriptions[0].Attributes = nil
+		parsed.MediaDescriptions = nil
+		parsed, err = pc.CurrentRemoteDescription().Unmarshal()
+		require.NoError(t, err)
+		require.NotEmpty(t, parsed.MediaDescriptions)
+		assert.NotEmpty(t, parsed.MediaDescriptions[0].Attributes)
+		assert.NotEmpty(t, pc.currentRemoteDescription.parsed.MediaDescriptions[0].Attributes)
+	}
+	<-connected
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestPeerConnection_DeferICEGathering(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	s := SettingEngine{}
+	s.DeferICEGathering(true)
+	api := NewAPI(WithSettingEngine(s))
+
+	pcOffer, err := api.NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+	pcAnswer, err := api.NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	// Without an agent no sockets have been opened
+	for _, pc := range []*PeerConnection{pcOffer, pcAnswer} {
+		assert.Nil(t, pc.iceGatherer.getAgent())
+		assert.Equal(t, ICEGatheringStateNew, pc.ICEGatheringState())
+	}
+
+	_, err = pcOffer.CreateDataChannel("data", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, pcOffer.iceGatherer.getAgent())
+
+	connected := make(chan struct{})
+	pcAnswer.OnICEConnectionStateChange(func(state ICEConnectionState) {
+		if state == ICEConnectionStateConnected {
+			close(connected)
+		}
+	})
+
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+	assert.NotNil(t, pcOffer.iceGatherer.getAgent())
+	assert.NotNil(t, pcAnswer.iceGatherer.getAgent())
+	<-connected
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestPeerConnection_GetLocalCandidates(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	s := SettingEngine{}
+	s.SetTrickle(true)
+	pc, err := NewAPI(WithSettingEngine(s)).NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	candidates, err := pc.GetLocalCandidates()
+	assert.NoError(t, err)
+	assert.Empty(t, candidates)
+
+	// Every emitted candidate has been added to the list when the handler runs
+	var emitted []ICECandidate
+	gathered := make(chan struct{})
+	pc.OnICECandidate(func(c *ICECandidate) {
+		candidates, err := pc.GetLocalCandidates()
+		assert.NoError(t, err)
+		if c == nil {
+			assert.Equal(t, emitted, candidates)
+			close(gathered)
+			return
+		}
+
+		emitted = append(emitted, *c)
+		assert.Equal(t, emitted, candidates)
+	})
+
+	_, err = pc.CreateDataChannel("data", nil)
+	assert.NoError(t, err)
+	offer, err := pc.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pc.SetLocalDescription(offer))
+	<-gathered
+	assert.NotEmpty(t, emitted)
+
+	assert.NoError(t, pc.Close())
+	_, err = pc.GetLocalCandidates()
+	assert.Equal(t, &rtcerr.InvalidStateError{Err: ErrConnectionClosed}, err)
+}
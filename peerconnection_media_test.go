@@ -5,19 +5,26 @@ package webrtc
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 	"math/rand"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
 	"github.com/pion/sdp/v2"
 	"github.com/pion/transport/test"
 	"github.com/pion/webrtc/v2/pkg/media"
+	"github.com/pion/webrtc/v2/pkg/rtcerr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -451,7 +458,11 @@ func TestPeerConnection_Media_Closed(t *testing.T) {
 		time.Sleep(time.Second)
 		closeChan <- pcAnswer.Close()
 	}()
-	if _, err = vp8Reader.Read(make([]byte, 1)); err != io.EOF {
+	// The packet that announced the Track is still buffered
+	for err == nil {
+		_, err = vp8Reader.Read(make([]byte, receiveMTU))
+	}
+	if err != io.EOF {
 		t.Fatal("Reading from closed Track did not return io.EOF")
 	} else if err = <-closeChan; err != nil {
 		t.Fatal(err)
@@ -507,7 +518,7 @@ func TestUndeclaredSSRC(t *testing.T) {
 	for scanner.Scan() {
 		l := scanner.Text()
 		if strings.HasPrefix(l, "m=") {
-			inApplicationMedia = !inApplicationMedia
+			inApplicationMedia = strings.HasPrefix(l, "m=application")
 		} else if strings.HasPrefix(l, "a=ssrc") {
 			continue
 		}
@@ -546,6 +557,105 @@ func TestUndeclaredSSRC(t *testing.T) {
 	assert.NoError(t, pcAnswer.Close())
 }
 
+func TestTrack_IsSimulcast(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	// Each case rewrites the lines of the video section of the offer
+	for name, munge := range map[string]func(line string, ssrc uint32) []string{
+		"Single stream": func(line string, ssrc uint32) []string {
+			return []string{line}
+		},
+		"SSRC group": func(line string, ssrc uint32) []string {
+			if strings.HasPrefix(line, "a=ssrc:") && strings.Contains(line, "cname:") {
+				return []string{fmt.Sprintf("a=ssrc-group:SIM %d", ssrc), line}
+			}
+			return []string{line}
+		},
+		"RID": func(line string, ssrc uint32) []string {
+			if strings.HasPrefix(line, "a=ssrc") {
+				return nil
+			} else if strings.HasPrefix(line, "a=mid:") {
+				return []string{line, "a=rid:f send max-width=1280;max-height=720", "a=rid:h send max-width=640;max-height=360", "a=simulcast:send f;h"}
+			}
+			return []string{line}
+		},
+	} {
+		munge := munge
+		expected := name != "Single stream"
+		expectedRIDs := 0
+		if name == "RID" {
+			expectedRIDs = 2
+		}
+		t.Run(name, func(t *testing.T) {
+			api := NewAPI()
+			api.mediaEngine.RegisterDefaultCodecs()
+			pcOffer, pcAnswer, err := api.newPair(Configuration{})
+			assert.NoError(t, err)
+
+			_, err = pcAnswer.AddTransceiverFromKind(RTPCodecTypeVideo)
+			assert.NoError(t, err)
+
+			vp8Writer, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+			assert.NoError(t, err)
+			_, err = pcOffer.AddTrack(vp8Writer)
+			assert.NoError(t, err)
+
+			onTrackFired := make(chan bool, 1)
+			pcAnswer.OnTrack(func(track *Track, r *RTPReceiver) {
+				assert.Equal(t, expectedRIDs, len(r.RIDs()))
+				onTrackFired <- track.IsSimulcast()
+			})
+
+			offer, err := pcOffer.CreateOffer(nil)
+			assert.NoError(t, err)
+			assert.NoError(t, pcOffer.SetLocalDescription(offer))
+
+			// The application section is removed, so undeclared SSRCs are accepted
+			munged := ""
+			section := ""
+			for _, l := range strings.Split(strings.TrimSpace(offer.SDP), "\r\n") {
+				if strings.HasPrefix(l, "m=") {
+					section = strings.Fields(l[2:])[0]
+				}
+
+				switch section {
+				case "application":
+				case "video":
+					for _, line := range munge(l, vp8Writer.SSRC()) {
+						munged += line + "\r\n"
+					}
+				default:
+					munged += l + "\r\n"
+				}
+			}
+			offer.SDP = munged
+			assert.NoError(t, pcAnswer.SetRemoteDescription(offer))
+
+			answer, err := pcAnswer.CreateAnswer(nil)
+			assert.NoError(t, err)
+			assert.NoError(t, pcAnswer.SetLocalDescription(answer))
+			assert.NoError(t, pcOffer.SetRemoteDescription(answer))
+
+			var isSimulcast bool
+			func() {
+				for {
+					assert.NoError(t, vp8Writer.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+					select {
+					case isSimulcast = <-onTrackFired:
+						return
+					case <-time.After(25 * time.Millisecond):
+					}
+				}
+			}()
+			assert.Equal(t, expected, isSimulcast)
+
+			assert.NoError(t, pcOffer.Close())
+			assert.NoError(t, pcAnswer.Close())
+		})
+	}
+}
+
 func TestOfferRejectionMissingCodec(t *testing.T) {
 	lim := test.TimeOut(time.Second * 30)
 	defer lim.Stop()
@@ -597,6 +707,42 @@ func TestOfferRejectionMissingCodec(t *testing.T) {
 	assert.NoError(t, pc.Close())
 }
 
+func TestPeerConnection_Media_RejectedByAnswer(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, err := api.NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+
+	// The answerer only supports video and rejects the audio media section
+	videoAPI := NewAPI()
+	videoAPI.mediaEngine.RegisterCodec(NewRTPVP8Codec(DefaultPayloadTypeVP8, 90000))
+	pcAnswer, err := videoAPI.NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+
+	video, err := pcOffer.AddTransceiverFromKind(RTPCodecTypeVideo)
+	require.NoError(t, err)
+	track, err := pcOffer.NewTrack(DefaultPayloadTypeOpus, rand.Uint32(), "audio", "pion")
+	require.NoError(t, err)
+	_, err = pcOffer.AddTrack(track)
+	require.NoError(t, err)
+	audio := pcOffer.GetTransceivers()[1]
+
+	require.NoError(t, signalPair(pcOffer, pcAnswer))
+	assert.Contains(t, pcOffer.RemoteDescription().SDP, "m=audio 0 ")
+
+	assert.Equal(t, RTPTransceiverDirectionInactive, audio.Direction())
+	assert.Equal(t, 0, track.SenderCount())
+	assert.Nil(t, audio.Receiver().Track())
+
+	assert.Equal(t, RTPTransceiverDirectionSendrecv, video.Direction())
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
 func TestAddTransceiverFromTrackSendOnly(t *testing.T) {
 	lim := test.TimeOut(time.Second * 30)
 	defer lim.Stop()
@@ -1074,3 +1220,2196 @@ func TestPlanBMultiTrack(t *testing.T) {
 	assert.NoError(t, pcOffer.Close())
 	assert.NoError(t, pcAnswer.Close())
 }
+
+// Assert that RTCP for an SSRC nobody claimed is delivered via OnRTCP
+func TestPeerConnection_OnRTCP(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	pcOffer, pcAnswer, err := newPair()
+	assert.NoError(t, err)
+
+	const unclaimedSSRC = 0xDEADBEEF
+
+	appHeader, err := (&rtcp.Header{Type: rtcp.TypeApplicationDefined, Length: 2}).Marshal()
+	assert.NoError(t, err)
+	appDefined := rtcp.RawPacket(append(appHeader, 0x00, 0x00, 0x00, 0x01, 'p', 'i', 'o', 'n'))
+
+	onRTCPFired, onRTCPFiredFunc := context.WithCancel(context.Background())
+	pcAnswer.OnRTCP(func(pkts []rtcp.Packet, ssrc uint32, receiver *RTPReceiver, sender *RTPSender) {
+		if ssrc != unclaimedSSRC || len(pkts) != 2 {
+			return
+		}
+		assert.Nil(t, receiver)
+		assert.Nil(t, sender)
+
+		raw, ok := pkts[1].(*rtcp.RawPacket)
+		if !ok || raw.Header().Type != rtcp.TypeApplicationDefined {
+			return
+		}
+		assert.Equal(t, []byte(appDefined), []byte(*raw))
+		onRTCPFiredFunc()
+	})
+
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+
+	func() {
+		for {
+			select {
+			case <-time.After(20 * time.Millisecond):
+				assert.NoError(t, pcOffer.WriteRTCP([]rtcp.Packet{
+					&rtcp.PictureLossIndication{MediaSSRC: unclaimedSSRC},
+					&appDefined,
+				}))
+			case <-onRTCPFired.Done():
+				return
+			}
+		}
+	}()
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that RTCP a started RTPSender or RTPReceiver doesn't handle is
+// delivered via OnRTCP with it
+func TestPeerConnection_OnRTCPStarted(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	pcOffer, pcAnswer, local, _ := connectTrackPair(t)
+	sender := pcOffer.GetSenders()[0]
+	receiver := pcAnswer.GetReceivers()[0]
+	ssrc := local.SSRC()
+
+	appHeader, err := (&rtcp.Header{Type: rtcp.TypeApplicationDefined, Length: 2}).Marshal()
+	assert.NoError(t, err)
+	appDefined := rtcp.RawPacket(append(appHeader, 0x00, 0x00, 0x00, 0x01, 'p', 'i', 'o', 'n'))
+
+	// onApplicationDefined returns a channel that receives the packets passed
+	// with an application-defined packet
+	onApplicationDefined := func(pc *PeerConnection) chan []rtcp.Packet {
+		received := make(chan []rtcp.Packet, 1)
+		pc.OnRTCP(func(pkts []rtcp.Packet, pktSSRC uint32, pktReceiver *RTPReceiver, pktSender *RTPSender) {
+			for _, p := range pkts {
+				if raw, ok := p.(*rtcp.RawPacket); ok && raw.Header().Type == rtcp.TypeApplicationDefined {
+					assert.Equal(t, ssrc, pktSSRC)
+					if pc == pcOffer {
+						assert.Equal(t, sender, pktSender)
+						assert.Nil(t, pktReceiver)
+					} else {
+						assert.Equal(t, receiver, pktReceiver)
+						assert.Nil(t, pktSender)
+					}
+					select {
+					case received <- pkts:
+					default:
+					}
+				}
+			}
+		})
+		return received
+	}
+	offerReceived, answerReceived := onApplicationDefined(pcOffer), onApplicationDefined(pcAnswer)
+
+	// The RTPSender handles the PLI and passes on the application-defined packet
+	assert.NoError(t, pcAnswer.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: ssrc}, &appDefined}))
+	pkts := <-offerReceived
+	require.Len(t, pkts, 1)
+	assert.Equal(t, []byte(appDefined), []byte(*pkts[0].(*rtcp.RawPacket)))
+
+	// The RTPReceiver handles the Source Description and passes on the
+	// application-defined packet and the Goodbye, which ends the Track
+	sdes := &rtcp.SourceDescription{Chunks: []rtcp.SourceDescriptionChunk{{
+		Source: ssrc,
+		Items:  []rtcp.SourceDescriptionItem{{Type: rtcp.SDESCNAME, Text: "pion"}},
+	}}}
+	goodbye := &rtcp.Goodbye{Sources: []uint32{ssrc}}
+	assert.NoError(t, pcOffer.WriteRTCP([]rtcp.Packet{sdes, &appDefined, goodbye}))
+	pkts = <-answerReceived
+	require.Len(t, pkts, 2)
+	assert.Equal(t, []byte(appDefined), []byte(*pkts[0].(*rtcp.RawPacket)))
+	assert.Equal(t, goodbye, pkts[1])
+	assert.Equal(t, "pion", receiver.CNAME())
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// Assert that a RTCP Goodbye from the remote ends the matching Track
+func TestPeerConnection_Media_Goodbye(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, pcAnswer, err := api.newPair(Configuration{})
+	assert.NoError(t, err)
+
+	_, err = pcAnswer.AddTransceiverFromKind(RTPCodecTypeVideo)
+	assert.NoError(t, err)
+
+	track, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	assert.NoError(t, err)
+
+	_, err = pcOffer.AddTrack(track)
+	assert.NoError(t, err)
+
+	onTrackFired := make(chan struct{})
+	trackEnded := make(chan error)
+	pcAnswer.OnTrack(func(track *Track, r *RTPReceiver) {
+		close(onTrackFired)
+		for {
+			if _, readErr := track.ReadRTP(); readErr != nil {
+				trackEnded <- readErr
+				return
+			}
+		}
+	})
+
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+
+	done := make(chan struct{})
+	go sendVideoUntilDone(done, t, []*Track{track})
+	<-onTrackFired
+
+	func() {
+		for {
+			select {
+			case <-time.After(20 * time.Millisecond):
+				assert.NoError(t, pcOffer.WriteRTCP([]rtcp.Packet{&rtcp.Goodbye{Sources: []uint32{track.SSRC()}}}))
+			case readErr := <-trackEnded:
+				assert.Equal(t, io.EOF, readErr)
+				return
+			}
+		}
+	}()
+	close(done)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestPeerConnection_Media_AnswerRecvonly(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	offerAPI := NewAPI()
+	offerAPI.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, err := offerAPI.NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	s := SettingEngine{}
+	s.SetAnswerRecvonly(true)
+	answerAPI := NewAPI(WithSettingEngine(s))
+	answerAPI.mediaEngine.RegisterDefaultCodecs()
+	pcAnswer, err := answerAPI.NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	var tracks []*Track
+	for _, payloadType := range []uint8{DefaultPayloadTypeOpus, DefaultPayloadTypeVP8} {
+		track, trackErr := pcOffer.NewTrack(payloadType, rand.Uint32(), "track", "pion")
+		assert.NoError(t, trackErr)
+
+		_, err = pcOffer.AddTrack(track)
+		assert.NoError(t, err)
+		tracks = append(tracks, track)
+	}
+
+	onTrackFired := make(chan *Track, len(tracks))
+	pcAnswer.OnTrack(func(track *Track, r *RTPReceiver) {
+		onTrackFired <- track
+	})
+
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+
+	for _, transceiver := range pcAnswer.GetTransceivers() {
+		assert.Equal(t, RTPTransceiverDirectionRecvonly, transceiver.Direction())
+		assert.Nil(t, transceiver.Sender())
+	}
+
+	answer := sdp.SessionDescription{}
+	assert.NoError(t, answer.Unmarshal([]byte(pcAnswer.LocalDescription().SDP)))
+
+	mediaSections := 0
+	for _, media := range answer.MediaDescriptions {
+		if media.MediaName.Media == "application" {
+			continue
+		}
+		mediaSections++
+		assert.Equal(t, RTPTransceiverDirectionRecvonly, getPeerDirection(media))
+	}
+	assert.Equal(t, len(tracks), mediaSections)
+
+	done := make(chan struct{})
+	go sendVideoUntilDone(done, t, tracks)
+
+	kinds := map[RTPCodecType]bool{}
+	for range tracks {
+		track := <-onTrackFired
+		kinds[track.Kind()] = true
+	}
+	close(done)
+	assert.Equal(t, map[RTPCodecType]bool{RTPCodecTypeAudio: true, RTPCodecTypeVideo: true}, kinds)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestRTPReceiver_KeyframeRequestTimeout(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+
+	plis := make(chan *rtcp.PictureLossIndication, 10)
+	go func() {
+		for {
+			pkts, err := pcOffer.GetSenders()[0].ReadRTCP()
+			if err != nil {
+				return
+			}
+			for _, p := range pkts {
+				if pli, ok := p.(*rtcp.PictureLossIndication); ok {
+					plis <- pli
+				}
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			if _, err := remote.ReadRTP(); err != nil {
+				return
+			}
+		}
+	}()
+
+	const timeout = 300 * time.Millisecond
+	pcAnswer.GetTransceivers()[0].Receiver().SetKeyframeRequestTimeout(timeout)
+
+	writeFor := func(d time.Duration, keyframe bool) {
+		// The inverse key frame flag is the lowest bit of the VP8 payload header
+		data := []byte{0x01}
+		if keyframe {
+			data = []byte{0x00}
+		}
+		for end := time.Now().Add(d); time.Now().Before(end); time.Sleep(20 * time.Millisecond) {
+			assert.NoError(t, local.WriteSample(media.Sample{Data: data, Samples: 1}))
+		}
+	}
+
+	// No keyframe within the timeout requests exactly one, even if none arrives
+	// for several timeouts
+	writeFor(timeout*3, false)
+	assert.Equal(t, 1, len(plis))
+	pli := <-plis
+	assert.Equal(t, remote.SSRC(), pli.MediaSSRC)
+
+	// Keyframes arriving within the timeout don't cause any requests
+	writeFor(timeout*3/2, true)
+	assert.Equal(t, 0, len(plis))
+
+	// A keyframe starts the timeout again
+	writeFor(timeout*3/2, false)
+	assert.Equal(t, 1, len(plis))
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestRTPSender_Stats(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+	sender := pcOffer.GetSenders()[0]
+
+	go func() {
+		for {
+			if _, err := sender.ReadRTCP(); err != nil {
+				return
+			}
+		}
+	}()
+
+	assert.NoError(t, pcAnswer.WriteRTCP([]rtcp.Packet{
+		&rtcp.TransportLayerNack{MediaSSRC: remote.SSRC(), Nacks: []rtcp.NackPair{{PacketID: 1}}},
+		&rtcp.TransportLayerNack{MediaSSRC: remote.SSRC(), Nacks: []rtcp.NackPair{{PacketID: 5}}},
+		&rtcp.PictureLossIndication{MediaSSRC: remote.SSRC()},
+		&rtcp.TransportLayerNack{MediaSSRC: remote.SSRC() + 1, Nacks: []rtcp.NackPair{{PacketID: 1}}},
+	}))
+
+	var stats OutboundRTPStreamStats
+	assert.Eventually(t, func() bool {
+		var ok bool
+		stats, ok = pcOffer.GetStats().GetOutboundRTPStreamStats(sender)
+		return ok && stats.NACKCount == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, StatsTypeOutboundRTP, stats.Type)
+	assert.Equal(t, local.SSRC(), stats.SSRC)
+	assert.Equal(t, "video", stats.Kind)
+	assert.Equal(t, uint32(1), stats.PLICount)
+	assert.NotZero(t, stats.PacketsSent)
+	assert.NotZero(t, stats.BytesSent)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestRTPSender_SendPadding(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+	sender := pcOffer.GetSenders()[0]
+
+	assert.Error(t, sender.SendPadding(0))
+
+	// Padding is sent between media written with WriteRTP, 300 bytes are split
+	// over two packets
+	for i, paddingBytes := range []int{300, 10, 0} {
+		assert.NoError(t, local.WriteRTP(local.Packetizer().Packetize([]byte{0xA0 + byte(i)}, 1)[0]))
+		if paddingBytes != 0 {
+			assert.NoError(t, sender.SendPadding(paddingBytes))
+		}
+	}
+
+	// Skip packets written while waiting for OnTrack
+	p, err := remote.ReadRTP()
+	for ; err == nil && p.Payload[len(p.Payload)-1] != 0xA0; p, err = remote.ReadRTP() {
+	}
+	require.NoError(t, err)
+	firstSequenceNumber := p.SequenceNumber
+
+	// The sequence numbers stay continuous across media and padding
+	for i, size := range []int{255, 45, 0, 10, 0} {
+		p, err = remote.ReadRTP()
+		require.NoError(t, err)
+		assert.Equal(t, firstSequenceNumber+uint16(i+1), p.SequenceNumber)
+		assert.Equal(t, local.SSRC(), p.SSRC)
+		assert.Equal(t, local.PayloadType(), p.PayloadType)
+		if size == 0 {
+			assert.False(t, p.Padding)
+			continue
+		}
+		assert.True(t, p.Padding)
+		assert.Equal(t, size, len(p.Payload))
+		assert.Equal(t, byte(size), p.Payload[size-1])
+	}
+	assert.Equal(t, byte(0xA2), p.Payload[len(p.Payload)-1])
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestRTPReceiver_SendFeedback(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	firs := make(chan []byte, 10)
+	s := SettingEngine{}
+	s.SetPacketTracer(func(trace PacketTrace) {
+		for _, p := range trace.RTCP {
+			if raw, ok := p.(*rtcp.RawPacket); ok && trace.Outbound {
+				firs <- *raw
+			}
+		}
+	})
+	pcOffer, pcAnswer, _, remote := connectTrackPairWithAPI(t, NewAPI(WithSettingEngine(s)))
+	receiver := pcAnswer.GetTransceivers()[0].Receiver()
+
+	readFeedback := func() rtcp.Packet {
+		for {
+			pkts, err := pcOffer.GetSenders()[0].ReadRTCP()
+			require.NoError(t, err)
+			for _, p := range pkts {
+				switch p.(type) {
+				case *rtcp.PictureLossIndication, *rtcp.TransportLayerNack:
+					return p
+				}
+			}
+		}
+	}
+
+	assert.NoError(t, receiver.SendPLI())
+	assert.Equal(t, &rtcp.PictureLossIndication{MediaSSRC: remote.SSRC()}, readFeedback())
+
+	assert.NoError(t, receiver.SendNACK([]uint16{10, 12, 12, 30}))
+	assert.Equal(t, &rtcp.TransportLayerNack{
+		MediaSSRC: remote.SSRC(),
+		Nacks:     []rtcp.NackPair{{PacketID: 10, LostPackets: 0x2}, {PacketID: 30}},
+	}, readFeedback())
+
+	// FIR has no destination SSRC that pion/srtp understands, so look at what is sent
+	for i := 1; i <= 2; i++ {
+		assert.NoError(t, receiver.SendFIR())
+		fir := <-firs
+		require.Len(t, fir, 20)
+		assert.Equal(t, []byte{0x84, 206, 0, 4}, fir[:4])
+		assert.Equal(t, remote.SSRC(), binary.BigEndian.Uint32(fir[12:]))
+		assert.Equal(t, byte(i), fir[16])
+	}
+
+	// Feedback can't be sent before Receive
+	unstarted, err := pcAnswer.api.NewRTPReceiver(RTPCodecTypeVideo, pcAnswer.dtlsTransport)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrReceiverNotStarted, unstarted.SendPLI())
+	assert.Equal(t, ErrReceiverNotStarted, unstarted.SendFIR())
+	assert.Equal(t, ErrReceiverNotStarted, unstarted.SendNACK([]uint16{1}))
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestRTPReceiver_CNAME(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	pcOffer, pcAnswer, _, remote := connectTrackPair(t)
+	receiver := pcAnswer.GetTransceivers()[0].Receiver()
+	assert.Equal(t, "", receiver.CNAME())
+
+	sdes := func(ssrc uint32, cname string) []rtcp.Packet {
+		return []rtcp.Packet{&rtcp.SourceDescription{Chunks: []rtcp.SourceDescriptionChunk{{
+			Source: ssrc,
+			Items: []rtcp.SourceDescriptionItem{
+				{Type: rtcp.SDESName, Text: "name"},
+				{Type: rtcp.SDESCNAME, Text: cname},
+			},
+		}}}}
+	}
+
+	assert.NoError(t, pcAnswer.InjectRTCP(sdes(remote.SSRC(), "user@example.com")))
+	assert.Equal(t, "user@example.com", receiver.CNAME())
+
+	// The CNAMEs of other sources are ignored
+	assert.NoError(t, pcAnswer.InjectRTCP(sdes(remote.SSRC()+1, "other@example.com")))
+	assert.Equal(t, "user@example.com", receiver.CNAME())
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestRTPReceiver_SetReadTransform(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+
+	// Strip the header extensions and drop the packets marked with 0xDD
+	pcAnswer.GetReceivers()[0].SetReadTransform(func(p *rtp.Packet) *rtp.Packet {
+		if p.Payload[len(p.Payload)-1] == 0xDD {
+			return nil
+		}
+		p.Extension = false
+		p.ExtensionProfile = 0
+		p.ExtensionPayload = nil
+		return p
+	})
+
+	for _, marker := range []byte{0xA1, 0xDD, 0xA3} {
+		p := local.Packetizer().Packetize([]byte{marker}, 1)[0]
+		p.Extension = true
+		p.ExtensionProfile = 0xBEDE
+		p.ExtensionPayload = []byte{0x10, 0xFF, 0x00, 0x00}
+		assert.NoError(t, local.WriteRTP(p))
+	}
+
+	p := readMarked(t, remote, 0xA1)
+	assert.False(t, p.Extension)
+
+	p, err := remote.ReadRTP()
+	require.NoError(t, err)
+	assert.Equal(t, byte(0xA3), p.Payload[len(p.Payload)-1])
+	assert.False(t, p.Extension)
+	assert.Empty(t, p.ExtensionPayload)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestRTPSender_SetMaxLayers(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+	pcOffer.GetSenders()[0].SetMaxLayers(0, 0)
+
+	// VP8 packets with the T bit, the TID is the highest two bits of the third byte
+	temporalIDs := []byte{0, 2, 1, 2, 0, 2, 1, 2, 0}
+	for i, temporalID := range temporalIDs {
+		p := local.Packetizer().Packetize([]byte{0xF0 + byte(i)}, 1)[0]
+		p.Payload = []byte{0x90, 0x20, temporalID << 6, 0xF0 + byte(i)}
+		assert.NoError(t, local.WriteRTP(p))
+	}
+
+	// Only the base layer arrives, without gaps in the sequence numbers
+	p := readMarked(t, remote, 0xF0)
+	sequenceNumber := p.SequenceNumber
+	for i, marker := range []byte{0xF4, 0xF8} {
+		p, err := remote.ReadRTP()
+		require.NoError(t, err)
+		assert.Equal(t, marker, p.Payload[len(p.Payload)-1])
+		assert.Equal(t, sequenceNumber+1+uint16(i), p.SequenceNumber)
+		layer, ok := ParseRTPLayer(VP8, p.Payload)
+		assert.True(t, ok)
+		assert.Equal(t, RTPLayer{}, layer)
+	}
+
+	// Sending all layers again continues the sequence numbers
+	pcOffer.GetSenders()[0].SetMaxLayers(7, 7)
+	assert.NoError(t, local.WriteSample(media.Sample{Data: []byte{0xFF}, Samples: 1}))
+	p, err := remote.ReadRTP()
+	require.NoError(t, err)
+	assert.Equal(t, byte(0xFF), p.Payload[len(p.Payload)-1])
+	assert.Equal(t, sequenceNumber+3, p.SequenceNumber)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestRTPSender_OnKeyframeRequest(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	for _, supportsPLI := range []bool{true, false} {
+		var feedback []RTCPFeedback
+		if supportsPLI {
+			feedback = []RTCPFeedback{{Type: TypeRTCPFBNACK, Parameter: "pli"}}
+		}
+		api := NewAPI()
+		api.mediaEngine.RegisterCodec(NewRTPVP8CodecExt(DefaultPayloadTypeVP8, 90000, feedback, ""))
+		pcOffer, pcAnswer, _, remote := connectTrackPairWithAPI(t, api)
+		sender := pcOffer.GetSenders()[0]
+
+		keyframeRequested := make(chan struct{}, 1)
+		sender.OnKeyframeRequest(func() {
+			keyframeRequested <- struct{}{}
+		})
+		assert.NoError(t, pcAnswer.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: remote.SSRC()}}))
+
+		// The PLI is received either way, the handler is only called if the codec supports it
+		assert.Eventually(t, func() bool {
+			stats, ok := pcOffer.GetStats().GetOutboundRTPStreamStats(sender)
+			return ok && stats.PLICount == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		select {
+		case <-keyframeRequested:
+			assert.True(t, supportsPLI)
+		case <-time.After(100 * time.Millisecond):
+			assert.False(t, supportsPLI)
+		}
+
+		assert.NoError(t, pcOffer.Close())
+		assert.NoError(t, pcAnswer.Close())
+	}
+}
+
+func TestRTPSender_OnKeyframeRequestFIR(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	for _, negotiated := range []bool{true, false} {
+		s := SettingEngine{}
+		if !negotiated {
+			// The codec supports FIR, but the media sections don't have it
+			s.SetSDPTransform(func(d *sdp.SessionDescription) {
+				for _, m := range d.MediaDescriptions {
+					attributes := []sdp.Attribute{}
+					for _, a := range m.Attributes {
+						if a.Key != "rtcp-fb" || !strings.HasSuffix(a.Value, " ccm fir") {
+							attributes = append(attributes, a)
+						}
+					}
+					m.Attributes = attributes
+				}
+			})
+		}
+		api := NewAPI(WithSettingEngine(s))
+		api.mediaEngine.RegisterCodec(NewRTPVP8CodecExt(DefaultPayloadTypeVP8, 90000, []RTCPFeedback{{Type: TypeRTCPFBCCM, Parameter: "fir"}}, ""))
+		pcOffer, pcAnswer, _, remote := connectTrackPairWithAPI(t, api)
+		sender := pcOffer.GetSenders()[0]
+
+		keyframeRequested := make(chan struct{}, 1)
+		sender.OnKeyframeRequest(func() {
+			keyframeRequested <- struct{}{}
+		})
+
+		fir := func(ssrc uint32) rtcp.Packet {
+			raw := rtcp.RawPacket(make([]byte, 20))
+			header, err := (&rtcp.Header{Count: rtcpFeedbackFormatFIR, Type: rtcp.TypePayloadSpecificFeedback, Length: 4}).Marshal()
+			require.NoError(t, err)
+			copy(raw, header)
+			binary.BigEndian.PutUint32(raw[12:], ssrc)
+			return &raw
+		}
+		// RTCP is dispatched by the SSRCs it is for, which pion/rtcp doesn't
+		// know for a FIR, so it is sent along with a Receiver Report
+		receiverReport := &rtcp.ReceiverReport{Reports: []rtcp.ReceptionReport{{SSRC: remote.SSRC()}}}
+
+		// A FIR for another SSRC doesn't request a keyframe of this sender
+		assert.NoError(t, pcAnswer.WriteRTCP([]rtcp.Packet{receiverReport, fir(remote.SSRC() + 1)}))
+		assert.NoError(t, pcAnswer.WriteRTCP([]rtcp.Packet{receiverReport, fir(remote.SSRC())}))
+
+		assert.Eventually(t, func() bool {
+			stats, ok := pcOffer.GetStats().GetOutboundRTPStreamStats(sender)
+			return ok && stats.FIRCount == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		select {
+		case <-keyframeRequested:
+			assert.True(t, negotiated)
+		case <-time.After(100 * time.Millisecond):
+			assert.False(t, negotiated)
+		}
+
+		assert.NoError(t, pcOffer.Close())
+		assert.NoError(t, pcAnswer.Close())
+	}
+}
+
+func TestPeerConnection_InjectRTCP(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterCodec(NewRTPVP8CodecExt(DefaultPayloadTypeVP8, 90000, []RTCPFeedback{{Type: TypeRTCPFBNACK, Parameter: "pli"}}, ""))
+	pcOffer, pcAnswer, local, _ := connectTrackPairWithAPI(t, api)
+	sender := pcOffer.GetSenders()[0]
+
+	keyframeRequested := make(chan struct{}, 1)
+	sender.OnKeyframeRequest(func() {
+		keyframeRequested <- struct{}{}
+	})
+	unhandledSSRC := make(chan uint32, 1)
+	pcOffer.OnRTCP(func(pkts []rtcp.Packet, ssrc uint32, receiver *RTPReceiver, sender *RTPSender) {
+		if receiver == nil && sender == nil {
+			unhandledSSRC <- ssrc
+		}
+	})
+
+	assert.NoError(t, pcOffer.InjectRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: local.SSRC()}}))
+	<-keyframeRequested
+
+	pkts, err := sender.ReadRTCP()
+	assert.NoError(t, err)
+	require.Len(t, pkts, 1)
+	assert.Equal(t, local.SSRC(), pkts[0].(*rtcp.PictureLossIndication).MediaSSRC)
+
+	// RTCP for an SSRC nobody sends or receives goes to OnRTCP
+	assert.NoError(t, pcOffer.InjectRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: local.SSRC() + 1}}))
+	assert.Equal(t, local.SSRC()+1, <-unhandledSSRC)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+
+	assert.Error(t, pcOffer.InjectRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: local.SSRC()}}))
+}
+
+func TestPeerConnection_Media_AddTrackAfterSetRemoteDescription(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, pcAnswer, err := api.newPair(Configuration{})
+	assert.NoError(t, err)
+
+	_, err = pcOffer.AddTransceiverFromKind(RTPCodecTypeAudio, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	assert.NoError(t, err)
+
+	offerTrack, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "offer")
+	assert.NoError(t, err)
+	_, err = pcOffer.AddTrack(offerTrack)
+	assert.NoError(t, err)
+
+	offer, err := pcOffer.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcOffer.SetLocalDescription(offer))
+	assert.NoError(t, pcAnswer.SetRemoteDescription(offer))
+
+	// Add the Track after inspecting the offer
+	answerTrack, err := pcAnswer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "answer")
+	assert.NoError(t, err)
+	_, err = pcAnswer.AddTrack(answerTrack)
+	assert.NoError(t, err)
+
+	answer, err := pcAnswer.CreateAnswer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcAnswer.SetLocalDescription(answer))
+
+	parsed, err := answer.Unmarshal()
+	require.NoError(t, err)
+	for _, media := range parsed.MediaDescriptions {
+		if media.MediaName.Media != mediaNameVideo {
+			continue
+		}
+
+		// The Track is bound to the sendrecv video media section
+		assert.Equal(t, RTPTransceiverDirectionSendrecv, getPeerDirection(media))
+		msid, ok := media.Attribute("msid")
+		assert.True(t, ok)
+		assert.Equal(t, answerTrack.Label()+" "+answerTrack.ID(), msid)
+	}
+
+	onTrackFired := make(chan *Track, 2)
+	for _, pc := range []*PeerConnection{pcOffer, pcAnswer} {
+		pc.OnTrack(func(track *Track, r *RTPReceiver) {
+			onTrackFired <- track
+		})
+	}
+	assert.NoError(t, pcOffer.SetRemoteDescription(answer))
+
+	done := make(chan struct{})
+	go sendVideoUntilDone(done, t, []*Track{offerTrack, answerTrack})
+
+	labels := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		labels[(<-onTrackFired).Label()] = true
+	}
+	close(done)
+	assert.Equal(t, map[string]bool{"offer": true, "answer": true}, labels)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestPeerConnection_RTCPReducedSize(t *testing.T) {
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+
+	for _, pc := range []*PeerConnection{pcOffer, pcAnswer} {
+		assert.Contains(t, pc.CurrentLocalDescription().SDP, "a=rtcp-rsize")
+		assert.Contains(t, pc.CurrentRemoteDescription().SDP, "a=rtcp-rsize")
+	}
+
+	var sender *RTPSender
+	for _, s := range pcOffer.GetSenders() {
+		if s.Track() == local {
+			sender = s
+		}
+	}
+	require.NotNil(t, sender)
+
+	readPLI := func() []rtcp.Packet {
+		require.NoError(t, pcAnswer.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: remote.SSRC()}}))
+		for {
+			pkts, err := sender.ReadRTCP()
+			require.NoError(t, err)
+			if _, ok := pkts[len(pkts)-1].(*rtcp.PictureLossIndication); ok {
+				return pkts
+			}
+		}
+	}
+
+	// Feedback is sent on its own when reduced-size RTCP was negotiated
+	pkts := readPLI()
+	assert.Len(t, pkts, 1)
+
+	// Otherwise it's preceded by a Receiver Report
+	pcAnswer.dtlsTransport.setReducedSizeRTCP(false)
+	pkts = readPLI()
+	require.Len(t, pkts, 2)
+	assert.IsType(t, &rtcp.ReceiverReport{}, pkts[0])
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestRTPTransceiver_HeaderExtensions(t *testing.T) {
+	pcOffer, pcAnswer, err := newPair()
+	require.NoError(t, err)
+
+	offerTransceiver, err := pcOffer.AddTransceiverFromKind(RTPCodecTypeVideo)
+	require.NoError(t, err)
+	answerTransceiver, err := pcAnswer.AddTransceiverFromKind(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	require.NoError(t, err)
+	assert.Empty(t, answerTransceiver.HeaderExtensions())
+
+	addExtMaps := func(desc SessionDescription, extMaps string) SessionDescription {
+		desc.SDP = strings.Replace(desc.SDP, "a=mid:0\r\n", "a=mid:0\r\n"+extMaps, 1)
+		return desc
+	}
+
+	offer, err := pcOffer.CreateOffer(nil)
+	require.NoError(t, err)
+	require.NoError(t, pcOffer.SetLocalDescription(offer))
+
+	// The answerer uses the IDs of the offer
+	require.NoError(t, pcAnswer.SetRemoteDescription(addExtMaps(offer,
+		"a=extmap:3 http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time\r\n"+
+			"a=extmap:4 urn:ietf:params:rtp-hdrext:sdes:mid\r\n"+
+			"a=extmap:10 urn:ietf:params:rtp-hdrext:sdes:rtp-stream-id\r\n")))
+	answer, err := pcAnswer.CreateAnswer(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []RTPHeaderExtensionParameters{
+		{URI: "http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time", ID: 3},
+		{URI: "urn:ietf:params:rtp-hdrext:sdes:mid", ID: 4},
+		{URI: "urn:ietf:params:rtp-hdrext:sdes:rtp-stream-id", ID: 10},
+	}, answerTransceiver.HeaderExtensions())
+
+	// The offerer uses the IDs of the answer
+	assert.Empty(t, offerTransceiver.HeaderExtensions())
+	require.NoError(t, pcOffer.SetRemoteDescription(addExtMaps(answer,
+		"a=extmap:5 urn:ietf:params:rtp-hdrext:sdes:mid\r\n")))
+	assert.Equal(t, []RTPHeaderExtensionParameters{
+		{URI: "urn:ietf:params:rtp-hdrext:sdes:mid", ID: 5},
+	}, offerTransceiver.HeaderExtensions())
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestPeerConnection_OnSSRCCollision(t *testing.T) {
+	pcOffer, pcAnswer, err := newPair()
+	require.NoError(t, err)
+
+	for _, ssrc := range []uint32{1000, 2000, 3000} {
+		track, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, ssrc, "video", "pion")
+		require.NoError(t, err)
+		_, err = pcOffer.AddTrack(track)
+		require.NoError(t, err)
+	}
+
+	// The answerer sends with a SSRC of the offerer
+	local, err := pcAnswer.NewTrack(DefaultPayloadTypeVP8, 3000, "video", "pion")
+	require.NoError(t, err)
+	_, err = pcAnswer.AddTrack(local)
+	require.NoError(t, err)
+
+	collisions := make(chan uint32, 2)
+	pcAnswer.OnSSRCCollision(func(ssrc uint32) {
+		collisions <- ssrc
+	})
+
+	// Two tracks of the offer use the same SSRC
+	offer, err := pcOffer.CreateOffer(nil)
+	require.NoError(t, err)
+	offer.SDP = strings.Replace(offer.SDP, "a=ssrc:2000 ", "a=ssrc:1000 ", -1)
+	require.NoError(t, pcAnswer.SetRemoteDescription(offer))
+
+	assert.ElementsMatch(t, []uint32{1000, 3000}, []uint32{<-collisions, <-collisions})
+
+	// The colliding SSRC isn't announced as a track
+	_, ok := trackDetailsFromSDP(pcAnswer.log, pcAnswer.RemoteDescription().parsed)[1000]
+	assert.False(t, ok)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestPeerConnection_Media_InactiveOffer(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	pcOffer, pcAnswer, err := newPair()
+	require.NoError(t, err)
+
+	var senders []*RTPSender
+	var tracks []*Track
+	for _, pc := range []*PeerConnection{pcOffer, pcAnswer} {
+		track, err := pc.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+		require.NoError(t, err)
+		sender, err := pc.AddTrack(track)
+		require.NoError(t, err)
+
+		pc.OnTrack(func(*Track, *RTPReceiver) {
+			t.Error("OnTrack must not fire for an inactive media section")
+		})
+		senders = append(senders, sender)
+		tracks = append(tracks, track)
+	}
+
+	dataChannelOpened := make(chan struct{})
+	pcAnswer.OnDataChannel(func(d *DataChannel) {
+		d.OnOpen(func() {
+			close(dataChannelOpened)
+		})
+	})
+	_, err = pcOffer.CreateDataChannel("initial_data_channel", nil)
+	require.NoError(t, err)
+
+	offer, err := pcOffer.CreateOffer(nil)
+	require.NoError(t, err)
+	require.NoError(t, pcOffer.SetLocalDescription(offer))
+
+	// The video section comes before the application section
+	offer.SDP = strings.Replace(offer.SDP, "a=sendrecv", "a=inactive", 1)
+	require.NoError(t, pcAnswer.SetRemoteDescription(offer))
+
+	answer, err := pcAnswer.CreateAnswer(nil)
+	require.NoError(t, err)
+	assert.Contains(t, answer.SDP, "a=inactive")
+	require.NoError(t, pcAnswer.SetLocalDescription(answer))
+	require.NoError(t, pcOffer.SetRemoteDescription(answer))
+
+	// The RTPSenders would have been started before SCTP
+	<-dataChannelOpened
+	for i, sender := range senders {
+		assert.False(t, sender.hasSent())
+		assert.NoError(t, tracks[i].WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+	}
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestSettingEngine_SetPacketTracer(t *testing.T) {
+	var mu sync.Mutex
+	var traces []PacketTrace
+
+	s := SettingEngine{}
+	s.SetPacketTracer(func(trace PacketTrace) {
+		mu.Lock()
+		defer mu.Unlock()
+		traces = append(traces, trace)
+	})
+	pcOffer, pcAnswer, local, remote := connectTrackPairWithAPI(t, NewAPI(WithSettingEngine(s)))
+	assert.NoError(t, local.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+	assert.NoError(t, pcAnswer.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: remote.SSRC()}}))
+
+	// Both PeerConnections share the tracer, so each packet is traced when it
+	// is sent and when it is received
+	traced := func(outbound bool, rtcpTrace bool) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, trace := range traces {
+			if trace.Outbound != outbound {
+				continue
+			}
+			if !rtcpTrace && trace.RTP != nil && trace.RTP.SSRC == local.SSRC() {
+				return true
+			}
+			if rtcpTrace && len(trace.RTCP) == 1 {
+				if pli, ok := trace.RTCP[0].(*rtcp.PictureLossIndication); ok && pli.MediaSSRC == local.SSRC() {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, outbound := range []bool{true, false} {
+		assert.Eventually(t, func() bool { return traced(outbound, false) }, time.Second, 10*time.Millisecond, "RTP outbound: %t", outbound)
+		assert.Eventually(t, func() bool { return traced(outbound, true) }, time.Second, 10*time.Millisecond, "RTCP outbound: %t", outbound)
+	}
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// constantSource is a rand.Source that always returns the same value
+type constantSource int64
+
+func (s constantSource) Int63() int64 { return int64(s) }
+func (s constantSource) Seed(int64)   {}
+
+func TestSettingEngine_SetRTCPReportInterval(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	countReports := func(t *testing.T, s SettingEngine) int {
+		var mu sync.Mutex
+		reports := 0
+		s.SetPacketTracer(func(trace PacketTrace) {
+			for _, p := range trace.RTCP {
+				if _, ok := p.(*rtcp.SenderReport); ok && trace.Outbound {
+					mu.Lock()
+					reports++
+					mu.Unlock()
+				}
+			}
+		})
+		pcOffer, pcAnswer, local, _ := connectTrackPairWithAPI(t, NewAPI(WithSettingEngine(s)))
+
+		mu.Lock()
+		reports = 0
+		mu.Unlock()
+		for end := time.Now().Add(time.Second); time.Now().Before(end); time.Sleep(20 * time.Millisecond) {
+			assert.NoError(t, local.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+		}
+
+		assert.NoError(t, pcOffer.Close())
+		assert.NoError(t, pcAnswer.Close())
+
+		mu.Lock()
+		defer mu.Unlock()
+		return reports
+	}
+
+	t.Run("Interval", func(t *testing.T) {
+		s := SettingEngine{}
+		s.SetRTCPReportInterval(100 * time.Millisecond)
+		s.DisableRTCPReportRandomization(true)
+		reports := countReports(t, s)
+		assert.True(t, reports >= 8 && reports <= 11, "reports: %d", reports)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		s := SettingEngine{}
+		s.SetRTCPReportInterval(100 * time.Millisecond)
+		s.DisableRTCPReports(true)
+		assert.Equal(t, 0, countReports(t, s))
+	})
+
+	t.Run("Randomized", func(t *testing.T) {
+		s := SettingEngine{}
+		s.SetRTCPReportInterval(time.Second)
+		for i := 0; i < 100; i++ {
+			delay := s.rtcpReportDelay()
+			assert.True(t, delay >= 500*time.Millisecond && delay <= 1500*time.Millisecond, "delay: %s", delay)
+		}
+
+		// The default interval is long enough to overflow 64bit integer math
+		s.SetRTCPReportInterval(0)
+		for i := 0; i < 1000; i++ {
+			delay := s.rtcpReportDelay()
+			assert.True(t, delay >= defaultRTCPReportInterval/2 && delay <= defaultRTCPReportInterval*3/2, "delay: %s", delay)
+		}
+
+		// The largest random value gives the longest delay
+		s.SetRandomSource(constantSource(math.MaxInt64))
+		delay := s.rtcpReportDelay()
+		assert.True(t, delay > defaultRTCPReportInterval*3/2-time.Millisecond, "delay: %s", delay)
+
+		s.SetRTCPReportInterval(time.Second)
+		s.DisableRTCPReportRandomization(true)
+		assert.Equal(t, time.Second, s.rtcpReportDelay())
+	})
+}
+
+func TestSettingEngine_SetCNAME(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	for _, cname := range []string{"", "pion-cname"} {
+		sdesCNAMEs := make(chan string, 10)
+		s := SettingEngine{}
+		s.SetCNAME(cname)
+		s.SetRTCPReportInterval(50 * time.Millisecond)
+		s.SetPacketTracer(func(trace PacketTrace) {
+			if !trace.Outbound || len(trace.RTCP) != 2 {
+				return
+			}
+			// Sender Reports are followed by a Source Description
+			if _, ok := trace.RTCP[0].(*rtcp.SenderReport); !ok {
+				return
+			}
+			if sdes, ok := trace.RTCP[1].(*rtcp.SourceDescription); ok {
+				for _, item := range sdes.Chunks[0].Items {
+					if item.Type == rtcp.SDESCNAME {
+						select {
+						case sdesCNAMEs <- item.Text:
+						default:
+						}
+					}
+				}
+			}
+		})
+		pcOffer, pcAnswer, local, _ := connectTrackPairWithAPI(t, NewAPI(WithSettingEngine(s)))
+
+		expected := cname
+		if expected == "" {
+			expected = local.Label()
+		}
+		assert.Contains(t, pcOffer.LocalDescription().SDP, fmt.Sprintf("a=ssrc:%d cname:%s\r\n", local.SSRC(), expected))
+		assert.Equal(t, expected, <-sdesCNAMEs)
+
+		assert.NoError(t, pcOffer.Close())
+		assert.NoError(t, pcAnswer.Close())
+	}
+}
+
+func TestPeerConnection_AddTrack_Invalid(t *testing.T) {
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+
+	_, err := pcOffer.AddTrack(local)
+	assert.Equal(t, &rtcerr.InvalidAccessError{Err: ErrExistingTrack}, err)
+
+	_, err = pcAnswer.AddTrack(remote)
+	assert.Equal(t, &rtcerr.InvalidAccessError{Err: ErrRemoteTrack}, err)
+
+	// A removed Track can be added again
+	for _, sender := range pcOffer.GetSenders() {
+		if sender.Track() == local {
+			assert.NoError(t, pcOffer.RemoveTrack(sender))
+		}
+	}
+	_, err = pcOffer.AddTrack(local)
+	assert.NoError(t, err)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestPeerConnection_NewTrack_SSRCInUse(t *testing.T) {
+	pc, err := NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+
+	first, err := pc.NewTrack(DefaultPayloadTypeVP8, 1000, "video", "first")
+	require.NoError(t, err)
+
+	// The SSRC is free until the Track is added
+	second, err := pc.NewTrack(DefaultPayloadTypeVP8, 1000, "video", "second")
+	require.NoError(t, err)
+
+	_, err = pc.AddTrack(first)
+	require.NoError(t, err)
+
+	_, err = pc.NewTrack(DefaultPayloadTypeOpus, 1000, "audio", "third")
+	assert.Equal(t, ErrSSRCInUse, err)
+	_, err = pc.NewTrackWithClockRate(DefaultPayloadTypeVP8, 1000, "video", "third", 90000)
+	assert.Equal(t, ErrSSRCInUse, err)
+
+	_, err = pc.AddTrack(second)
+	assert.Equal(t, &rtcerr.InvalidAccessError{Err: ErrSSRCInUse}, err)
+
+	assert.NoError(t, pc.Close())
+}
+
+func TestRTPTransceiver_PayloadTypes(t *testing.T) {
+	pcOffer, err := NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+
+	m := MediaEngine{}
+	m.RegisterCodec(NewRTPVP8Codec(100, 90000))
+	pcAnswer, err := NewAPI(WithMediaEngine(m)).NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+
+	offerTransceiver, err := pcOffer.AddTransceiverFromKind(RTPCodecTypeVideo)
+	require.NoError(t, err)
+	answerTransceiver, err := pcAnswer.AddTransceiverFromKind(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	require.NoError(t, err)
+	assert.Empty(t, offerTransceiver.PayloadTypes())
+
+	require.NoError(t, signalPair(pcOffer, pcAnswer))
+
+	// Both sides use the PayloadType of the answer, even though the offer had VP8 at another one
+	answer := pcOffer.RemoteDescription().parsed
+	var formats []string
+	for _, media := range answer.MediaDescriptions {
+		if media.MediaName.Media == "video" {
+			formats = media.MediaName.Formats
+		}
+	}
+	assert.Equal(t, []string{"100"}, formats)
+
+	for _, transceiver := range []*RTPTransceiver{offerTransceiver, answerTransceiver} {
+		payloadTypes := transceiver.PayloadTypes()
+		require.Len(t, payloadTypes, 1)
+		require.NotNil(t, payloadTypes[100])
+		assert.Equal(t, VP8, payloadTypes[100].Name)
+		assert.Equal(t, uint8(100), payloadTypes[100].PayloadType)
+	}
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestPeerConnection_KeyframeRequestOnReconnect(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	s := SettingEngine{}
+	s.SetKeyframeRequestOnReconnect(true)
+	pcOffer, pcAnswer, local, _ := connectTrackPairWithAPI(t, NewAPI(WithSettingEngine(s)))
+
+	var sender *RTPSender
+	for _, s := range pcOffer.GetSenders() {
+		if s.Track() == local {
+			sender = s
+		}
+	}
+	require.NotNil(t, sender)
+
+	keyframeRequested := make(chan struct{}, 1)
+	sender.OnKeyframeRequest(func() {
+		select {
+		case keyframeRequested <- struct{}{}:
+		default:
+		}
+	})
+
+	// Connecting initially doesn't request a keyframe
+	pcAnswer.onICEConnectionStateChange(ICEConnectionStateConnected)
+	select {
+	case <-keyframeRequested:
+		t.Fatal("keyframe requested without a reconnect")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	pcAnswer.onICEConnectionStateChange(ICEConnectionStateDisconnected)
+	pcAnswer.onICEConnectionStateChange(ICEConnectionStateConnected)
+	<-keyframeRequested
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestPeerConnection_Media_AnswerSSRCs(t *testing.T) {
+	pcOffer, pcAnswer, err := newPair()
+	require.NoError(t, err)
+
+	for _, kind := range []RTPCodecType{RTPCodecTypeAudio, RTPCodecTypeVideo} {
+		_, err = pcOffer.AddTransceiverFromKind(kind, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+		require.NoError(t, err)
+	}
+
+	offer, err := pcOffer.CreateOffer(nil)
+	require.NoError(t, err)
+	require.NoError(t, pcAnswer.SetRemoteDescription(offer))
+
+	// The SSRCs of the Tracks the answer sends are chosen by the caller
+	ssrcs := map[uint8]uint32{DefaultPayloadTypeOpus: 0x1000, DefaultPayloadTypeVP8: 0x2000}
+	for payloadType, ssrc := range ssrcs {
+		track, err := pcAnswer.NewTrack(payloadType, ssrc, fmt.Sprintf("track-%d", ssrc), "recording")
+		require.NoError(t, err)
+		_, err = pcAnswer.AddTrack(track)
+		require.NoError(t, err)
+	}
+
+	answer, err := pcAnswer.CreateAnswer(nil)
+	require.NoError(t, err)
+	for _, ssrc := range ssrcs {
+		assert.Contains(t, answer.SDP, fmt.Sprintf("a=ssrc:%d cname:recording\r\n", ssrc))
+		assert.Contains(t, answer.SDP, fmt.Sprintf("a=ssrc:%d msid:recording track-%d\r\n", ssrc, ssrc))
+	}
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestPeerConnection_Media_RemoveTrack(t *testing.T) {
+	pcOffer, pcAnswer, err := newPair()
+	require.NoError(t, err)
+
+	track, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, 0x3000, "video", "pion")
+	require.NoError(t, err)
+	sender, err := pcOffer.AddTrack(track)
+	require.NoError(t, err)
+
+	require.NoError(t, signalPair(pcOffer, pcAnswer))
+
+	negotiationNeeded := make(chan struct{})
+	pcOffer.OnNegotiationNeeded(func() {
+		close(negotiationNeeded)
+	})
+
+	require.NoError(t, pcOffer.RemoveTrack(sender))
+	<-negotiationNeeded
+
+	transceivers := pcOffer.GetTransceivers()
+	require.Len(t, transceivers, 1)
+	assert.Nil(t, transceivers[0].Sender())
+	assert.Equal(t, RTPTransceiverDirectionRecvonly, transceivers[0].Direction())
+
+	offer, err := pcOffer.CreateOffer(nil)
+	require.NoError(t, err)
+	assert.NotContains(t, offer.SDP, "a=ssrc:12288 ")
+
+	// The video section keeps its mid and only changes direction
+	video := offer.SDP[strings.Index(offer.SDP, "m=video"):strings.Index(offer.SDP, "m=application")]
+	assert.Contains(t, video, "a=mid:0\r\n")
+	assert.Contains(t, video, "a=recvonly\r\n")
+	assert.Equal(t, 1, strings.Count(offer.SDP, "m=video"))
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestRTPTransceiver_SetDirection(t *testing.T) {
+	pcOffer, pcAnswer, local, _ := connectTrackPair(t)
+
+	negotiationNeeded := make(chan struct{}, 2)
+	pcOffer.OnNegotiationNeeded(func() {
+		negotiationNeeded <- struct{}{}
+	})
+
+	transceivers := pcOffer.GetTransceivers()
+	require.Len(t, transceivers, 1)
+	transceiver := transceivers[0]
+	sender := transceiver.Sender()
+
+	assert.Error(t, transceiver.SetDirection(RTPTransceiverDirection(Unknown)))
+	require.NoError(t, transceiver.SetDirection(RTPTransceiverDirectionRecvonly))
+	<-negotiationNeeded
+
+	offer, err := pcOffer.CreateOffer(nil)
+	require.NoError(t, err)
+	video := offer.SDP[strings.Index(offer.SDP, "m=video"):strings.Index(offer.SDP, "m=application")]
+	assert.Contains(t, video, "a=recvonly\r\n")
+
+	// Nothing is sent while the direction doesn't include sending
+	sender.stats.Lock()
+	packetsSent := sender.stats.packetsSent
+	sender.stats.Unlock()
+	assert.NoError(t, local.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+	sender.stats.Lock()
+	assert.Equal(t, packetsSent, sender.stats.packetsSent)
+	sender.stats.Unlock()
+
+	require.NoError(t, transceiver.SetDirection(RTPTransceiverDirectionSendrecv))
+	<-negotiationNeeded
+	offer, err = pcOffer.CreateOffer(nil)
+	require.NoError(t, err)
+	video = offer.SDP[strings.Index(offer.SDP, "m=video"):strings.Index(offer.SDP, "m=application")]
+	assert.Contains(t, video, "a=sendrecv\r\n")
+
+	assert.NoError(t, local.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+	sender.stats.Lock()
+	assert.Equal(t, packetsSent+1, sender.stats.packetsSent)
+	sender.stats.Unlock()
+
+	// A transceiver without a RTPSender can't start sending
+	recvonly, err := pcAnswer.AddTransceiverFromKind(RTPCodecTypeAudio, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	require.NoError(t, err)
+	assert.Error(t, recvonly.SetDirection(RTPTransceiverDirectionSendonly))
+	assert.NoError(t, recvonly.SetDirection(RTPTransceiverDirectionInactive))
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestRTPTransceiver_SetCodecPreferences(t *testing.T) {
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pc, err := api.NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+
+	camera, err := pc.AddTransceiverFromKind(RTPCodecTypeVideo)
+	require.NoError(t, err)
+	screen, err := pc.AddTransceiverFromKind(RTPCodecTypeVideo)
+	require.NoError(t, err)
+
+	vp8, err := api.mediaEngine.getCodec(DefaultPayloadTypeVP8)
+	require.NoError(t, err)
+	h264, err := api.mediaEngine.getCodec(DefaultPayloadTypeH264)
+	require.NoError(t, err)
+	opus, err := api.mediaEngine.getCodec(DefaultPayloadTypeOpus)
+	require.NoError(t, err)
+
+	assert.NoError(t, camera.SetCodecPreferences([]*RTPCodec{vp8, h264}))
+	assert.NoError(t, screen.SetCodecPreferences([]*RTPCodec{h264, vp8}))
+
+	// Only registered codecs of the kind of the RTPTransceiver can be preferred
+	assert.Error(t, camera.SetCodecPreferences([]*RTPCodec{opus}))
+	assert.Equal(t, ErrUnregisteredPayloadType, camera.SetCodecPreferences([]*RTPCodec{NewRTPH264Codec(120, 90000)}))
+
+	formats := func() [][]string {
+		offer, err := pc.CreateOffer(nil)
+		require.NoError(t, err)
+		parsed := sdp.SessionDescription{}
+		require.NoError(t, parsed.Unmarshal([]byte(offer.SDP)))
+
+		formats := [][]string{}
+		for _, media := range parsed.MediaDescriptions {
+			formats = append(formats, media.MediaName.Formats)
+		}
+		return formats
+	}
+	assert.Equal(t, [][]string{
+		{strconv.Itoa(DefaultPayloadTypeVP8), strconv.Itoa(DefaultPayloadTypeH264)},
+		{strconv.Itoa(DefaultPayloadTypeH264), strconv.Itoa(DefaultPayloadTypeVP8)},
+	}, formats()[:2])
+
+	// An empty list restores the codecs of the MediaEngine
+	assert.NoError(t, screen.SetCodecPreferences(nil))
+	assert.Len(t, formats()[1], len(api.mediaEngine.GetCodecsByKind(RTPCodecTypeVideo)))
+
+	assert.NoError(t, pc.Close())
+}
+
+func TestPeerConnection_Media_EarlyMedia(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, pcAnswer, err := api.newPair(Configuration{})
+	require.NoError(t, err)
+
+	_, err = pcAnswer.AddTransceiverFromKind(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	require.NoError(t, err)
+	local, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, 0x4000, "video", "pion")
+	require.NoError(t, err)
+	sender, err := pcOffer.AddTrack(local)
+	require.NoError(t, err)
+
+	remoteTracks := make(chan *Track, 1)
+	pcAnswer.OnTrack(func(track *Track, r *RTPReceiver) {
+		remoteTracks <- track
+	})
+
+	offerGathered := make(chan struct{})
+	pcOffer.OnICECandidate(func(c *ICECandidate) {
+		if c == nil {
+			close(offerGathered)
+		}
+	})
+	offer, err := pcOffer.CreateOffer(nil)
+	require.NoError(t, err)
+	require.NoError(t, pcOffer.SetLocalDescription(offer))
+	<-offerGathered
+
+	// The offerer starts sending once it has the answer, which the answerer
+	// only applies after the media has arrived
+	require.NoError(t, pcAnswer.SetRemoteDescription(*pcOffer.LocalDescription()))
+	answer, err := pcAnswer.CreateAnswer(nil)
+	require.NoError(t, err)
+	require.NoError(t, pcOffer.SetRemoteDescription(answer))
+	<-sender.sendCalled
+
+	writePacket := func(i byte) {
+		assert.NoError(t, local.WriteRTP(&rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    DefaultPayloadTypeVP8,
+				SSRC:           local.SSRC(),
+				SequenceNumber: uint16(i),
+			},
+			Payload: []byte{i},
+		}))
+	}
+
+	// Packets written before the SRTP session of the answerer is ready are lost,
+	// the first one that arrives determines the PayloadType
+	receiver := pcAnswer.GetTransceivers()[0].Receiver()
+	last := byte(0)
+	for ; receiver.Track().PayloadType() == 0; last++ {
+		writePacket(last)
+		time.Sleep(20 * time.Millisecond)
+	}
+	writePacket(last)
+
+	select {
+	case <-remoteTracks:
+		t.Fatal("OnTrack fired before SetLocalDescription")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, pcAnswer.SetLocalDescription(answer))
+	remote := <-remoteTracks
+	first, err := remote.ReadRTP()
+	require.NoError(t, err)
+	require.Less(t, first.Payload[0], last)
+	for i := first.Payload[0] + 1; i <= last; i++ {
+		p, err := remote.ReadRTP()
+		require.NoError(t, err)
+		assert.Equal(t, []byte{i}, p.Payload)
+	}
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// readAfterWrites writes packets with the given offsets from the last sequence
+// number sent over a new connection, and returns the payloads read, which are
+// the indexes of the packets
+func readAfterWrites(t *testing.T, s SettingEngine, offsets []uint16) []byte {
+	pcOffer, pcAnswer, local, remote := connectTrackPairWithAPI(t, NewAPI(WithSettingEngine(s)))
+	drainTrack(t, remote)
+
+	sequenceNumber := local.Stats().LastSequenceNumber
+	for i, offset := range offsets {
+		assert.NoError(t, local.WriteRTP(&rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    local.PayloadType(),
+				SSRC:           local.SSRC(),
+				SequenceNumber: sequenceNumber + offset,
+			},
+			Payload: []byte{byte(i)},
+		}))
+	}
+
+	var payloads []byte
+	for len(payloads) == 0 || int(payloads[len(payloads)-1]) != len(offsets)-1 {
+		p, err := remote.ReadRTP()
+		require.NoError(t, err)
+		payloads = append(payloads, p.Payload[0])
+	}
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+	return payloads
+}
+
+func TestSettingEngine_SetSRTPReplayProtectionWindow(t *testing.T) {
+	// The second packet is reordered by 299
+	offsets := []uint16{300, 1, 301}
+
+	t.Run("Default", func(t *testing.T) {
+		assert.Equal(t, []byte{0, 2}, readAfterWrites(t, SettingEngine{}, offsets))
+	})
+
+	t.Run("Window", func(t *testing.T) {
+		s := SettingEngine{}
+		s.SetSRTPReplayProtectionWindow(512)
+		assert.Equal(t, []byte{0, 1, 2}, readAfterWrites(t, s, offsets))
+	})
+}
+
+func TestSettingEngine_DisableSRTPReplayProtection(t *testing.T) {
+	// The second packet is a replay of the first
+	offsets := []uint16{1, 1, 2}
+
+	t.Run("Default", func(t *testing.T) {
+		assert.Equal(t, []byte{0, 2}, readAfterWrites(t, SettingEngine{}, offsets))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		s := SettingEngine{}
+		s.DisableSRTPReplayProtection(true)
+		assert.Equal(t, []byte{0, 1, 2}, readAfterWrites(t, s, offsets))
+	})
+}
+
+func TestRTPSender_SetParameters(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	var mu sync.Mutex
+	var sequenceNumbers []uint16
+	var localSSRC uint32
+
+	s := SettingEngine{}
+	s.SetPacketTracer(func(trace PacketTrace) {
+		mu.Lock()
+		defer mu.Unlock()
+		if trace.Outbound && trace.RTP != nil && trace.RTP.SSRC == localSSRC {
+			sequenceNumbers = append(sequenceNumbers, trace.RTP.SequenceNumber)
+		}
+	})
+	pcOffer, pcAnswer, local, _ := connectTrackPairWithAPI(t, NewAPI(WithSettingEngine(s)))
+	sender := pcOffer.GetSenders()[0]
+
+	parameters := sender.GetParameters()
+	assert.Equal(t, local.SSRC(), parameters.Encodings.SSRC)
+	assert.Equal(t, uint64(0), parameters.Encodings.MaxBitrate)
+
+	invalid := parameters
+	invalid.Encodings.SSRC++
+	assert.Error(t, sender.SetParameters(invalid))
+
+	parameters.Encodings.MaxBitrate = 80000
+	assert.NoError(t, sender.SetParameters(parameters))
+	assert.Equal(t, uint64(80000), sender.GetParameters().Encodings.MaxBitrate)
+
+	// 100KB are written within a second, one packet per sample. Only the
+	// 10KB a second allows and the 10KB the sender may start with are sent.
+	mu.Lock()
+	localSSRC = local.SSRC()
+	mu.Unlock()
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, local.WriteSample(media.Sample{Data: make([]byte, 1000), Samples: 1}))
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	sent := append([]uint16{}, sequenceNumbers...)
+	mu.Unlock()
+	assert.True(t, len(sent) >= 10 && len(sent) <= 25, "packets sent: %d", len(sent))
+	for i := 1; i < len(sent); i++ {
+		assert.Equal(t, sent[i-1]+1, sent[i])
+	}
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestRTPSender_MaxBitrateDropsWholeFrames(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+	sender := pcOffer.GetSenders()[0]
+
+	var mu sync.Mutex
+	var received []*rtp.Packet
+	go func() {
+		for {
+			p, err := remote.ReadRTP()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			received = append(received, p)
+			mu.Unlock()
+		}
+	}()
+
+	parameters := sender.GetParameters()
+	parameters.Encodings.MaxBitrate = 80000
+	assert.NoError(t, sender.SetParameters(parameters))
+
+	// Frames of 3000 bytes are split into several packets, the budget runs out
+	// in the middle of a frame
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, local.WriteSample(media.Sample{Data: make([]byte, 3000), Samples: 90}))
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	mu.Lock()
+	packets := append([]*rtp.Packet{}, received...)
+	mu.Unlock()
+	require.NotEmpty(t, packets)
+
+	// Every frame that arrives starts with the start of a VP8 partition and
+	// ends with the marker bit, without gaps in between
+	frames := 0
+	for i, p := range packets {
+		if i > 0 {
+			assert.Equal(t, packets[i-1].SequenceNumber+1, p.SequenceNumber)
+		}
+		if i == 0 || packets[i-1].Timestamp != p.Timestamp {
+			frames++
+			assert.NotZero(t, p.Payload[0]&0x10, "frame %d doesn't start with its first packet", p.Timestamp)
+		}
+		if i == len(packets)-1 || packets[i+1].Timestamp != p.Timestamp {
+			assert.True(t, p.Marker, "frame %d doesn't end with its last packet", p.Timestamp)
+		}
+	}
+	assert.Less(t, frames, 50)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestRTPSender_MaxBitrateWaitsForKeyframe(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+	sender := pcOffer.GetSenders()[0]
+
+	var keyframeRequested, keyframeRequests int32
+	sender.OnKeyframeRequest(func() {
+		atomic.AddInt32(&keyframeRequests, 1)
+		atomic.StoreInt32(&keyframeRequested, 1)
+	})
+
+	var mu sync.Mutex
+	var received []*rtp.Packet
+	go func() {
+		for {
+			p, err := remote.ReadRTP()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			received = append(received, p)
+			mu.Unlock()
+		}
+	}()
+
+	parameters := sender.GetParameters()
+	parameters.Encodings.MaxBitrate = 80000
+	assert.NoError(t, sender.SetParameters(parameters))
+
+	// Delta frames follow the first keyframe, the next keyframe is only
+	// written once one was requested
+	for i := 0; i < 100; i++ {
+		data := make([]byte, 3000)
+		if i > 0 && atomic.SwapInt32(&keyframeRequested, 0) == 0 {
+			data[0] = 0x01
+		}
+		assert.NoError(t, local.WriteSample(media.Sample{Data: data, Samples: 90}))
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	mu.Lock()
+	packets := append([]*rtp.Packet{}, received...)
+	mu.Unlock()
+	require.NotEmpty(t, packets)
+
+	// The receiver can decode every frame that arrives: it is a keyframe or
+	// the frame that directly follows the previous one
+	frames := 0
+	for i, p := range packets {
+		if i > 0 && packets[i-1].Timestamp == p.Timestamp {
+			continue
+		}
+		frames++
+		if i > 0 && !isKeyframe(VP8, p.Payload) {
+			assert.Equal(t, packets[i-1].Timestamp+90, p.Timestamp, "frame %d references a dropped frame", p.Timestamp)
+		}
+	}
+	assert.Less(t, frames, 100)
+	assert.NotZero(t, atomic.LoadInt32(&keyframeRequests))
+	assert.Less(t, packets[0].Timestamp+90*uint32(frames-1), packets[len(packets)-1].Timestamp, "no frames arrived after the first drop")
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestSettingEngine_SetPacerBitrate(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	var mu sync.Mutex
+	var sentAt []time.Time
+	var localSSRC uint32
+
+	s := SettingEngine{}
+	s.SetPacerBitrate(80000)
+	s.SetPacketTracer(func(trace PacketTrace) {
+		mu.Lock()
+		defer mu.Unlock()
+		if trace.Outbound && trace.RTP != nil && trace.RTP.SSRC == localSSRC {
+			sentAt = append(sentAt, time.Now())
+		}
+	})
+	pcOffer, pcAnswer, local, _ := connectTrackPairWithAPI(t, NewAPI(WithSettingEngine(s)))
+	sender := pcOffer.GetSenders()[0]
+
+	// A burst of packets of 1000 bytes, at 80 kbit/s they leave every 100ms
+	mu.Lock()
+	localSSRC = local.SSRC()
+	mu.Unlock()
+	for i := 0; i < 5; i++ {
+		p := local.Packetizer().Packetize([]byte{0x00}, 1)[0]
+		p.Payload = make([]byte, 1000-p.Header.MarshalSize())
+		assert.NoError(t, local.WriteRTP(p))
+	}
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sentAt) == 5
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	for i := 1; i < len(sentAt); i++ {
+		spacing := sentAt[i].Sub(sentAt[i-1])
+		assert.True(t, spacing >= 90*time.Millisecond && spacing <= 150*time.Millisecond, "spacing: %s", spacing)
+	}
+	mu.Unlock()
+
+	// The pacer stays within the configured bitrate and the estimate of the remote
+	remb := func(bitrate uint64) {
+		assert.NoError(t, pcOffer.InjectRTCP([]rtcp.Packet{&rtcp.ReceiverEstimatedMaximumBitrate{Bitrate: bitrate, SSRCs: []uint32{local.SSRC()}}}))
+	}
+	remb(1000000)
+	assert.Equal(t, uint64(80000), sender.pacer.getBitrate())
+	remb(10000)
+	assert.Equal(t, uint64(25000), sender.pacer.getBitrate())
+
+	assert.NoError(t, sender.SetPacerBitrate(160000))
+	assert.Equal(t, uint64(25000), sender.pacer.getBitrate())
+	remb(1000000)
+	assert.Equal(t, uint64(160000), sender.pacer.getBitrate())
+	assert.Error(t, sender.SetPacerBitrate(0))
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestRTPTransceiver_SetSimulcastReceive(t *testing.T) {
+	api := NewAPI()
+	api.mediaEngine.RegisterCodec(NewRTPVP8Codec(DefaultPayloadTypeVP8, 90000))
+	pcOffer, pcAnswer, err := api.newPair(Configuration{})
+	assert.NoError(t, err)
+
+	track, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	assert.NoError(t, err)
+	_, err = pcOffer.AddTrack(track)
+	assert.NoError(t, err)
+	transceiver, err := pcAnswer.AddTransceiverFromKind(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	assert.NoError(t, err)
+
+	assert.Error(t, transceiver.SetSimulcastReceive([]RIDParameters{{ID: "f"}, {ID: "f"}}))
+	assert.Error(t, transceiver.SetSimulcastReceive([]RIDParameters{{ID: "f;h"}}))
+	assert.NoError(t, transceiver.SetSimulcastReceive([]RIDParameters{
+		{ID: "f", MaxWidth: 1280, MaxHeight: 720},
+		{ID: "h", MaxWidth: 640, MaxHeight: 360, Restrictions: map[string]string{"max-bpp": "1.5"}},
+		{ID: "q", MaxFPS: 15},
+	}))
+
+	// The offer announces the layers like a browser does
+	offer, err := pcOffer.CreateOffer(nil)
+	assert.NoError(t, err)
+	offer.SDP = strings.Replace(offer.SDP, "a=sendrecv\r\n", "a=extmap:4 urn:ietf:params:rtp-hdrext:sdes:rtp-stream-id\r\na=sendrecv\r\na=rid:f send\r\na=rid:h send\r\na=rid:q send\r\na=simulcast:send f;h;q\r\n", 1)
+	assert.NoError(t, pcAnswer.SetRemoteDescription(offer))
+
+	answer, err := pcAnswer.CreateAnswer(nil)
+	assert.NoError(t, err)
+
+	// The video section of the answer without the lines that differ every time
+	section := ""
+	inVideo := false
+	for _, line := range strings.Split(answer.SDP, "\r\n") {
+		if strings.HasPrefix(line, "m=") {
+			inVideo = strings.HasPrefix(line, "m=video")
+		}
+		if inVideo && !strings.HasPrefix(line, "a=ice-") && !strings.HasPrefix(line, "a=candidate") && !strings.HasPrefix(line, "a=end-of-candidates") {
+			section += line + "\n"
+		}
+	}
+	assert.Equal(t, `m=video 9 UDP/TLS/RTP/SAVPF 96
+c=IN IP4 0.0.0.0
+a=setup:passive
+a=mid:0
+a=rtcp-mux
+a=rtcp-rsize
+a=rtpmap:96 VP8/90000
+a=rtcp-fb:96 nack
+a=rtcp-fb:96 nack pli
+a=rtcp-fb:96 ccm fir
+a=rtcp-fb:96 goog-remb
+a=extmap:4 urn:ietf:params:rtp-hdrext:sdes:rtp-stream-id
+a=rid:f recv max-width=1280;max-height=720
+a=rid:h recv max-width=640;max-height=360;max-bpp=1.5
+a=rid:q recv max-fps=15
+a=simulcast:recv f;h;q
+a=recvonly
+`, section)
+
+	// The answer parses back into the layers, and the offerer accepts it
+	assert.NoError(t, pcAnswer.SetLocalDescription(answer))
+	rids := ridsFromSDP(pcAnswer.log, answer.parsed.MediaDescriptions[0])
+	assert.Equal(t, 3, len(rids))
+	assert.Equal(t, "recv", rids[0].Direction)
+	assert.Equal(t, uint32(360), rids[1].MaxHeight)
+	assert.Equal(t, "1.5", rids[1].Restrictions["max-bpp"])
+	assert.Equal(t, float64(15), rids[2].MaxFPS)
+	assert.NoError(t, pcOffer.SetRemoteDescription(answer))
+
+	closePairNow(t, pcOffer, pcAnswer)
+}
+
+func TestRTPSender_OnTransportCCFeedback(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	pcOffer, pcAnswer, local, _ := connectTrackPair(t)
+
+	received := make(chan TransportCCFeedback, 1)
+	pcOffer.GetSenders()[0].OnTransportCCFeedback(func(feedback TransportCCFeedback) {
+		received <- feedback
+	})
+
+	// Feedback for two packets, the first lost, the second received 1ms after the reference time
+	feedback := rtcp.RawPacket{
+		0x8F, 0xCD, 0x00, 0x05, // FMT 15, PT 205, length 5
+		0x00, 0x00, 0x00, 0x01, // sender SSRC
+		0x00, 0x00, 0x00, 0x02, // media SSRC
+		0x00, 0x0A, 0x00, 0x02, // base sequence number 10, 2 packets
+		0x00, 0x00, 0x01, 0x00, // reference time 64ms, feedback packet count 0
+		0x90, 0x00, // one bit vector: lost, received
+		0x04, 0x00, // receive delta 1ms, padding
+	}
+	assert.NoError(t, pcOffer.InjectRTCP([]rtcp.Packet{
+		&rtcp.ReceiverReport{SSRC: 1, Reports: []rtcp.ReceptionReport{{SSRC: local.SSRC()}}},
+		&feedback,
+	}))
+
+	decoded := <-received
+	assert.Equal(t, 64*time.Millisecond, decoded.ReferenceTime)
+	assert.Equal(t, []TransportCCPacketFeedback{
+		{SequenceNumber: 10},
+		{SequenceNumber: 11, Received: true, Delta: time.Millisecond, ArrivalTime: 65 * time.Millisecond},
+	}, decoded.Packets)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestPeerConnection_MirrorRemoteOffer(t *testing.T) {
+	const sdpOffer = `v=0
+o=- 6476616870435111971 2 IN IP4 127.0.0.1
+s=-
+t=0 0
+a=group:BUNDLE 0 1
+m=audio 9 UDP/TLS/RTP/SAVPF 109 103
+c=IN IP4 0.0.0.0
+a=ice-ufrag:sRIG
+a=ice-pwd:yZb5ZMsBlPoK577sGhjvEUtT
+a=fingerprint:sha-256 27:EF:25:BF:57:45:BC:1C:0D:36:42:FF:5E:93:71:D2:41:58:EA:46:FD:A8:2A:F3:13:94:6E:E6:43:23:CB:D7
+a=setup:actpass
+a=mid:0
+a=extmap:1 urn:ietf:params:rtp-hdrext:ssrc-audio-level
+a=sendonly
+a=rtcp-mux
+a=rtpmap:109 opus/48000/2
+a=fmtp:109 minptime=10;useinbandfec=1
+a=rtpmap:103 ISAC/16000
+m=video 9 UDP/TLS/RTP/SAVPF 120
+c=IN IP4 0.0.0.0
+a=ice-ufrag:sRIG
+a=ice-pwd:yZb5ZMsBlPoK577sGhjvEUtT
+a=fingerprint:sha-256 27:EF:25:BF:57:45:BC:1C:0D:36:42:FF:5E:93:71:D2:41:58:EA:46:FD:A8:2A:F3:13:94:6E:E6:43:23:CB:D7
+a=setup:actpass
+a=mid:1
+a=extmap:2 http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time
+a=extmap:5 urn:ietf:params:rtp-hdrext:sdes:rtp-stream-id
+a=sendonly
+a=rtcp-mux
+a=rtpmap:120 VP8/90000
+a=rid:f send max-width=1280;max-height=720
+a=rid:h send max-width=640;max-height=360
+a=simulcast:send f;h
+`
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pc, err := api.NewPeerConnection(Configuration{})
+	assert.NoError(t, err)
+
+	_, err = pc.MirrorRemoteOffer()
+	assert.Error(t, err)
+
+	assert.NoError(t, pc.SetRemoteDescription(SessionDescription{Type: SDPTypeOffer, SDP: sdpOffer}))
+	transceivers, err := pc.MirrorRemoteOffer()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(transceivers))
+	assert.Equal(t, transceivers, pc.GetTransceivers())
+	assert.Equal(t, "1", transceivers[1].getMid())
+
+	answer, err := pc.CreateAnswer(nil)
+	assert.NoError(t, err)
+
+	// The media sections of the answer without the lines that differ every time
+	sections := []string{}
+	for _, line := range strings.Split(answer.SDP, "\r\n") {
+		if strings.HasPrefix(line, "m=") {
+			sections = append(sections, "")
+		}
+		if len(sections) != 0 && line != "" && !strings.HasPrefix(line, "a=ice-") && !strings.HasPrefix(line, "a=candidate") &&
+			!strings.HasPrefix(line, "a=end-of-candidates") && !strings.HasPrefix(line, "a=fingerprint") && !strings.HasPrefix(line, "a=rtcp-fb") {
+			sections[len(sections)-1] += line + "\n"
+		}
+	}
+	assert.Equal(t, []string{`m=audio 9 UDP/TLS/RTP/SAVPF 109
+c=IN IP4 0.0.0.0
+a=setup:passive
+a=mid:0
+a=rtcp-mux
+a=rtcp-rsize
+a=rtpmap:109 opus/48000/2
+a=fmtp:109 minptime=10;useinbandfec=1
+a=extmap:1 urn:ietf:params:rtp-hdrext:ssrc-audio-level
+a=recvonly
+`, `m=video 9 UDP/TLS/RTP/SAVPF 120
+c=IN IP4 0.0.0.0
+a=setup:passive
+a=mid:1
+a=rtcp-mux
+a=rtcp-rsize
+a=rtpmap:120 VP8/90000
+a=extmap:2 http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time
+a=extmap:5 urn:ietf:params:rtp-hdrext:sdes:rtp-stream-id
+a=rid:f recv max-width=1280;max-height=720
+a=rid:h recv max-width=640;max-height=360
+a=simulcast:recv f;h
+a=recvonly
+`}, sections)
+
+	assert.NoError(t, pc.Close())
+	_, err = pc.MirrorRemoteOffer()
+	assert.Error(t, err)
+}
+
+func TestPeerConnection_MidlessOffer(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, pcAnswer, err := api.newPair(Configuration{})
+	assert.NoError(t, err)
+
+	track, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	assert.NoError(t, err)
+	_, err = pcOffer.AddTrack(track)
+	assert.NoError(t, err)
+	_, err = pcAnswer.AddTransceiverFromKind(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	assert.NoError(t, err)
+
+	onTrackFired := make(chan struct{})
+	pcAnswer.OnTrack(func(*Track, *RTPReceiver) {
+		close(onTrackFired)
+	})
+
+	gatherComplete := make(chan struct{})
+	pcOffer.OnICECandidate(func(candidate *ICECandidate) {
+		if candidate == nil {
+			close(gatherComplete)
+		}
+	})
+
+	// A legacy client sends neither a=mid nor a BUNDLE group
+	removeMids := func(sdp string) string {
+		lines := []string{}
+		for _, line := range strings.Split(sdp, "\r\n") {
+			if !strings.HasPrefix(line, "a=mid:") && !strings.HasPrefix(line, "a=group:BUNDLE") {
+				lines = append(lines, line)
+			}
+		}
+		return strings.Join(lines, "\r\n")
+	}
+
+	offer, err := pcOffer.CreateOffer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, pcOffer.SetLocalDescription(offer))
+	<-gatherComplete
+	assert.NoError(t, pcAnswer.SetRemoteDescription(SessionDescription{Type: SDPTypeOffer, SDP: removeMids(pcOffer.LocalDescription().SDP)}))
+
+	answer, err := pcAnswer.CreateAnswer(nil)
+	assert.NoError(t, err)
+	assert.Contains(t, answer.SDP, "a=mid:0\r\n")
+	assert.NoError(t, pcAnswer.SetLocalDescription(answer))
+	assert.NoError(t, pcOffer.SetRemoteDescription(SessionDescription{Type: SDPTypeAnswer, SDP: removeMids(answer.SDP)}))
+
+	func() {
+		for {
+			select {
+			case <-time.After(20 * time.Millisecond):
+				assert.NoError(t, track.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+			case <-onTrackFired:
+				return
+			}
+		}
+	}()
+
+	closePairNow(t, pcOffer, pcAnswer)
+}
+
+func TestRTPReceiver_OnFirstPacket(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	report := test.CheckRoutines(t)
+	defer report()
+
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, pcAnswer, err := api.newPair(Configuration{})
+	assert.NoError(t, err)
+
+	track, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	assert.NoError(t, err)
+	_, err = pcOffer.AddTrack(track)
+	assert.NoError(t, err)
+	transceiver, err := pcAnswer.AddTransceiverFromKind(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	assert.NoError(t, err)
+	receiver := transceiver.Receiver()
+
+	firstPacket := make(chan time.Time, 1)
+	receiver.OnFirstPacket(func(arrival time.Time) {
+		firstPacket <- arrival
+	})
+	assert.True(t, receiver.FirstPacketTime().IsZero())
+
+	onTrackFired := make(chan struct{})
+	pcAnswer.OnTrack(func(*Track, *RTPReceiver) {
+		// The first packet was read to fire OnTrack, so it has arrived already
+		assert.False(t, receiver.FirstPacketTime().IsZero())
+		close(onTrackFired)
+	})
+
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+	sendVideoUntilDone(onTrackFired, t, []*Track{track})
+
+	arrival := <-firstPacket
+	assert.Equal(t, arrival, receiver.FirstPacketTime())
+	assert.Equal(t, 0, len(firstPacket))
+
+	// A handler set later is called right away
+	receiver.OnFirstPacket(func(later time.Time) {
+		assert.Equal(t, arrival, later)
+		close(firstPacket)
+	})
+	_, ok := <-firstPacket
+	assert.False(t, ok)
+
+	closePairNow(t, pcOffer, pcAnswer)
+}
+
+func TestRTPSender_SetContributingSources(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+	sender := pcOffer.GetSenders()[0]
+	receiver := pcAnswer.GetReceivers()[0]
+
+	// sendAndRead writes a packet with the given CSRCs and returns the CSRCs it
+	// is read with, skipping the packets written while connecting
+	sendAndRead := func(csrc []uint32) []uint32 {
+		packets := local.Packetizer().Packetize([]byte{0xAA}, 1)
+		assert.Equal(t, 1, len(packets))
+		packets[0].CSRC = csrc
+		assert.NoError(t, local.WriteRTP(packets[0]))
+		for {
+			p, err := remote.ReadRTP()
+			require.NoError(t, err)
+			if p.SequenceNumber == packets[0].SequenceNumber {
+				return p.CSRC
+			}
+		}
+	}
+
+	assert.Equal(t, []uint32{1, 2}, sendAndRead([]uint32{1, 2}))
+	sources := receiver.GetContributingSources()
+	if assert.Equal(t, 2, len(sources)) {
+		assert.Equal(t, uint32(1), sources[0].Source)
+		assert.Equal(t, uint32(2), sources[1].Source)
+		assert.False(t, sources[1].Timestamp.IsZero())
+	}
+
+	// The RTPSender replaces or removes the CSRCs
+	assert.NoError(t, sender.SetContributingSources([]uint32{3}))
+	assert.Equal(t, []uint32{3}, sendAndRead([]uint32{1, 2}))
+	assert.NoError(t, sender.SetContributingSources([]uint32{}))
+	assert.Equal(t, []uint32{}, sendAndRead([]uint32{1, 2}))
+	assert.NoError(t, sender.SetContributingSources(nil))
+	assert.Equal(t, []uint32{4}, sendAndRead([]uint32{4}))
+	assert.Error(t, sender.SetContributingSources(make([]uint32, 16)))
+
+	assert.Equal(t, 4, len(receiver.GetContributingSources()))
+
+	closePairNow(t, pcOffer, pcAnswer)
+}
@@ -0,0 +1,93 @@
+// Package loopback signals PeerConnections in the same process, it replaces the
+// exchange of offers, answers and ICE candidates over a signaling server in
+// tests and examples
+package loopback
+
+import (
+	"sync"
+
+	"github.com/pion/webrtc/v2"
+)
+
+// Signal performs an offer/answer exchange from offerer to answerer and trickles
+// the ICE candidates of each PeerConnection to the other one. It replaces the
+// OnICECandidate handlers of both PeerConnections. Signal can be called again
+// to renegotiate.
+func Signal(offerer, answerer *webrtc.PeerConnection) error {
+	offerCandidates := trickle(offerer, answerer)
+	answerCandidates := trickle(answerer, offerer)
+
+	offer, err := offerer.CreateOffer(nil)
+	if err != nil {
+		return err
+	}
+	if err = offerer.SetLocalDescription(offer); err != nil {
+		return err
+	}
+	if err = answerer.SetRemoteDescription(offer); err != nil {
+		return err
+	}
+	if err = offerCandidates.start(); err != nil {
+		return err
+	}
+
+	answer, err := answerer.CreateAnswer(nil)
+	if err != nil {
+		return err
+	}
+	if err = answerer.SetLocalDescription(answer); err != nil {
+		return err
+	}
+	if err = offerer.SetRemoteDescription(answer); err != nil {
+		return err
+	}
+	return answerCandidates.start()
+}
+
+// candidates forwards the ICE candidates gathered by one PeerConnection to
+// another one, candidates gathered before the other PeerConnection has a
+// remote description are queued
+type candidates struct {
+	mu      sync.Mutex
+	to      *webrtc.PeerConnection
+	started bool
+	pending []webrtc.ICECandidateInit
+}
+
+func trickle(from, to *webrtc.PeerConnection) *candidates {
+	c := &candidates{to: to}
+	from.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		// A nil candidate marks the end of gathering
+		if candidate == nil {
+			return
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if !c.started {
+			c.pending = append(c.pending, candidate.ToJSON())
+			return
+		}
+
+		// The error can't be returned to the caller of Signal, a candidate that
+		// can't be added is no different from one that doesn't connect
+		_ = c.to.AddICECandidate(candidate.ToJSON())
+	})
+	return c
+}
+
+// start adds the queued candidates once the remote description is set and
+// passes on the following ones as they are gathered
+func (c *candidates) start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.started = true
+	for _, candidate := range c.pending {
+		if err := c.to.AddICECandidate(candidate); err != nil {
+			return err
+		}
+	}
+	c.pending = nil
+	return nil
+}
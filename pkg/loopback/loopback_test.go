@@ -0,0 +1,45 @@
+// +build !js
+
+package loopback
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/pion/webrtc/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignal(t *testing.T) {
+	report := test.CheckRoutines(t)
+	defer report()
+
+	lim := test.TimeOut(time.Second * 10)
+	defer lim.Stop()
+
+	offerer, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	answerer, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+
+	dc, err := offerer.CreateDataChannel("loopback", nil)
+	require.NoError(t, err)
+	dc.OnOpen(func() {
+		assert.NoError(t, dc.SendText("ping"))
+	})
+
+	received := make(chan string)
+	answerer.OnDataChannel(func(d *webrtc.DataChannel) {
+		d.OnMessage(func(msg webrtc.DataChannelMessage) {
+			received <- string(msg.Data)
+		})
+	})
+
+	require.NoError(t, Signal(offerer, answerer))
+	assert.Equal(t, "ping", <-received)
+
+	assert.NoError(t, offerer.Close())
+	assert.NoError(t, answerer.Close())
+}
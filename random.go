@@ -0,0 +1,77 @@
+// +build !js
+
+package webrtc
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v2/internal/util"
+)
+
+// Length of the ICE credentials generated with the random source, the same as
+// those pion/ice generates
+const (
+	iceUsernameFragmentLength = 16
+	icePasswordLength         = 32
+)
+
+// lockedSource makes a rand.Source safe for concurrent use
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// randUint32 returns a random uint32 from the random source if one is set
+func (e *SettingEngine) randUint32() uint32 {
+	if e.random != nil {
+		return e.random.Uint32()
+	}
+	return rand.Uint32()
+}
+
+// randSeq returns a random alpha numeric sequence from the random source if one is set
+func (e *SettingEngine) randSeq(n int) string {
+	if e.random != nil {
+		return util.RandSeqWith(e.random, n)
+	}
+	return util.RandSeq(n)
+}
+
+// newSequencer returns the Sequencer of a new Track, which starts at a random
+// sequence number from the random source if one is set
+func (e *SettingEngine) newSequencer() rtp.Sequencer {
+	if e.random != nil {
+		return rtp.NewFixedSequencer(uint16(e.random.Uint32()))
+	}
+	return rtp.NewRandomSequencer()
+}
+
+// iceCredentials returns the ICE credentials set with SetICECredentials, or
+// generates them with the random source if one is set. Empty credentials are
+// generated by pion/ice.
+func (e *SettingEngine) iceCredentials() (usernameFragment, password string) {
+	usernameFragment, password = e.candidates.UsernameFragment, e.candidates.Password
+	if e.random != nil {
+		if usernameFragment == "" {
+			usernameFragment = e.randSeq(iceUsernameFragmentLength)
+		}
+		if password == "" {
+			password = e.randSeq(icePasswordLength)
+		}
+	}
+	return usernameFragment, password
+}
@@ -0,0 +1,34 @@
+package webrtc
+
+// RIDParameters are the restrictions of a RTP stream that the remote signals
+// with an a=rid line, e.g. for every layer of a simulcast set. Restrictions that
+// aren't included are zero.
+// https://tools.ietf.org/html/rfc8851
+type RIDParameters struct {
+	// ID is the RID the RTP stream is identified with
+	ID string `json:"id"`
+
+	// Direction is "send" or "recv", seen from the remote
+	Direction string `json:"direction"`
+
+	// PayloadTypes are the payload types of the pt= restriction, any of the
+	// media section may be used if it is empty
+	PayloadTypes []uint8 `json:"payloadTypes"`
+
+	MaxWidth  uint32  `json:"maxWidth"`
+	MaxHeight uint32  `json:"maxHeight"`
+	MaxFPS    float64 `json:"maxFps"`
+
+	// MaxFrameSize is the largest frame in macroblocks, as max-fs
+	MaxFrameSize uint32 `json:"maxFs"`
+
+	// MaxBitrate is the limit of the bitrate in bits per second, as max-br
+	MaxBitrate uint32 `json:"maxBr"`
+
+	// Depend are the RIDs this RTP stream depends on
+	Depend []string `json:"depend"`
+
+	// Restrictions holds every restriction of the a=rid line by name, including
+	// the ones that aren't parsed into a field
+	Restrictions map[string]string `json:"restrictions"`
+}
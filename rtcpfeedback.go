@@ -15,8 +15,25 @@ const (
 
 	//TypeRTCPFBNACK ..
 	TypeRTCPFBNACK = "nack"
+
+	// rtcpFeedbackParameterPLI is the parameter of the nack feedback for Picture Loss Indications
+	rtcpFeedbackParameterPLI = "pli"
+
+	// rtcpFeedbackParameterFIR is the parameter of the ccm feedback for Full Intra Requests
+	rtcpFeedbackParameterFIR = "fir"
 )
 
+// defaultVideoRTCPFeedback returns the RTCP feedback the helpers for video
+// codecs advertise, audio codecs have none
+func defaultVideoRTCPFeedback() []RTCPFeedback {
+	return []RTCPFeedback{
+		{Type: TypeRTCPFBNACK},
+		{Type: TypeRTCPFBNACK, Parameter: rtcpFeedbackParameterPLI},
+		{Type: TypeRTCPFBCCM, Parameter: rtcpFeedbackParameterFIR},
+		{Type: TypeRTCPFBGoogREMB},
+	}
+}
+
 // RTCPFeedback signals the connection to use additional RTCP packet types.
 // https://draft.ortc.org/#dom-rtcrtcpfeedback
 type RTCPFeedback struct {
@@ -0,0 +1,22 @@
+package webrtc
+
+import "time"
+
+// contributingSourceTimeout is how long a contributing source is reported after
+// the last RTP packet that listed it
+const contributingSourceTimeout = 10 * time.Second
+
+// RTPContributingSource describes a source that contributed to the RTP packets
+// an RTPReceiver received, as listed in their CSRCs, e.g. a participant of the
+// audio an mixer sends.
+// https://www.w3.org/TR/webrtc/#dom-rtcrtpcontributingsource
+type RTPContributingSource struct {
+	// Timestamp is when the last RTP packet that listed the source arrived
+	Timestamp time.Time `json:"timestamp"`
+
+	// Source is the CSRC of the source
+	Source uint32 `json:"source"`
+
+	// RTPTimestamp is the RTP timestamp of the last packet that listed the source
+	RTPTimestamp uint32 `json:"rtpTimestamp"`
+}
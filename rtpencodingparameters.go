@@ -5,4 +5,8 @@ package webrtc
 // http://draft.ortc.org/#dom-rtcrtpencodingparameters
 type RTPEncodingParameters struct {
 	RTPCodingParameters
+
+	// MaxBitrate limits the bitrate the encoding is sent with in bits per
+	// second, zero means unlimited
+	MaxBitrate uint64 `json:"maxBitrate"`
 }
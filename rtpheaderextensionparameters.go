@@ -0,0 +1,9 @@
+package webrtc
+
+// RTPHeaderExtensionParameters maps the URI of a RFC 8285 RTP header extension
+// to the ID it has been negotiated with
+// https://w3c.github.io/webrtc-pc/#dom-rtcrtpheaderextensionparameters
+type RTPHeaderExtensionParameters struct {
+	URI string `json:"uri"`
+	ID  int    `json:"id"`
+}
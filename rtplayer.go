@@ -0,0 +1,90 @@
+// +build !js
+
+package webrtc
+
+import (
+	"strings"
+)
+
+// RTPLayer identifies the layer of a scalable video stream an RTP packet
+// belongs to, e.g. so a Selective Forwarding Unit can drop the layers a
+// receiver doesn't need.
+type RTPLayer struct {
+	// SpatialID is the spatial layer, the base layer is 0
+	SpatialID uint8
+
+	// TemporalID is the temporal layer, the base layer is 0
+	TemporalID uint8
+}
+
+// ParseRTPLayer returns the layer of the RTP payload of the given codec. VP9
+// carries spatial and temporal layers, VP8 only temporal layers. The second
+// return value is false if the codec isn't supported or the payload doesn't
+// identify its layer.
+func ParseRTPLayer(codecName string, payload []byte) (RTPLayer, bool) {
+	switch {
+	case strings.EqualFold(codecName, VP8):
+		return parseVP8Layer(payload)
+	case strings.EqualFold(codecName, VP9):
+		return parseVP9Layer(payload)
+	}
+	return RTPLayer{}, false
+}
+
+// https://tools.ietf.org/html/rfc7741#section-4.2
+func parseVP8Layer(payload []byte) (RTPLayer, bool) {
+	// The extended control bits are needed for the TID
+	if len(payload) < 2 || payload[0]&0x80 == 0 {
+		return RTPLayer{}, false
+	}
+
+	extension := payload[1]
+	if extension&0x20 == 0 { // T
+		return RTPLayer{}, false
+	}
+
+	i := 2
+	if extension&0x80 != 0 { // PictureID
+		if len(payload) <= i {
+			return RTPLayer{}, false
+		}
+		if payload[i]&0x80 != 0 {
+			i++
+		}
+		i++
+	}
+	if extension&0x40 != 0 { // TL0PICIDX
+		i++
+	}
+
+	if len(payload) <= i {
+		return RTPLayer{}, false
+	}
+	return RTPLayer{TemporalID: payload[i] >> 6}, true
+}
+
+// https://tools.ietf.org/html/draft-ietf-payload-vp9-10#section-4.2
+func parseVP9Layer(payload []byte) (RTPLayer, bool) {
+	if len(payload) < 1 || payload[0]&0x20 == 0 { // L
+		return RTPLayer{}, false
+	}
+
+	i := 1
+	if payload[0]&0x80 != 0 { // I
+		if len(payload) <= i {
+			return RTPLayer{}, false
+		}
+		if payload[i]&0x80 != 0 { // M, 15 bit PictureID
+			i++
+		}
+		i++
+	}
+
+	if len(payload) <= i {
+		return RTPLayer{}, false
+	}
+	return RTPLayer{
+		SpatialID:  (payload[i] >> 1) & 0x07,
+		TemporalID: payload[i] >> 5,
+	}, true
+}
@@ -0,0 +1,40 @@
+// +build !js
+
+package webrtc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRTPLayer(t *testing.T) {
+	testCases := []struct {
+		codec   string
+		payload []byte
+		layer   RTPLayer
+		ok      bool
+	}{
+		// VP9 with a 7 bit and a 15 bit PictureID
+		{VP9, []byte{0xA0, 0x12, 0x45, 0x00}, RTPLayer{SpatialID: 2, TemporalID: 2}, true},
+		{VP9, []byte{0xA8, 0x81, 0x23, 0x63, 0x00}, RTPLayer{SpatialID: 1, TemporalID: 3}, true},
+		{VP9, []byte{0x30, 0x02}, RTPLayer{SpatialID: 1}, true},
+		{VP9, []byte{0x88, 0x12}, RTPLayer{}, false},
+		{VP9, []byte{0xA0, 0x12}, RTPLayer{}, false},
+
+		// VP8 with PictureID and TL0PICIDX
+		{VP8, []byte{0x90, 0xE0, 0x81, 0x02, 0x03, 0x40, 0x00}, RTPLayer{TemporalID: 1}, true},
+		{VP8, []byte{0x90, 0x20, 0x80, 0x00}, RTPLayer{TemporalID: 2}, true},
+		{VP8, []byte{0x90, 0x80, 0x01, 0x00}, RTPLayer{}, false},
+		{VP8, []byte{0x10, 0x00}, RTPLayer{}, false},
+
+		{H264, []byte{0x65, 0x00}, RTPLayer{}, false},
+		{VP9, []byte{}, RTPLayer{}, false},
+	}
+
+	for i, testCase := range testCases {
+		layer, ok := ParseRTPLayer(testCase.codec, testCase.payload)
+		assert.Equal(t, testCase.ok, ok, "testCase: %d", i)
+		assert.Equal(t, testCase.layer, layer, "testCase: %d", i)
+	}
+}
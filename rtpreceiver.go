@@ -3,13 +3,25 @@
 package webrtc
 
 import (
+	"encoding/binary"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/pion/logging"
 	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
 	"github.com/pion/srtp"
+	"github.com/pion/transport/packetio"
 )
 
+// Limit the buffer size of RTCP that hasn't been read by the user to 100KB
+const rtcpReadBufferSize = 100 * 1000
+
+// Limit the buffer size of RTP that hasn't been read by the user to 1MB
+const rtpReadBufferSize = 1000 * 1000
+
 // RTPReceiver allows an application to inspect the receipt of a Track
 type RTPReceiver struct {
 	kind      RTPCodecType
@@ -23,8 +35,68 @@ type RTPReceiver struct {
 	rtpReadStream  *srtp.ReadStreamSRTP
 	rtcpReadStream *srtp.ReadStreamSRTCP
 
+	// rtcpBuffer holds RTCP that has been processed by readRTCP until the user reads it
+	rtcpBuffer *packetio.Buffer
+
+	// rtpBuffer holds RTP read by readRTPStream until the Track is read, it
+	// allows the read deadline of the Track to be set
+	rtpBuffer *packetio.Buffer
+
+	// rtpReadStreamClosed is set once the remote sent a Goodbye or Stop was called
+	rtpReadStreamClosed bool
+
+	readTransform func(*rtp.Packet) *rtp.Packet
+
+	// payloadTypes are the codecs negotiated for the media section of the
+	// receiver, keyed by the PayloadType the remote sends them with
+	payloadTypes map[uint8]*RTPCodec
+
+	// keyframeTimer requests a keyframe if none was read within keyframeTimeout,
+	// reading a keyframe starts it again
+	keyframeTimeout time.Duration
+	keyframeTimer   *time.Timer
+
+	// firSequenceNumber is incremented with every Full Intra Request sent
+	firSequenceNumber uint8
+
+	// bitrate is estimated from the size of the RTP packets as they arrive
+	bitrate bitrateEstimator
+
+	// cname is the CNAME of the last Source Description received for the Track
+	cname string
+
+	// rids are the a=rid lines of the media section the Track is received in
+	rids []RIDParameters
+
+	// firstPacketTime is when the first RTP packet arrived, zero until then
+	firstPacketTime      time.Time
+	onFirstPacketHandler func(time.Time)
+
+	// contributingSources are the CSRCs of the RTP packets read, by CSRC
+	contributingSources map[uint32]RTPContributingSource
+
 	// A reference to the associated api object
 	api *API
+	log logging.LeveledLogger
+}
+
+// getCodec returns the codec the remote sends with the given PayloadType. The
+// negotiated PayloadTypes take precedence over the ones of the MediaEngine, as
+// the remote may have assigned other PayloadTypes to the same codecs.
+func (r *RTPReceiver) getCodec(payloadType uint8) (*RTPCodec, error) {
+	r.mu.RLock()
+	codec, ok := r.payloadTypes[payloadType]
+	r.mu.RUnlock()
+	if ok {
+		return codec, nil
+	}
+	return r.api.mediaEngine.getCodec(payloadType)
+}
+
+func (r *RTPReceiver) setPayloadTypes(payloadTypes map[uint8]*RTPCodec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.payloadTypes = payloadTypes
 }
 
 // NewRTPReceiver constructs a new RTPReceiver
@@ -37,6 +109,7 @@ func (api *API) NewRTPReceiver(kind RTPCodecType, transport *DTLSTransport) (*RT
 		kind:      kind,
 		transport: transport,
 		api:       api,
+		log:       api.settingEngine.LoggerFactory.NewLogger("ortc"),
 		closed:    make(chan interface{}),
 		received:  make(chan interface{}),
 	}, nil
@@ -57,6 +130,25 @@ func (r *RTPReceiver) Track() *Track {
 	return r.track
 }
 
+// Bitrate returns the bitrate the Track of this RTPReceiver is received with
+// in bits per second, averaged over the last second. It counts the RTP packets
+// as they arrive, including headers, whether or not the Track is read. With
+// simulcast that signals a SSRC per layer every layer has its own RTPReceiver,
+// so an SFU can compare them to pick the layer that fits a subscriber.
+func (r *RTPReceiver) Bitrate() float64 {
+	return r.bitrate.estimate(time.Now())
+}
+
+// SetReadTransform sets a function that is called with every RTP packet that
+// is received before the Track returns it from a read. The packet that is
+// returned is read instead, the packet is dropped if nil is returned. The
+// transform must not keep the packet after it returns.
+func (r *RTPReceiver) SetReadTransform(f func(*rtp.Packet) *rtp.Packet) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.readTransform = f
+}
+
 // Receive initialize the track and starts all the transports
 func (r *RTPReceiver) Receive(parameters RTPReceiveParameters) error {
 	r.mu.Lock()
@@ -68,6 +160,12 @@ func (r *RTPReceiver) Receive(parameters RTPReceiveParameters) error {
 	}
 	defer close(r.received)
 
+	r.rtcpBuffer = packetio.NewBuffer()
+	r.rtcpBuffer.SetLimitSize(rtcpReadBufferSize)
+
+	r.rtpBuffer = packetio.NewBuffer()
+	r.rtpBuffer.SetLimitSize(rtpReadBufferSize)
+
 	r.track = &Track{
 		kind:     r.kind,
 		ssrc:     parameters.Encodings.SSRC,
@@ -94,13 +192,275 @@ func (r *RTPReceiver) Receive(parameters RTPReceiveParameters) error {
 		return err
 	}
 
+	go r.readRTPStream(r.rtpReadStream)
+	go r.readRTCP(r.rtcpReadStream, parameters.Encodings.SSRC)
+	return nil
+}
+
+// readRTPStream moves all incoming RTP for this RTPReceiver into the rtpBuffer
+// the Track reads from. It runs until the RTP stream is closed
+func (r *RTPReceiver) readRTPStream(stream *srtp.ReadStreamSRTP) {
+	defer func() {
+		if err := r.rtpBuffer.Close(); err != nil {
+			r.log.Warnf("Failed to close RTP buffer: %v", err)
+		}
+	}()
+
+	b := make([]byte, receiveMTU)
+	for first := true; ; first = false {
+		i, err := stream.Read(b)
+		if err != nil {
+			return
+		}
+		r.api.settingEngine.traceRawRTP(b[:i])
+		r.bitrate.add(time.Now(), i)
+		if first {
+			r.firstPacket(time.Now())
+		}
+
+		raw := b[:i]
+		r.mu.RLock()
+		transform := r.readTransform
+		r.mu.RUnlock()
+		if transform != nil {
+			if raw = r.transformRTP(transform, raw); raw == nil {
+				continue
+			}
+		}
+
+		r.updateContributingSources(raw)
+
+		// Silently drop RTP the user isn't reading when the buffer is full
+		if _, err := r.rtpBuffer.Write(raw); err != nil && err != packetio.ErrFull {
+			return
+		}
+	}
+}
+
+// transformRTP applies a read transform to a received packet, it returns nil if the packet is dropped
+func (r *RTPReceiver) transformRTP(transform func(*rtp.Packet) *rtp.Packet, raw []byte) []byte {
+	p := &rtp.Packet{}
+	if err := p.Unmarshal(raw); err != nil {
+		r.log.Warnf("Failed to unmarshal RTP for read transform: %v", err)
+		return nil
+	}
+
+	if p = transform(p); p == nil {
+		return nil
+	}
+
+	raw, err := p.Marshal()
+	if err != nil {
+		r.log.Warnf("Failed to marshal RTP returned by read transform: %v", err)
+		return nil
+	}
+	return raw
+}
+
+// readRTCP processes all incoming RTCP for this RTPReceiver before
+// making it available to Read. It runs until the RTCP stream is closed
+func (r *RTPReceiver) readRTCP(stream *srtp.ReadStreamSRTCP, ssrc uint32) {
+	defer func() {
+		if err := r.rtcpBuffer.Close(); err != nil {
+			r.log.Warnf("Failed to close RTCP buffer: %v", err)
+		}
+	}()
+
+	b := make([]byte, receiveMTU)
+	for {
+		i, err := stream.Read(b)
+		if err != nil {
+			return
+		} else if err = r.receiveRTCP(b[:i], ssrc); err != nil {
+			return
+		}
+	}
+}
+
+// receiveRTCP handles RTCP read from the remote and buffers it until the user reads it
+func (r *RTPReceiver) receiveRTCP(raw []byte, ssrc uint32) error {
+	if pkts, err := rtcp.Unmarshal(raw); err == nil {
+		r.api.settingEngine.traceRTCP(false, pkts)
+		r.handleRTCP(pkts, ssrc)
+	}
+
+	// Silently drop RTCP the user isn't reading when the buffer is full
+	if _, err := r.rtcpBuffer.Write(raw); err != nil && err != packetio.ErrFull {
+		return err
+	}
 	return nil
 }
 
+// handleRTCP reacts to RTCP that changes the state of this RTPReceiver, the
+// packets it doesn't handle and Goodbyes are passed to PeerConnection.OnRTCP
+func (r *RTPReceiver) handleRTCP(pkts []rtcp.Packet, ssrc uint32) {
+	unhandled := []rtcp.Packet{}
+	for _, p := range pkts {
+		switch p := p.(type) {
+		case *rtcp.Goodbye:
+			for _, source := range p.Sources {
+				if source == ssrc {
+					r.closeRTPReadStream()
+				}
+			}
+			unhandled = append(unhandled, p)
+		case *rtcp.SourceDescription:
+			handled := false
+			for _, chunk := range p.Chunks {
+				if chunk.Source != ssrc {
+					continue
+				}
+				handled = true
+				for _, item := range chunk.Items {
+					if item.Type == rtcp.SDESCNAME {
+						r.mu.Lock()
+						r.cname = item.Text
+						r.mu.Unlock()
+					}
+				}
+			}
+			if !handled {
+				unhandled = append(unhandled, p)
+			}
+		default:
+			unhandled = append(unhandled, p)
+		}
+	}
+	r.transport.onUnhandledRTCP(unhandled, ssrc, r, nil)
+}
+
+// CNAME returns the canonical name the remote sent for the Track of this
+// RTPReceiver in a RTCP Source Description. Tracks with the same CNAME come
+// from the same source and can be synchronized. It is empty until the first
+// Source Description is received.
+func (r *RTPReceiver) CNAME() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cname
+}
+
+// RIDs returns the restrictions the remote signaled with the a=rid lines of the
+// media section the Track of this RTPReceiver is received in. With simulcast
+// there is one per layer. They describe the whole media section, as packets
+// aren't matched to a RID by the RTP header extension.
+func (r *RTPReceiver) RIDs() []RIDParameters {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]RIDParameters{}, r.rids...)
+}
+
+// ResetStats clears the statistics of the Track of the RTPReceiver, the next
+// packet read starts them again. A forwarder that switches the source of the
+// packets, e.g. to another simulcast layer with its own sequence numbers, calls
+// it with the switch so the jump of the sequence numbers isn't counted as loss.
+func (r *RTPReceiver) ResetStats() {
+	track := r.Track()
+	if track == nil {
+		return
+	}
+
+	track.mu.Lock()
+	defer track.mu.Unlock()
+	track.resetStats()
+}
+
+// FirstPacketTime returns when the first RTP packet of the Track arrived, before
+// it was read or OnTrack fired. It is zero until then.
+func (r *RTPReceiver) FirstPacketTime() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.firstPacketTime
+}
+
+// OnFirstPacket sets an event handler which is called with the time the first
+// RTP packet of the Track arrived, e.g. to measure the time to the first frame.
+// It is called from the goroutine that reads the RTP, before the packet can be
+// read, or right away if the packet arrived before the handler was set.
+func (r *RTPReceiver) OnFirstPacket(f func(time.Time)) {
+	r.mu.Lock()
+	r.onFirstPacketHandler = f
+	firstPacketTime := r.firstPacketTime
+	r.mu.Unlock()
+
+	if f != nil && !firstPacketTime.IsZero() {
+		f(firstPacketTime)
+	}
+}
+
+func (r *RTPReceiver) firstPacket(arrival time.Time) {
+	r.mu.Lock()
+	r.firstPacketTime = arrival
+	onFirstPacketHandler := r.onFirstPacketHandler
+	r.mu.Unlock()
+
+	if onFirstPacketHandler != nil {
+		onFirstPacketHandler(arrival)
+	}
+}
+
+// GetContributingSources returns the sources listed in the CSRCs of the RTP
+// packets received in the last 10 seconds, ordered by CSRC. The CSRCs of each
+// packet are also kept in the packets the Track reads.
+func (r *RTPReceiver) GetContributingSources() []RTPContributingSource {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sources := []RTPContributingSource{}
+	for csrc, source := range r.contributingSources {
+		if time.Since(source.Timestamp) > contributingSourceTimeout {
+			delete(r.contributingSources, csrc)
+			continue
+		}
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Source < sources[j].Source })
+	return sources
+}
+
+// updateContributingSources records the CSRCs of a received RTP packet
+func (r *RTPReceiver) updateContributingSources(raw []byte) {
+	if len(raw) < 12 || raw[0]&0x0F == 0 {
+		return
+	}
+
+	csrcCount := int(raw[0] & 0x0F)
+	if len(raw) < 12+4*csrcCount {
+		return
+	}
+
+	now := time.Now()
+	rtpTimestamp := binary.BigEndian.Uint32(raw[4:8])
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.contributingSources == nil {
+		r.contributingSources = map[uint32]RTPContributingSource{}
+	}
+	for i := 0; i < csrcCount; i++ {
+		csrc := binary.BigEndian.Uint32(raw[12+4*i:])
+		r.contributingSources[csrc] = RTPContributingSource{Timestamp: now, Source: csrc, RTPTimestamp: rtpTimestamp}
+	}
+}
+
+// closeRTPReadStream ends the inbound RTP stream, causing reads of the Track to return io.EOF
+func (r *RTPReceiver) closeRTPReadStream() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rtpReadStreamClosed || r.rtpReadStream == nil {
+		return
+	}
+	r.rtpReadStreamClosed = true
+
+	if err := r.rtpReadStream.Close(); err != nil {
+		r.log.Warnf("Failed to close RTP stream: %v", err)
+	}
+}
+
 // Read reads incoming RTCP for this RTPReceiver
 func (r *RTPReceiver) Read(b []byte) (n int, err error) {
 	<-r.received
-	return r.rtcpReadStream.Read(b)
+	return r.rtcpBuffer.Read(b)
 }
 
 // ReadRTCP is a convenience method that wraps Read and unmarshals for you
@@ -134,14 +494,22 @@ func (r *RTPReceiver) Stop() error {
 	default:
 	}
 
+	if r.keyframeTimer != nil {
+		r.keyframeTimer.Stop()
+		r.keyframeTimer = nil
+	}
+
 	select {
 	case <-r.received:
 		if r.rtcpReadStream != nil {
 			if err := r.rtcpReadStream.Close(); err != nil {
 				return err
 			}
+		} else if err := r.rtcpBuffer.Close(); err != nil {
+			return err
 		}
-		if r.rtpReadStream != nil {
+		if r.rtpReadStream != nil && !r.rtpReadStreamClosed {
+			r.rtpReadStreamClosed = true
 			if err := r.rtpReadStream.Close(); err != nil {
 				return err
 			}
@@ -156,5 +524,196 @@ func (r *RTPReceiver) Stop() error {
 // readRTP should only be called by a track, this only exists so we can keep state in one place
 func (r *RTPReceiver) readRTP(b []byte) (n int, err error) {
 	<-r.received
-	return r.rtpReadStream.Read(b)
+	for {
+		if n, err = r.rtpBuffer.Read(b); err != nil {
+			return n, err
+		} else if !r.api.settingEngine.dropPaddingOnlyRTP || !r.skipPaddingOnlyRTP(b[:n]) {
+			r.onRTPRead(b[:n])
+			return n, nil
+		}
+	}
+}
+
+// skipPaddingOnlyRTP returns true if a packet only carries padding, it is then
+// dropped in the order it is read so the Track stats don't count it as lost
+func (r *RTPReceiver) skipPaddingOnlyRTP(b []byte) bool {
+	p := rtp.Packet{}
+	if err := p.Unmarshal(b); err != nil || !isPaddingOnlyRTP(&p) {
+		return false
+	}
+
+	if track := r.Track(); track != nil {
+		track.skipPacket(&p.Header)
+	}
+	return true
+}
+
+// isPaddingOnlyRTP tells if all of the payload of the packet is padding
+func isPaddingOnlyRTP(p *rtp.Packet) bool {
+	return p.Padding && len(p.Payload) != 0 && int(p.Payload[len(p.Payload)-1]) == len(p.Payload)
+}
+
+// setRTPReadDeadline should only be called by a track, see Track.SetReadDeadline
+func (r *RTPReceiver) setRTPReadDeadline(deadline time.Time) error {
+	<-r.received
+	return r.rtpBuffer.SetReadDeadline(deadline)
+}
+
+// onRTPRead restarts the keyframe request timeout when a keyframe is read
+func (r *RTPReceiver) onRTPRead(b []byte) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.keyframeTimer == nil {
+		return
+	}
+
+	codec := r.track.Codec()
+	if codec == nil {
+		return
+	}
+
+	p := rtp.Packet{}
+	if err := p.Unmarshal(b); err != nil {
+		return
+	}
+
+	if isKeyframe(codec.Name, p.Payload) {
+		r.keyframeTimer.Reset(r.keyframeTimeout)
+	}
+}
+
+// SetKeyframeRequestTimeout makes the RTPReceiver send a Picture Loss Indication
+// when no keyframe has been read from its Track within the timeout. The timeout
+// starts again after every keyframe. A single request is sent until the next
+// keyframe arrives, so a stalled sender isn't sent a request every timeout.
+// Keyframes are detected for VP8, VP9 and H264, a timeout of zero disables the
+// requests.
+func (r *RTPReceiver) SetKeyframeRequestTimeout(timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.keyframeTimer != nil {
+		r.keyframeTimer.Stop()
+		r.keyframeTimer = nil
+	}
+	r.keyframeTimeout = timeout
+
+	select {
+	case <-r.closed:
+		return
+	default:
+	}
+
+	if timeout > 0 {
+		var timer *time.Timer
+		timer = time.AfterFunc(timeout, func() {
+			r.mu.Lock()
+			if r.keyframeTimer != timer {
+				r.mu.Unlock()
+				return
+			}
+
+			// Keep waiting until there is a Track, afterwards the next keyframe starts the timeout again
+			track := r.track
+			if track == nil {
+				r.keyframeTimer.Reset(r.keyframeTimeout)
+			}
+			r.mu.Unlock()
+
+			r.requestKeyframe(track)
+		})
+		r.keyframeTimer = timer
+	}
+}
+
+// requestKeyframe sends a Picture Loss Indication for the given Track
+func (r *RTPReceiver) requestKeyframe(track *Track) {
+	// Nothing to request before Receive was called
+	if track == nil {
+		return
+	}
+
+	if err := r.transport.writeRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: track.SSRC()}}); err != nil {
+		r.log.Warnf("Failed to send keyframe request: %v", err)
+	}
+}
+
+// SendPLI sends a Picture Loss Indication for the Track of this RTPReceiver,
+// which asks the remote to send a keyframe
+func (r *RTPReceiver) SendPLI() error {
+	track := r.Track()
+	if track == nil {
+		return ErrReceiverNotStarted
+	}
+	return r.transport.writeRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: track.SSRC()}})
+}
+
+// SendFIR sends a Full Intra Request for the Track of this RTPReceiver, which
+// asks the remote to send a keyframe. pion/rtcp can't parse FIR, so a remote
+// using Pion receives it as rtcp.RawPacket.
+// https://tools.ietf.org/html/rfc5104#section-4.3.1
+func (r *RTPReceiver) SendFIR() error {
+	r.mu.Lock()
+	track := r.track
+	r.firSequenceNumber++
+	sequenceNumber := r.firSequenceNumber
+	r.mu.Unlock()
+	if track == nil {
+		return ErrReceiverNotStarted
+	}
+
+	const firLength = 20
+	fir := make(rtcp.RawPacket, firLength)
+	header := rtcp.Header{
+		Count:  rtcpFeedbackFormatFIR,
+		Type:   rtcp.TypePayloadSpecificFeedback,
+		Length: firLength/4 - 1,
+	}
+	rawHeader, err := header.Marshal()
+	if err != nil {
+		return err
+	}
+	copy(fir, rawHeader)
+	// The sender and media source SSRCs stay zero, the FCI holds the SSRC the request is for
+	binary.BigEndian.PutUint32(fir[12:], track.SSRC())
+	fir[16] = sequenceNumber
+
+	return r.transport.writeRTCP([]rtcp.Packet{&fir})
+}
+
+// SendNACK sends a Generic NACK for the Track of this RTPReceiver, which asks
+// the remote to retransmit the packets with the given sequence numbers
+func (r *RTPReceiver) SendNACK(sequenceNumbers []uint16) error {
+	track := r.Track()
+	if track == nil {
+		return ErrReceiverNotStarted
+	} else if len(sequenceNumbers) == 0 {
+		return nil
+	}
+	return r.transport.writeRTCP([]rtcp.Packet{&rtcp.TransportLayerNack{
+		MediaSSRC: track.SSRC(),
+		Nacks:     nackPairs(sequenceNumbers),
+	}})
+}
+
+// rtcpFeedbackFormatFIR is the feedback message type of a Full Intra Request
+const rtcpFeedbackFormatFIR = 4
+
+// nackPairs groups sequence numbers into NACK pairs, every pair covers the
+// sequence numbers up to 16 after its PacketID
+func nackPairs(sequenceNumbers []uint16) []rtcp.NackPair {
+	pairs := []rtcp.NackPair{}
+	for _, sequenceNumber := range sequenceNumbers {
+		if len(pairs) != 0 {
+			pair := &pairs[len(pairs)-1]
+			if diff := sequenceNumber - pair.PacketID; diff == 0 {
+				continue
+			} else if diff <= 16 {
+				pair.LostPackets |= rtcp.PacketBitmap(1 << (diff - 1))
+				continue
+			}
+		}
+		pairs = append(pairs, rtcp.NackPair{PacketID: sequenceNumber})
+	}
+	return pairs
 }
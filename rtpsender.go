@@ -3,26 +3,102 @@
 package webrtc
 
 import (
+	"encoding/binary"
 	"fmt"
+	"io"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/pion/logging"
 	"github.com/pion/rtcp"
 	"github.com/pion/rtp"
 	"github.com/pion/srtp"
+	"github.com/pion/transport/packetio"
+	"github.com/pion/webrtc/v2/pkg/rtcerr"
 )
 
+// rtpMaxPaddingSize is the most padding a single RTP packet can carry
+const rtpMaxPaddingSize = 255
+
+// defaultRTCPReportInterval is the average interval of the Sender Reports
+const defaultRTCPReportInterval = 5 * time.Second
+
 // RTPSender allows an application to control how a given Track is encoded and transmitted to a remote peer
 type RTPSender struct {
 	track          *Track
 	rtcpReadStream *srtp.ReadStreamSRTCP
 
+	// rtcpBuffer holds RTCP that has been processed by readRTCP until the user reads it
+	rtcpBuffer *packetio.Buffer
+
 	transport *DTLSTransport
 
 	// A reference to the associated api object
 	api *API
+	log logging.LeveledLogger
 
 	mu                     sync.RWMutex
 	sendCalled, stopCalled chan interface{}
+
+	onKeyframeRequestHandler     func()
+	onTransportCCFeedbackHandler func(TransportCCFeedback)
+
+	// layers holds the state of SetMaxLayers. dropped counts the packets that
+	// have been dropped less the padding packets SendPadding inserted, the
+	// sequence numbers sent are shifted by it. lastSequenceNumber is the one of
+	// the last packet sent, if sent is set.
+	layers struct {
+		sync.Mutex
+		limit              bool
+		max                RTPLayer
+		dropped            uint16
+		sent               bool
+		lastSequenceNumber uint16
+	}
+
+	// paused is set while the RTPTransceiver doesn't send, the packets written
+	// to the Track are dropped
+	paused atomicBool
+
+	// playoutDelayID is the ID of the negotiated playout delay header extension
+	playoutDelayID uint8
+
+	// parameters are the ones passed to Send, with the MaxBitrate of SetParameters
+	parameters RTPSendParameters
+
+	// bitrate holds the state of the MaxBitrate limit. Frames are dropped while
+	// the bytes sent are over budget, the budget grows with the time that passes.
+	// frameTimestamp is the timestamp of the frame the last packet belonged to.
+	bitrate struct {
+		sync.Mutex
+		max            uint64
+		budget         float64
+		lastUpdate     time.Time
+		started        bool
+		frameTimestamp uint32
+		droppingFrame  bool
+		// waitingForKeyframe is set once a video frame was dropped, as the
+		// frames that follow it can't be decoded until the next keyframe
+		waitingForKeyframe bool
+		keyframeRequested  bool
+	}
+
+	// csrc replaces the CSRCs of the packets sent unless it is nil
+	csrc []uint32
+
+	// pacer spreads the packets that are sent over time, see SettingEngine.SetPacerBitrate
+	pacer *pacer
+
+	statsID string
+	stats   struct {
+		sync.Mutex
+		packetsSent uint32
+		bytesSent   uint64
+		nackCount   uint32
+		pliCount    uint32
+		firCount    uint32
+	}
 }
 
 // NewRTPSender constructs a new RTPSender
@@ -39,13 +115,16 @@ func (api *API) NewRTPSender(track *Track, transport *DTLSTransport) (*RTPSender
 		return nil, fmt.Errorf("RTPSender can not be constructed with remote track")
 	}
 	track.totalSenderCount++
+	track.senderCountChanged()
 
 	return &RTPSender{
 		track:      track,
 		transport:  transport,
 		api:        api,
+		log:        api.settingEngine.LoggerFactory.NewLogger("ortc"),
 		sendCalled: make(chan interface{}),
 		stopCalled: make(chan interface{}),
+		statsID:    fmt.Sprintf("RTPSender-%d", time.Now().UnixNano()),
 	}, nil
 }
 
@@ -83,14 +162,562 @@ func (r *RTPSender) Send(parameters RTPSendParameters) error {
 		return err
 	}
 
+	if r.api.settingEngine.pacerBitrate != 0 {
+		r.pacer = newPacer(r.api.settingEngine.pacerBitrate, r.writeRTP)
+		go r.pacer.run(r.stopCalled, func(err error) {
+			r.log.Debugf("Failed to send paced RTP: %v", err)
+		})
+	}
+
+	r.rtcpBuffer = packetio.NewBuffer()
+	r.rtcpBuffer.SetLimitSize(rtcpReadBufferSize)
+	go r.readRTCP(r.rtcpReadStream, parameters.Encodings.SSRC)
+
+	// A MaxBitrate set before Send is kept unless the parameters replace it
+	if parameters.Encodings.MaxBitrate == 0 {
+		parameters.Encodings.MaxBitrate = r.getMaxBitrate()
+	}
+	r.setMaxBitrate(parameters.Encodings.MaxBitrate)
+	r.parameters = parameters
+
+	for _, headerExtension := range parameters.HeaderExtensions {
+		if headerExtension.URI == PlayoutDelayURI && headerExtension.ID > 0 && headerExtension.ID < 15 {
+			r.playoutDelayID = uint8(headerExtension.ID)
+		}
+	}
+
 	r.track.mu.Lock()
 	r.track.activeSenders = append(r.track.activeSenders, r)
+	r.track.activateSenders()
 	r.track.mu.Unlock()
 
+	if !r.api.settingEngine.rtcpReports.Disabled {
+		go r.sendReports()
+	}
+
 	close(r.sendCalled)
 	return nil
 }
 
+// sendReports sends a Sender Report with the CNAME of the Track every report
+// interval until the RTPSender is stopped. Nothing is reported before media
+// has been written.
+func (r *RTPSender) sendReports() {
+	for {
+		timer := time.NewTimer(r.api.settingEngine.rtcpReportDelay())
+		select {
+		case <-r.stopCalled:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if r.paused.get() {
+			continue
+		}
+
+		report, err := r.track.SenderReport(time.Now())
+		if err != nil {
+			r.log.Warnf("Failed to generate Sender Report: %v", err)
+			return
+		} else if report.PacketCount == 0 {
+			continue
+		}
+
+		sdes := &rtcp.SourceDescription{Chunks: []rtcp.SourceDescriptionChunk{{
+			Source: report.SSRC,
+			Items:  []rtcp.SourceDescriptionItem{{Type: rtcp.SDESCNAME, Text: r.cname()}},
+		}}}
+		if err := r.transport.writeRTCP([]rtcp.Packet{report, sdes}); err != nil {
+			r.log.Debugf("Failed to send Sender Report: %v", err)
+		}
+	}
+}
+
+// cname returns the CNAME the Track is announced with, see SettingEngine.SetCNAME
+func (r *RTPSender) cname() string {
+	if r.api.settingEngine.cname != "" {
+		return r.api.settingEngine.cname
+	}
+	return r.track.Label()
+}
+
+// GetParameters returns the parameters the RTPSender sends its Track with
+func (r *RTPSender) GetParameters() RTPSendParameters {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	parameters := r.parameters
+	if !r.hasSent() {
+		parameters.Encodings.SSRC = r.track.SSRC()
+		parameters.Encodings.PayloadType = r.track.PayloadType()
+	}
+	parameters.Encodings.MaxBitrate = r.getMaxBitrate()
+	parameters.HeaderExtensions = append([]RTPHeaderExtensionParameters{}, parameters.HeaderExtensions...)
+	if parameters.RTCPFeedback != nil {
+		parameters.RTCPFeedback = append([]RTCPFeedback{}, parameters.RTCPFeedback...)
+	}
+	return parameters
+}
+
+// SetParameters changes the parameters of the RTPSender without renegotiation.
+// Only MaxBitrate can be changed, the other parameters must be those returned
+// by GetParameters. The limit applies to the next packet that is written: while
+// more than MaxBitrate has been sent, whole frames are dropped and the sequence
+// numbers of the packets that are sent stay continuous. After a VP8, VP9 or H264
+// frame is dropped the following frames are dropped until the next keyframe, so
+// receivers can keep decoding, and a keyframe is requested with the handler set
+// by OnKeyframeRequest. Frames of other video codecs are never dropped. The
+// limit is best combined with SetMaxLayers or an encoder that adapts its bitrate.
+func (r *RTPSender) SetParameters(parameters RTPSendParameters) error {
+	current := r.GetParameters()
+	if parameters.Encodings.SSRC != current.Encodings.SSRC || parameters.Encodings.PayloadType != current.Encodings.PayloadType {
+		return &rtcerr.InvalidModificationError{Err: fmt.Errorf("only MaxBitrate of the RTPSendParameters can be modified")}
+	}
+
+	r.setMaxBitrate(parameters.Encodings.MaxBitrate)
+	return nil
+}
+
+func (r *RTPSender) getMaxBitrate() uint64 {
+	r.bitrate.Lock()
+	defer r.bitrate.Unlock()
+	return r.bitrate.max
+}
+
+func (r *RTPSender) setMaxBitrate(maxBitrate uint64) {
+	r.bitrate.Lock()
+	defer r.bitrate.Unlock()
+
+	if maxBitrate != r.bitrate.max {
+		r.bitrate.max = maxBitrate
+		r.bitrate.budget = float64(maxBitrate) / 8 * bitrateWindow.Seconds()
+		r.bitrate.lastUpdate = time.Time{}
+	}
+}
+
+// limitBitrate returns false if the packet is dropped because of MaxBitrate.
+// The decision is made for the first packet of a frame and followed by the
+// rest of it, frames are sent whole even if they exceed the budget. Once a
+// video frame is dropped every frame is dropped until the next keyframe, which
+// is requested through OnKeyframeRequest. Video that isn't VP8, VP9 or H264 is
+// never dropped, as without detecting keyframes any frame may be referenced.
+// The bitrate lock must be held.
+func (r *RTPSender) limitBitrate(header *rtp.Header, payload []byte, now time.Time) bool {
+	firstPacket := !r.bitrate.started || header.Timestamp != r.bitrate.frameTimestamp
+	r.bitrate.started = true
+	r.bitrate.frameTimestamp = header.Timestamp
+
+	if r.bitrate.max == 0 {
+		r.bitrate.droppingFrame, r.bitrate.waitingForKeyframe = false, false
+		return true
+	}
+
+	// The budget grows with MaxBitrate, up to what can be sent within bitrateWindow
+	bytesPerSecond := float64(r.bitrate.max) / 8
+	if !r.bitrate.lastUpdate.IsZero() {
+		r.bitrate.budget += now.Sub(r.bitrate.lastUpdate).Seconds() * bytesPerSecond
+		if maxBudget := bytesPerSecond * bitrateWindow.Seconds(); r.bitrate.budget > maxBudget {
+			r.bitrate.budget = maxBudget
+		}
+	}
+	r.bitrate.lastUpdate = now
+
+	if firstPacket {
+		codec := r.track.Codec()
+		video := codec != nil && codec.Type == RTPCodecTypeVideo
+		switch {
+		case video && !canDetectKeyframe(codec.Name):
+			r.bitrate.droppingFrame = false
+		case r.bitrate.budget <= 0:
+			r.bitrate.droppingFrame = true
+			if video && !r.bitrate.waitingForKeyframe {
+				r.bitrate.waitingForKeyframe, r.bitrate.keyframeRequested = true, false
+			}
+		case r.bitrate.waitingForKeyframe && !isKeyframe(codec.Name, payload):
+			r.bitrate.droppingFrame = true
+		default:
+			r.bitrate.droppingFrame, r.bitrate.waitingForKeyframe = false, false
+		}
+
+		// The keyframe is requested once it fits in the budget, as nothing is
+		// sent while waiting for it the budget only grows until it arrives
+		if r.bitrate.waitingForKeyframe && !r.bitrate.keyframeRequested && r.bitrate.budget > 0 {
+			r.bitrate.keyframeRequested = true
+			// r.mu may be held by Send while it waits for the bitrate lock
+			go r.onKeyframeRequest()
+		}
+	}
+	if r.bitrate.droppingFrame {
+		return false
+	}
+
+	r.bitrate.budget -= float64(header.MarshalSize() + len(payload))
+	return true
+}
+
+// readRTCP processes all incoming RTCP for this RTPSender before
+// making it available to Read. It runs until the RTCP stream is closed
+func (r *RTPSender) readRTCP(stream *srtp.ReadStreamSRTCP, ssrc uint32) {
+	defer func() {
+		if err := r.rtcpBuffer.Close(); err != nil {
+			r.log.Warnf("Failed to close RTCP buffer: %v", err)
+		}
+	}()
+
+	b := make([]byte, receiveMTU)
+	for {
+		i, err := stream.Read(b)
+		if err != nil {
+			return
+		} else if err = r.receiveRTCP(b[:i], ssrc); err != nil {
+			return
+		}
+	}
+}
+
+// receiveRTCP handles RTCP read from the remote and buffers it until the user reads it
+func (r *RTPSender) receiveRTCP(raw []byte, ssrc uint32) error {
+	if pkts, err := rtcp.Unmarshal(raw); err == nil {
+		r.api.settingEngine.traceRTCP(false, pkts)
+		r.handleRTCP(pkts, ssrc)
+	}
+
+	// Silently drop RTCP the user isn't reading when the buffer is full
+	if _, err := r.rtcpBuffer.Write(raw); err != nil && err != packetio.ErrFull {
+		return err
+	}
+	return nil
+}
+
+// handleRTCP counts the feedback the remote sent for this RTPSender and
+// responds to the feedback the codec of the Track supports, the packets it
+// doesn't handle are passed to PeerConnection.OnRTCP
+func (r *RTPSender) handleRTCP(pkts []rtcp.Packet, ssrc uint32) {
+	pliReceived, firReceived := false, false
+	transportCCFeedback := []TransportCCFeedback{}
+	unhandled := []rtcp.Packet{}
+
+	r.stats.Lock()
+	for _, p := range pkts {
+		handled := false
+		switch p := p.(type) {
+		case *rtcp.TransportLayerNack:
+			if p.MediaSSRC == ssrc {
+				r.stats.nackCount++
+				handled = true
+			}
+		case *rtcp.PictureLossIndication:
+			if p.MediaSSRC == ssrc {
+				r.stats.pliCount++
+				pliReceived, handled = true, true
+			}
+		case *rtcp.RawPacket:
+			if isFullIntraRequest(p, ssrc) {
+				r.stats.firCount++
+				firReceived, handled = true, true
+			} else if isTransportCCFeedback(p) {
+				handled = true
+				feedback := TransportCCFeedback{}
+				if err := feedback.Unmarshal(*p); err != nil {
+					r.log.Warnf("Failed to unmarshal transport-wide congestion control feedback: %v", err)
+					continue
+				}
+				transportCCFeedback = append(transportCCFeedback, feedback)
+			}
+		case *rtcp.ReceiverEstimatedMaximumBitrate:
+			for _, estimatedSSRC := range p.SSRCs {
+				if estimatedSSRC != ssrc {
+					continue
+				}
+				handled = true
+				if r.pacer != nil {
+					r.pacer.setEstimate(uint64(float64(p.Bitrate) * pacingFactor))
+				}
+			}
+		}
+		if !handled {
+			unhandled = append(unhandled, p)
+		}
+	}
+	r.stats.Unlock()
+
+	r.transport.onUnhandledRTCP(unhandled, ssrc, nil, r)
+
+	if (pliReceived && r.negotiatedRTCPFeedback(TypeRTCPFBNACK, rtcpFeedbackParameterPLI)) ||
+		(firReceived && r.negotiatedRTCPFeedback(TypeRTCPFBCCM, rtcpFeedbackParameterFIR)) {
+		r.onKeyframeRequest()
+	}
+
+	r.mu.RLock()
+	onTransportCCFeedbackHandler := r.onTransportCCFeedbackHandler
+	r.mu.RUnlock()
+	if onTransportCCFeedbackHandler != nil {
+		for _, feedback := range transportCCFeedback {
+			onTransportCCFeedbackHandler(feedback)
+		}
+	}
+}
+
+// OnTransportCCFeedback sets an event handler which is called with the decoded
+// transport-wide congestion control feedback in the RTCP the RTPSender receives.
+// The handler is called from the goroutine that reads the RTCP, in the order
+// the feedback arrives. pion/srtp demultiplexes RTCP by its destination SSRCs,
+// so feedback only reaches the RTPSender in compound RTCP that also carries a
+// packet for its SSRC, or when it is passed to PeerConnection.InjectRTCP with one.
+func (r *RTPSender) OnTransportCCFeedback(f func(TransportCCFeedback)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onTransportCCFeedbackHandler = f
+}
+
+// SetPacerBitrate changes the bitrate in bits per second the pacer of the
+// RTPSender sends with, for example after a bandwidth estimate has changed. It
+// returns an error if the SettingEngine didn't enable pacing. Once the remote
+// sends a Receiver Estimated Maximum Bitrate the pacer doesn't exceed 2.5 times
+// the estimate either, so bursts that stay within the estimate on average leave
+// without queueing.
+//
+// Every RTPSender paces on its own. The bursts of several RTPSenders, like the
+// layers of a simulcast Track, can add up to more than one pacer allows on the
+// transport they share.
+func (r *RTPSender) SetPacerBitrate(bitsPerSecond uint64) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.pacer == nil {
+		return fmt.Errorf("pacing is not enabled, see SettingEngine.SetPacerBitrate")
+	} else if bitsPerSecond == 0 {
+		return fmt.Errorf("pacer bitrate must be greater than zero")
+	}
+
+	r.pacer.setBitrate(bitsPerSecond)
+	return nil
+}
+
+// OnKeyframeRequest sets an event handler which is called when the remote
+// requests a keyframe with a Picture Loss Indication or a Full Intra Request.
+// It is only called if the codec of the Track has the RTCPFeedback
+// {Type: "nack", Parameter: "pli"} or {Type: "ccm", Parameter: "fir"}
+// respectively, and it was negotiated for the media section, as only then the
+// remote may request keyframes that way. It is also called when MaxBitrate
+// dropped a video frame, see SetParameters.
+func (r *RTPSender) OnKeyframeRequest(f func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onKeyframeRequestHandler = f
+}
+
+func (r *RTPSender) onKeyframeRequest() {
+	r.mu.RLock()
+	hdlr := r.onKeyframeRequestHandler
+	r.mu.RUnlock()
+
+	if hdlr != nil {
+		go hdlr()
+	}
+}
+
+// isFullIntraRequest returns true if a RTCP packet that pion/rtcp doesn't know
+// is a Full Intra Request for the given SSRC, the format SendFIR sends
+func isFullIntraRequest(p *rtcp.RawPacket, ssrc uint32) bool {
+	header := p.Header()
+	if header.Type != rtcp.TypePayloadSpecificFeedback || header.Count != rtcpFeedbackFormatFIR {
+		return false
+	}
+
+	// Every FCI entry is the SSRC the request is for followed by a sequence number
+	raw := []byte(*p)
+	for i := 12; i+8 <= len(raw); i += 8 {
+		if binary.BigEndian.Uint32(raw[i:]) == ssrc {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiatedRTCPFeedback returns true if the codec of the Track has the given
+// RTCPFeedback, and the parameters passed to Send do as well if they have any
+func (r *RTPSender) negotiatedRTCPFeedback(feedbackType, parameter string) bool {
+	r.mu.RLock()
+	codec := r.track.Codec()
+	negotiated := r.parameters.RTCPFeedback
+	r.mu.RUnlock()
+
+	if codec == nil || !codec.hasRTCPFeedback(feedbackType, parameter) {
+		return false
+	}
+	if negotiated == nil {
+		return true
+	}
+	for _, feedback := range negotiated {
+		if feedback.Type == feedbackType && feedback.Parameter == parameter {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMaxLayers limits the layers of a scalable VP8 or VP9 stream that are sent
+// to the given spatial and temporal layer, so the remote receives a sub-stream
+// with a lower bitrate. The sequence numbers of the packets that are sent stay
+// continuous. Packets that don't identify their layer are always sent. Passing
+// 7 for both layers, the highest ID VP9 allows, sends all layers again.
+func (r *RTPSender) SetMaxLayers(spatialID, temporalID uint8) {
+	r.layers.Lock()
+	defer r.layers.Unlock()
+
+	r.layers.limit = true
+	r.layers.max = RTPLayer{SpatialID: spatialID, TemporalID: temporalID}
+}
+
+// filterLayer returns the header a packet is sent with, or false if the
+// packet is dropped because of SetMaxLayers or MaxBitrate
+func (r *RTPSender) filterLayer(header *rtp.Header, payload []byte) (*rtp.Header, bool) {
+	r.layers.Lock()
+	defer r.layers.Unlock()
+	r.bitrate.Lock()
+	defer r.bitrate.Unlock()
+
+	return r.filterLayerLocked(header, payload, time.Now())
+}
+
+// filterLayerLocked is filterLayer for a caller that holds the layers and
+// bitrate locks, in that order
+func (r *RTPSender) filterLayerLocked(header *rtp.Header, payload []byte, now time.Time) (*rtp.Header, bool) {
+	if !r.layers.limit {
+		if !r.limitBitrate(header, payload, now) {
+			r.layers.dropped++
+			return nil, false
+		} else if r.layers.dropped == 0 {
+			r.layers.sent, r.layers.lastSequenceNumber = true, header.SequenceNumber
+			return header, true
+		}
+
+		filtered := *header
+		filtered.SequenceNumber -= r.layers.dropped
+		r.layers.sent, r.layers.lastSequenceNumber = true, filtered.SequenceNumber
+		return &filtered, true
+	}
+
+	filtered := *header
+	if codec := r.track.Codec(); codec != nil {
+		if layer, ok := ParseRTPLayer(codec.Name, payload); ok {
+			if layer.SpatialID > r.layers.max.SpatialID || layer.TemporalID > r.layers.max.TemporalID {
+				r.layers.dropped++
+				return nil, false
+			}
+
+			// The end of the highest spatial layer that is sent ends the picture
+			if strings.EqualFold(codec.Name, VP9) && layer.SpatialID == r.layers.max.SpatialID && payload[0]&0x04 != 0 {
+				filtered.Marker = true
+			}
+		}
+	}
+
+	if !r.limitBitrate(header, payload, now) {
+		r.layers.dropped++
+		return nil, false
+	}
+	filtered.SequenceNumber -= r.layers.dropped
+	r.layers.sent, r.layers.lastSequenceNumber = true, filtered.SequenceNumber
+	return &filtered, true
+}
+
+// addHeaderExtensions adds the negotiated header extensions the Track has
+// values for to a packet that is sent
+func (r *RTPSender) addHeaderExtensions(header *rtp.Header) *rtp.Header {
+	if r.playoutDelayID == 0 {
+		return header
+	}
+
+	r.track.mu.RLock()
+	playoutDelay := r.track.playoutDelay
+	r.track.mu.RUnlock()
+	if playoutDelay == nil {
+		return header
+	}
+	return withOneByteHeaderExtension(header, r.playoutDelayID, playoutDelay)
+}
+
+// SetContributingSources sets the CSRCs of every RTP packet the RTPSender sends,
+// replacing the ones the packets were written with, e.g. to list the sources of
+// mixed audio that is forwarded. An empty list removes the CSRCs of the packets,
+// nil sends the CSRCs they were written with again. At most 15 CSRCs fit in a
+// RTP header.
+func (r *RTPSender) SetContributingSources(csrc []uint32) error {
+	if len(csrc) > 15 {
+		return fmt.Errorf("RTP packets can not list more than 15 CSRCs, got %d", len(csrc))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if csrc == nil {
+		r.csrc = nil
+	} else {
+		r.csrc = append([]uint32{}, csrc...)
+	}
+	return nil
+}
+
+// withContributingSources returns the header with the CSRCs of SetContributingSources
+func (r *RTPSender) withContributingSources(header *rtp.Header) *rtp.Header {
+	r.mu.RLock()
+	csrc := r.csrc
+	r.mu.RUnlock()
+	if csrc == nil {
+		return header
+	}
+
+	withCSRC := *header
+	withCSRC.CSRC = csrc
+	return &withCSRC
+}
+
+// nextPaddingSequenceNumber returns the sequence number that follows the last
+// packet sent, the packets sent afterwards are shifted past it. It returns false
+// if no packet has been sent yet.
+func (r *RTPSender) nextPaddingSequenceNumber() (uint16, bool) {
+	r.layers.Lock()
+	defer r.layers.Unlock()
+
+	if !r.layers.sent {
+		return 0, false
+	}
+	r.layers.lastSequenceNumber++
+	r.layers.dropped--
+	return r.layers.lastSequenceNumber, true
+}
+
+// onRTPSent counts a RTP packet that has been sent
+func (r *RTPSender) onRTPSent(payload []byte) {
+	r.stats.Lock()
+	defer r.stats.Unlock()
+
+	r.stats.packetsSent++
+	r.stats.bytesSent += uint64(len(payload))
+}
+
+func (r *RTPSender) collectStats(collector *statsReportCollector) {
+	collector.Collecting()
+
+	r.stats.Lock()
+	defer r.stats.Unlock()
+
+	collector.Collect(r.statsID, OutboundRTPStreamStats{
+		Timestamp:   statsTimestampNow(),
+		Type:        StatsTypeOutboundRTP,
+		ID:          r.statsID,
+		SSRC:        r.track.SSRC(),
+		Kind:        r.track.Kind().String(),
+		FIRCount:    r.stats.firCount,
+		PLICount:    r.stats.pliCount,
+		NACKCount:   r.stats.nackCount,
+		PacketsSent: r.stats.packetsSent,
+		BytesSent:   r.stats.bytesSent,
+	})
+}
+
 // Stop irreversibly stops the RTPSender
 func (r *RTPSender) Stop() error {
 	r.mu.Lock()
@@ -108,11 +735,11 @@ func (r *RTPSender) Stop() error {
 	for _, s := range r.track.activeSenders {
 		if s != r {
 			filtered = append(filtered, s)
-		} else {
-			r.track.totalSenderCount--
 		}
 	}
 	r.track.activeSenders = filtered
+	r.track.totalSenderCount--
+	r.track.senderCountChanged()
 	close(r.stopCalled)
 
 	if r.hasSent() {
@@ -122,10 +749,17 @@ func (r *RTPSender) Stop() error {
 	return nil
 }
 
-// Read reads incoming RTCP for this RTPReceiver
+// Read reads incoming RTCP for this RTPSender. It fails with io.ErrClosedPipe
+// if the RTPSender is stopped before Send was called.
 func (r *RTPSender) Read(b []byte) (n int, err error) {
-	<-r.sendCalled
-	return r.rtcpReadStream.Read(b)
+	select {
+	case <-r.sendCalled:
+	case <-r.stopCalled:
+		if !r.hasSent() {
+			return 0, io.ErrClosedPipe
+		}
+	}
+	return r.rtcpBuffer.Read(b)
 }
 
 // ReadRTCP is a convenience method that wraps Read and unmarshals for you
@@ -141,21 +775,154 @@ func (r *RTPSender) ReadRTCP() ([]rtcp.Packet, error) {
 
 // sendRTP should only be called by a track, this only exists so we can keep state in one place
 func (r *RTPSender) sendRTP(header *rtp.Header, payload []byte) (int, error) {
+	writeStream, err := r.getWriteStream()
+	if err != nil {
+		return 0, err
+	} else if r.paused.get() {
+		return 0, nil
+	}
+
+	header, send := r.filterLayer(header, payload)
+	if !send {
+		return 0, nil
+	}
+	return r.sendFiltered(writeStream, header, payload)
+}
+
+// sendFiltered sends a packet filterLayer has let through, or SendPadding created,
+// with the header extensions and CSRCs of the RTPSender. It goes through the pacer
+// if there is one.
+func (r *RTPSender) sendFiltered(writeStream *srtp.WriteStreamSRTP, header *rtp.Header, payload []byte) (int, error) {
+	header = r.addHeaderExtensions(header)
+	header = r.withContributingSources(header)
+
+	if r.pacer != nil {
+		if !r.pacer.enqueue(header, payload) {
+			r.log.Debugf("Pacer queue of RTPSender is full, dropping packet")
+		}
+		return header.MarshalSize() + len(payload), nil
+	}
+
+	n, err := writeStream.WriteRTP(header, payload)
+	if err == nil {
+		r.onRTPSent(payload)
+		r.api.settingEngine.traceRTP(true, header)
+	}
+	return n, err
+}
+
+// writeRTP is how the pacer sends the packets it has queued
+func (r *RTPSender) writeRTP(header *rtp.Header, payload []byte) error {
+	writeStream, err := r.getWriteStream()
+	if err != nil {
+		return err
+	}
+
+	if _, err := writeStream.WriteRTP(header, payload); err != nil {
+		return err
+	}
+	r.onRTPSent(payload)
+	r.api.settingEngine.traceRTP(true, header)
+	return nil
+}
+
+// sendRTPBatch should only be called by a track, it writes all packets in order
+// while only resolving the SRTP write stream and taking the layers and bitrate
+// locks once
+func (r *RTPSender) sendRTPBatch(packets []*rtp.Packet) error {
+	writeStream, err := r.getWriteStream()
+	if err != nil {
+		return err
+	} else if r.paused.get() {
+		return nil
+	}
+
+	headers := make([]*rtp.Header, len(packets))
+	r.layers.Lock()
+	r.bitrate.Lock()
+	now := time.Now()
+	for i, p := range packets {
+		if header, send := r.filterLayerLocked(&p.Header, p.Payload, now); send {
+			headers[i] = header
+		}
+	}
+	r.bitrate.Unlock()
+	r.layers.Unlock()
+
+	for i, p := range packets {
+		if headers[i] == nil {
+			continue
+		}
+		if _, err := r.sendFiltered(writeStream, headers[i], p.Payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendPadding sends RTP packets that carry nothing but the given number of bytes
+// of padding, which can be used to probe the available bandwidth. The packets use
+// the SSRC, PayloadType and latest timestamp of the Track, and the sequence numbers
+// that follow the last packet this RTPSender sent. The packets written afterwards
+// are shifted past them, so the remote sees no gap. Like media, padding goes
+// through the pacer and isn't sent while the RTPSender is paused. Padding can only
+// be sent after the first packet.
+func (r *RTPSender) SendPadding(bytes int) error {
+	if bytes <= 0 {
+		return fmt.Errorf("padding must be at least one byte")
+	}
+
+	writeStream, err := r.getWriteStream()
+	if err != nil {
+		return err
+	} else if r.paused.get() {
+		return nil
+	}
+
+	r.track.mu.RLock()
+	template := rtp.Header{
+		Version:     2,
+		Padding:     true,
+		PayloadType: r.track.payloadType,
+		Timestamp:   r.track.lastRTPTimestamp,
+		SSRC:        r.track.ssrc,
+	}
+	r.track.mu.RUnlock()
+
+	for ; bytes > 0; bytes -= rtpMaxPaddingSize {
+		// The last byte of the padding holds its size, so a packet can carry at most 255 bytes
+		size := bytes
+		if size > rtpMaxPaddingSize {
+			size = rtpMaxPaddingSize
+		}
+		padding := make([]byte, size)
+		padding[size-1] = byte(size)
+
+		header := template
+		sequenceNumber, ok := r.nextPaddingSequenceNumber()
+		if !ok {
+			return fmt.Errorf("padding can't be sent before the first packet")
+		}
+		header.SequenceNumber = sequenceNumber
+		if _, err := r.sendFiltered(writeStream, &header, padding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getWriteStream blocks until Send has been called and returns the SRTP stream RTP should be written to
+func (r *RTPSender) getWriteStream() (*srtp.WriteStreamSRTP, error) {
 	select {
 	case <-r.stopCalled:
-		return 0, fmt.Errorf("RTPSender has been stopped")
+		return nil, fmt.Errorf("RTPSender has been stopped")
 	case <-r.sendCalled:
 		srtpSession, err := r.transport.getSRTPSession()
 		if err != nil {
-			return 0, err
-		}
-
-		writeStream, err := srtpSession.OpenWriteStream()
-		if err != nil {
-			return 0, err
+			return nil, err
 		}
 
-		return writeStream.WriteRTP(header, payload)
+		return srtpSession.OpenWriteStream()
 	}
 }
 
@@ -3,4 +3,12 @@ package webrtc
 // RTPSendParameters contains the RTP stack settings used by receivers
 type RTPSendParameters struct {
 	Encodings RTPEncodingParameters
+
+	// HeaderExtensions are the negotiated RTP header extensions the RTPSender
+	// adds to the packets it sends
+	HeaderExtensions []RTPHeaderExtensionParameters
+
+	// RTCPFeedback is the RTCP feedback negotiated for the codec the RTPSender
+	// sends with. If it is nil the RTCPFeedback of the codec is used alone.
+	RTCPFeedback []RTCPFeedback
 }
@@ -4,6 +4,7 @@ package webrtc
 
 import (
 	"fmt"
+	"strings"
 	"sync/atomic"
 )
 
@@ -13,8 +14,23 @@ type RTPTransceiver struct {
 	receiver  atomic.Value // *RTPReceiver
 	direction atomic.Value // RTPTransceiverDirection
 
+	mid              atomic.Value // string
+	headerExtensions atomic.Value // []RTPHeaderExtensionParameters
+	payloadTypes     atomic.Value // map[uint8]*RTPCodec
+	codecs           atomic.Value // []*RTPCodec
+	simulcastReceive atomic.Value // []RIDParameters
+
+	// mirrorRemote is set by PeerConnection.MirrorRemoteOffer
+	mirrorRemote atomicBool
+
 	stopped bool
 	kind    RTPCodecType
+
+	// mediaEngine holds the codecs that codec preferences can be set to
+	mediaEngine *MediaEngine
+
+	// onNegotiationNeeded is called when SetDirection changes the direction
+	onNegotiationNeeded func()
 }
 
 // Sender returns the RTPTransceiver's RTPSender if it has one
@@ -44,6 +60,131 @@ func (t *RTPTransceiver) Direction() RTPTransceiverDirection {
 	return t.direction.Load().(RTPTransceiverDirection)
 }
 
+// SetDirection changes the direction the RTPTransceiver is offered with. The
+// change takes effect with the next offer/answer exchange, which is signaled
+// with PeerConnection.OnNegotiationNeeded. While the direction doesn't include
+// sending, the packets written to the Track of the RTPSender are dropped.
+func (t *RTPTransceiver) SetDirection(d RTPTransceiverDirection) error {
+	switch d {
+	case RTPTransceiverDirectionSendrecv, RTPTransceiverDirectionSendonly:
+		if t.Sender() == nil {
+			return fmt.Errorf("RTPTransceiver can not send without a RTPSender, use AddTrack instead")
+		}
+	case RTPTransceiverDirectionRecvonly, RTPTransceiverDirectionInactive:
+	default:
+		return fmt.Errorf("invalid RTPTransceiverDirection %d", d)
+	}
+
+	if d == t.Direction() {
+		return nil
+	}
+	t.setDirection(d)
+	if sender := t.Sender(); sender != nil {
+		sender.paused.set(d != RTPTransceiverDirectionSendrecv && d != RTPTransceiverDirectionSendonly)
+	}
+
+	if t.onNegotiationNeeded != nil {
+		t.onNegotiationNeeded()
+	}
+	return nil
+}
+
+// HeaderExtensions returns the RTP header extensions the remote declared in
+// the media section of this RTPTransceiver, which are the IDs used by the RTP
+// packets the remote sends. It is empty until the media section is matched
+// with a remote description.
+func (t *RTPTransceiver) HeaderExtensions() []RTPHeaderExtensionParameters {
+	v, _ := t.headerExtensions.Load().([]RTPHeaderExtensionParameters)
+	return append([]RTPHeaderExtensionParameters{}, v...)
+}
+
+func (t *RTPTransceiver) setHeaderExtensions(headerExtensions []RTPHeaderExtensionParameters) {
+	t.headerExtensions.Store(headerExtensions)
+}
+
+// PayloadTypes returns the codecs of the media section of this RTPTransceiver
+// keyed by their negotiated PayloadType, which is the one of the answer. Only
+// codecs registered in the MediaEngine are included. It is empty until the
+// answer has been set as local or remote description.
+func (t *RTPTransceiver) PayloadTypes() map[uint8]*RTPCodec {
+	payloadTypes := map[uint8]*RTPCodec{}
+	v, _ := t.payloadTypes.Load().(map[uint8]*RTPCodec)
+	for payloadType, codec := range v {
+		payloadTypes[payloadType] = codec
+	}
+	return payloadTypes
+}
+
+func (t *RTPTransceiver) setPayloadTypes(payloadTypes map[uint8]*RTPCodec) {
+	t.payloadTypes.Store(payloadTypes)
+	if r := t.Receiver(); r != nil {
+		r.setPayloadTypes(payloadTypes)
+	}
+}
+
+// SetCodecPreferences sets the codecs the media section of this RTPTransceiver
+// is offered or answered with, in order of preference. The codecs must be
+// registered in the MediaEngine and be of the kind of the RTPTransceiver. An
+// empty list restores the codecs of the MediaEngine. The preferences are used
+// by the next description that is created.
+func (t *RTPTransceiver) SetCodecPreferences(codecs []*RTPCodec) error {
+	for _, codec := range codecs {
+		if codec.Type != t.kind {
+			return fmt.Errorf("codec %s is not a %s codec", codec.Name, t.kind)
+		}
+
+		registered, err := t.mediaEngine.getCodec(codec.PayloadType)
+		if err != nil || !strings.EqualFold(registered.Name, codec.Name) {
+			return ErrUnregisteredPayloadType
+		}
+	}
+
+	t.codecs.Store(append([]*RTPCodec{}, codecs...))
+	return nil
+}
+
+// getCodecPreferences returns the codecs set with SetCodecPreferences
+func (t *RTPTransceiver) getCodecPreferences() []*RTPCodec {
+	codecs, _ := t.codecs.Load().([]*RTPCodec)
+	return codecs
+}
+
+// SetSimulcastReceive sets the layers of a simulcast set the RTPTransceiver
+// receives. Descriptions created afterwards announce them with a=rid recv and
+// a=simulcast recv lines in the media section of the RTPTransceiver, and
+// negotiate the RTP header extension with the RID of the layers. The Direction
+// of the layers is ignored. An empty list receives a single stream again.
+func (t *RTPTransceiver) SetSimulcastReceive(rids []RIDParameters) error {
+	seen := map[string]bool{}
+	for _, rid := range rids {
+		if rid.ID == "" || strings.ContainsAny(rid.ID, " ;,") {
+			return fmt.Errorf("invalid RID %q", rid.ID)
+		} else if seen[rid.ID] {
+			return fmt.Errorf("RID %s is used more than once", rid.ID)
+		}
+		seen[rid.ID] = true
+	}
+
+	t.simulcastReceive.Store(append([]RIDParameters{}, rids...))
+	return nil
+}
+
+// getSimulcastReceive returns the layers set with SetSimulcastReceive
+func (t *RTPTransceiver) getSimulcastReceive() []RIDParameters {
+	rids, _ := t.simulcastReceive.Load().([]RIDParameters)
+	return rids
+}
+
+// getMid returns the mid of the media section the RTPTransceiver was last put in
+func (t *RTPTransceiver) getMid() string {
+	v, _ := t.mid.Load().(string)
+	return v
+}
+
+func (t *RTPTransceiver) setMid(mid string) {
+	t.mid.Store(mid)
+}
+
 // Stop irreversibly stops the RTPTransceiver
 func (t *RTPTransceiver) Stop() error {
 	if t.Sender() != nil {
@@ -62,6 +203,9 @@ func (t *RTPTransceiver) Stop() error {
 }
 
 func (t *RTPTransceiver) setReceiver(r *RTPReceiver) {
+	if payloadTypes, ok := t.payloadTypes.Load().(map[uint8]*RTPCodec); ok && r != nil {
+		r.setPayloadTypes(payloadTypes)
+	}
 	t.receiver.Store(r)
 }
 
@@ -90,6 +234,18 @@ func (t *RTPTransceiver) setSendingTrack(track *Track) error {
 	return nil
 }
 
+// findByMid plucks the transceiver of the given kind that is already associated
+// with the mid from the passed list, or returns nil if there is none
+func findByMid(mid string, kind RTPCodecType, localTransceivers []*RTPTransceiver) (*RTPTransceiver, []*RTPTransceiver) {
+	for i, t := range localTransceivers {
+		if t.kind == kind && t.getMid() == mid {
+			return t, append(localTransceivers[:i], localTransceivers[i+1:]...)
+		}
+	}
+
+	return nil, localTransceivers
+}
+
 // Given a direction+type pluck a transceiver from the passed list
 // if no entry satisfies the requested type+direction return a inactive Transceiver
 func satisfyTypeAndDirection(remoteKind RTPCodecType, remoteDirection RTPTransceiverDirection, localTransceivers []*RTPTransceiver) (*RTPTransceiver, []*RTPTransceiver) {
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"io"
 	"math"
+	"sort"
 	"sync"
 	"time"
 
@@ -17,6 +18,9 @@ import (
 
 const sctpMaxChannels = uint16(65535)
 
+// defaultMaxMessageSize is assumed when the remote doesn't signal max-message-size
+const defaultMaxMessageSize = 65536
+
 // SCTPTransport provides details about the SCTP transport.
 type SCTPTransport struct {
 	lock sync.RWMutex
@@ -63,7 +67,7 @@ func (api *API) NewSCTPTransport(dtls *DTLSTransport) *SCTPTransport {
 		log:           api.settingEngine.LoggerFactory.NewLogger("ortc"),
 	}
 
-	res.updateMessageSize()
+	res.updateMessageSize(defaultMaxMessageSize)
 	res.updateMaxChannels()
 
 	return res
@@ -105,6 +109,7 @@ func (r *SCTPTransport) Start(remoteCaps SCTPCapabilities) error {
 
 	r.association = sctpAssociation
 	r.state = SCTPTransportStateConnected
+	r.setMessageSize(remoteCaps.MaxMessageSize)
 
 	go r.acceptDataChannels(sctpAssociation)
 
@@ -193,6 +198,8 @@ func (r *SCTPTransport) acceptDataChannels(a *sctp.Association) {
 			return
 		}
 
+		rtcDC.sctpTransport = r
+
 		<-r.onDataChannel(rtcDC)
 		rtcDC.handleOpen(dc)
 
@@ -264,14 +271,19 @@ func (r *SCTPTransport) onDataChannel(dc *DataChannel) (done chan struct{}) {
 	return
 }
 
-func (r *SCTPTransport) updateMessageSize() {
+// updateMessageSize limits the messages that can be sent to the size the
+// remote accepts, 0 meaning the remote accepts messages of any size
+func (r *SCTPTransport) updateMessageSize(remoteMaxMessageSize uint32) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
-	var remoteMaxMessageSize float64 = 65536 // pion/webrtc#758
-	var canSendSize float64 = 65536          // pion/webrtc#758
+	r.setMessageSize(remoteMaxMessageSize)
+}
 
-	r.maxMessageSize = r.calcMessageSize(remoteMaxMessageSize, canSendSize)
+func (r *SCTPTransport) setMessageSize(remoteMaxMessageSize uint32) {
+	var canSendSize float64 = math.MaxUint16 // largest message pion/sctp sends
+
+	r.maxMessageSize = r.calcMessageSize(float64(remoteMaxMessageSize), canSendSize)
 }
 
 func (r *SCTPTransport) calcMessageSize(remoteMaxMessageSize, canSendSize float64) float64 {
@@ -296,9 +308,21 @@ func (r *SCTPTransport) calcMessageSize(remoteMaxMessageSize, canSendSize float6
 
 func (r *SCTPTransport) updateMaxChannels() {
 	val := sctpMaxChannels
+	if r.api.settingEngine.sctp.MaxChannels != 0 {
+		val = r.api.settingEngine.sctp.MaxChannels
+	}
 	r.maxChannels = &val
 }
 
+// MaxMessageSize is the maximum size of the messages that can be sent with
+// DataChannel.Send and SendText.
+func (r *SCTPTransport) MaxMessageSize() float64 {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.maxMessageSize
+}
+
 // MaxChannels is the maximum number of RTCDataChannels that can be open simultaneously.
 func (r *SCTPTransport) MaxChannels() uint16 {
 	r.lock.Lock()
@@ -311,6 +335,25 @@ func (r *SCTPTransport) MaxChannels() uint16 {
 	return *r.maxChannels
 }
 
+// StreamIDs returns the SCTP stream IDs of the DataChannels that are open, in
+// increasing order, so its length is the number of open DataChannels. The
+// DataChannels opened by the DTLS client use even IDs, the ones opened by the
+// DTLS server odd IDs.
+func (r *SCTPTransport) StreamIDs() []uint16 {
+	r.lock.RLock()
+	dataChannels := append([]*DataChannel{}, r.dataChannels...)
+	r.lock.RUnlock()
+
+	ids := []uint16{}
+	for _, d := range dataChannels {
+		if id := d.ID(); id != nil && d.ReadyState() == DataChannelStateOpen {
+			ids = append(ids, *id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
 // State returns the current state of the SCTPTransport
 func (r *SCTPTransport) State() SCTPTransportState {
 	r.lock.RLock()
@@ -358,7 +401,7 @@ func (r *SCTPTransport) generateAndSetDataChannelID(dtlsRole DTLSRole, idOut **u
 
 	r.lock.Lock()
 	defer r.lock.Unlock()
-	for ; id < max-1; id += 2 {
+	for ; id < max; id += 2 {
 		if isChannelWithID(id) {
 			continue
 		}
@@ -2,7 +2,13 @@
 
 package webrtc
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/transport/test"
+	"github.com/stretchr/testify/assert"
+)
 
 func TestGenerateDataChannelID(t *testing.T) {
 	sctpTransportWithChannels := func(ids []uint16) *SCTPTransport {
@@ -43,4 +49,64 @@ func TestGenerateDataChannelID(t *testing.T) {
 			t.Errorf("Wrong id: %d expected %d", *idPtr, testCase.result)
 		}
 	}
+	// IDs up to MaxChannels - 1 are generated
+	maxChannels := uint16(4)
+	s := sctpTransportWithChannels([]uint16{1})
+	s.maxChannels = &maxChannels
+	idPtr := new(uint16)
+	if err := s.generateAndSetDataChannelID(DTLSRoleServer, &idPtr); err != nil {
+		t.Errorf("failed to generate id: %v", err)
+	} else if *idPtr != 3 {
+		t.Errorf("Wrong id: %d expected %d", *idPtr, 3)
+	}
+
+	s.dataChannels = append(s.dataChannels, &DataChannel{id: idPtr})
+	if err := s.generateAndSetDataChannelID(DTLSRoleServer, &idPtr); err == nil {
+		t.Errorf("expected an error once all ids are used")
+	}
+}
+
+func TestSCTPTransport_StreamIDs(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	pcOffer, pcAnswer, err := newPair()
+	assert.NoError(t, err)
+
+	awaitStreamIDs := func(expected []uint16) {
+		for {
+			if offered, answered := pcOffer.SCTP().StreamIDs(), pcAnswer.SCTP().StreamIDs(); assert.ObjectsAreEqual(expected, offered) && assert.ObjectsAreEqual(expected, answered) {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	assert.Equal(t, []uint16{}, pcOffer.SCTP().StreamIDs())
+
+	// The offerer is the DTLS client and uses even IDs
+	_, err = pcOffer.CreateDataChannel("first", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, signalPair(pcOffer, pcAnswer))
+	awaitStreamIDs([]uint16{0, 2})
+
+	// The answerer is the DTLS server and uses odd IDs
+	answered, err := pcAnswer.CreateDataChannel("answered", nil)
+	assert.NoError(t, err)
+	awaitStreamIDs([]uint16{0, 1, 2})
+	if assert.NotNil(t, answered.ID()) {
+		assert.Equal(t, uint16(1), *answered.ID())
+	}
+
+	offered, err := pcOffer.CreateDataChannel("second", nil)
+	assert.NoError(t, err)
+	awaitStreamIDs([]uint16{0, 1, 2, 4})
+	if assert.NotNil(t, offered.ID()) {
+		assert.Equal(t, uint16(4), *offered.ID())
+	}
+
+	// Closed DataChannels are no longer counted
+	assert.NoError(t, answered.Close())
+	awaitStreamIDs([]uint16{0, 2, 4})
+
+	closePairNow(t, pcOffer, pcAnswer)
 }
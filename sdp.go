@@ -4,7 +4,9 @@ package webrtc
 
 import (
 	"fmt"
+	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -17,17 +19,37 @@ type trackDetails struct {
 	label string
 	id    string
 	ssrc  uint32
+
+	// frameMarkingID is the ID of the frame marking header extension, zero when not negotiated
+	frameMarkingID uint8
+
+	// rtxSSRC is the SSRC of the RTX repair flow grouped with this track, zero if there is none
+	rtxSSRC uint32
+
+	// simulcast is set if the track is a layer of a simulcast set
+	simulcast bool
+
+	// rids are the a=rid lines of the media section of the track
+	rids []RIDParameters
 }
 
+// semanticTokenSimulcast groups the SSRCs of the layers of a simulcast set, as
+// browsers signal them when simulcast is enabled by SDP munging
+const semanticTokenSimulcast = "SIM"
+
 // extract all trackDetails from an SDP.
 func trackDetailsFromSDP(log logging.LeveledLogger, s *sdp.SessionDescription) map[uint32]trackDetails {
 	incomingTracks := map[uint32]trackDetails{}
 	rtxRepairFlows := map[uint32]bool{}
+	rtxSSRCs := map[uint32]uint32{} // primary SSRC to the SSRC of its repair flow
+	simulcastSSRCs := map[uint32]bool{}
 
 	for _, media := range s.MediaDescriptions {
 		// Plan B can have multiple tracks in a signle media section
 		trackLabel := ""
 		trackID := ""
+		frameMarkingID := frameMarkingIDFromSDP(media)
+		rids := ridsFromSDP(log, media)
 
 		// If media section is recvonly or inactive skip
 		if _, ok := media.Attribute(sdp.AttrKeyRecvOnly); ok {
@@ -51,7 +73,7 @@ func trackDetailsFromSDP(log logging.LeveledLogger, s *sdp.SessionDescription) m
 					// as this declares that the second SSRC (632943048) is a rtx repair flow (RFC4588) for the first
 					// (2231627014) as specified in RFC5576
 					if len(split) == 3 {
-						_, err := strconv.ParseUint(split[1], 10, 32)
+						primary, err := strconv.ParseUint(split[1], 10, 32)
 						if err != nil {
 							log.Warnf("Failed to parse SSRC: %v", err)
 							continue
@@ -62,8 +84,19 @@ func trackDetailsFromSDP(log logging.LeveledLogger, s *sdp.SessionDescription) m
 							continue
 						}
 						rtxRepairFlows[uint32(rtxRepairFlow)] = true
+						rtxSSRCs[uint32(primary)] = uint32(rtxRepairFlow)
 						delete(incomingTracks, uint32(rtxRepairFlow)) // Remove if rtx was added as track before
 					}
+				} else if split[0] == semanticTokenSimulcast {
+					// Lines like `a=ssrc-group:SIM 1026713227 2912399520 3526410530` list the layers of a simulcast set
+					for _, layer := range split[1:] {
+						ssrc, err := strconv.ParseUint(layer, 10, 32)
+						if err != nil {
+							log.Warnf("Failed to parse SSRC: %v", err)
+							continue
+						}
+						simulcastSSRCs[uint32(ssrc)] = true
+					}
 				}
 
 			// Handle `a=msid:<stream_id> <track_label>` for Unified plan. The first value is the same as MediaStream.id
@@ -97,14 +130,85 @@ func trackDetailsFromSDP(log logging.LeveledLogger, s *sdp.SessionDescription) m
 
 				// Plan B might send multiple a=ssrc lines under a single m= section. This is also why a single trackDetails{}
 				// is not defined at the top of the loop over s.MediaDescriptions.
-				incomingTracks[uint32(ssrc)] = trackDetails{codecType, trackLabel, trackID, uint32(ssrc)}
+				incomingTracks[uint32(ssrc)] = trackDetails{kind: codecType, label: trackLabel, id: trackID, ssrc: uint32(ssrc), frameMarkingID: frameMarkingID, rids: rids}
 			}
 		}
 	}
 
+	for ssrc, rtxSSRC := range rtxSSRCs {
+		if incoming, ok := incomingTracks[ssrc]; ok {
+			incoming.rtxSSRC = rtxSSRC
+			incomingTracks[ssrc] = incoming
+		}
+	}
+	for ssrc := range simulcastSSRCs {
+		if incoming, ok := incomingTracks[ssrc]; ok {
+			incoming.simulcast = true
+			incomingTracks[ssrc] = incoming
+		}
+	}
+
+	// A stream with a colliding SSRC can't be told apart from the other one
+	for _, ssrc := range ssrcCollisionsFromSDP(s) {
+		delete(incomingTracks, ssrc)
+	}
+
 	return incomingTracks
 }
 
+// ssrcCollisionsFromSDP returns the SSRCs the remote sends in more than one
+// media section or for more than one track
+// https://tools.ietf.org/html/rfc3550#section-8.2
+func ssrcCollisionsFromSDP(s *sdp.SessionDescription) []uint32 {
+	type ssrcOwner struct {
+		media int
+		msid  string
+	}
+	owners := map[uint32]ssrcOwner{}
+	collided := map[uint32]bool{}
+	collisions := []uint32{}
+
+	for i, media := range s.MediaDescriptions {
+		if NewRTPCodecType(media.MediaName.Media) == 0 {
+			continue
+		} else if _, ok := media.Attribute(sdp.AttrKeyRecvOnly); ok {
+			continue
+		} else if _, ok := media.Attribute(sdp.AttrKeyInactive); ok {
+			continue
+		}
+
+		for _, attr := range media.Attributes {
+			if attr.Key != sdp.AttrKeySSRC {
+				continue
+			}
+
+			split := strings.Split(attr.Value, " ")
+			ssrc, err := strconv.ParseUint(split[0], 10, 32)
+			if err != nil || collided[uint32(ssrc)] {
+				continue
+			}
+			owner := ssrcOwner{media: i}
+			if len(split) == 3 && strings.HasPrefix(split[1], "msid:") {
+				owner.msid = split[1] + " " + split[2]
+			}
+
+			// The a=ssrc lines of a track repeat the SSRC, only some of them carry the msid
+			existing, ok := owners[uint32(ssrc)]
+			if !ok || (existing.media == i && existing.msid == "") {
+				owners[uint32(ssrc)] = owner
+				continue
+			} else if existing.media == i && (owner.msid == "" || owner.msid == existing.msid) {
+				continue
+			}
+
+			collided[uint32(ssrc)] = true
+			collisions = append(collisions, uint32(ssrc))
+		}
+	}
+
+	return collisions
+}
+
 func addCandidatesToMediaDescriptions(candidates []ICECandidate, m *sdp.MediaDescription, iceGatheringState ICEGatheringState) {
 	appendCandidateIfNew := func(c sdp.ICECandidate, attributes []sdp.Attribute) {
 		marshaled := c.Marshal()
@@ -165,6 +269,19 @@ func addDataMediaSection(d *sdp.SessionDescription, midValue string, iceParams I
 	d.WithMedia(media)
 }
 
+// addRejectedDataMediaSection adds an application media section with port 0,
+// which rejects the one of the offer
+func addRejectedDataMediaSection(d *sdp.SessionDescription) {
+	d.WithMedia(&sdp.MediaDescription{
+		MediaName: sdp.MediaName{
+			Media:   "application",
+			Port:    sdp.RangedPort{Value: 0},
+			Protos:  []string{"DTLS", "SCTP"},
+			Formats: []string{"5000"},
+		},
+	})
+}
+
 func addFingerprints(d *sdp.SessionDescription, c Certificate) error {
 	// pion/webrtc#753
 	fingerprints, err := c.GetFingerprints()
@@ -197,12 +314,13 @@ func populateLocalCandidates(sessionDescription *SessionDescription, i *ICEGathe
 	}
 
 	return &SessionDescription{
-		SDP:  string(sdp),
-		Type: sessionDescription.Type,
+		SDP:    string(sdp),
+		Type:   sessionDescription.Type,
+		parsed: parsed,
 	}
 }
 
-func addTransceiverSDP(d *sdp.SessionDescription, isPlanB bool, mediaEngine *MediaEngine, midValue string, iceParams ICEParameters, candidates []ICECandidate, dtlsRole sdp.ConnectionRole, iceGatheringState ICEGatheringState, transceivers ...*RTPTransceiver) (bool, error) {
+func addTransceiverSDP(d *sdp.SessionDescription, isPlanB bool, mediaEngine *MediaEngine, midValue string, iceParams ICEParameters, candidates []ICECandidate, dtlsRole sdp.ConnectionRole, iceGatheringState ICEGatheringState, remoteMedia *sdp.MediaDescription, headerExtensions []RTPHeaderExtensionParameters, transceivers ...*RTPTransceiver) (bool, error) {
 	if len(transceivers) < 1 {
 		return false, fmt.Errorf("addTransceiverSDP() called with 0 transceivers")
 	}
@@ -216,11 +334,24 @@ func addTransceiverSDP(d *sdp.SessionDescription, isPlanB bool, mediaEngine *Med
 		WithPropertyAttribute(sdp.AttrKeyRTCPRsize)
 
 	codecs := mediaEngine.GetCodecsByKind(t.kind)
+	if preferred := t.getCodecPreferences(); len(preferred) != 0 {
+		codecs = preferred
+	}
+	if remoteMedia != nil {
+		var err error
+		if codecs, err = mirrorPayloadTypes(codecs, remoteMedia); err != nil {
+			return false, err
+		}
+	}
 	for _, codec := range codecs {
 		media.WithCodec(codec.PayloadType, codec.Name, codec.ClockRate, codec.Channels, codec.SDPFmtpLine)
 
 		for _, feedback := range codec.RTPCodecCapability.RTCPFeedback {
-			media.WithValueAttribute("rtcp-fb", fmt.Sprintf("%d %s %s", codec.PayloadType, feedback.Type, feedback.Parameter))
+			rtcpFeedback := fmt.Sprintf("%d %s", codec.PayloadType, feedback.Type)
+			if feedback.Parameter != "" {
+				rtcpFeedback += " " + feedback.Parameter
+			}
+			media.WithValueAttribute("rtcp-fb", rtcpFeedback)
 			if feedback.Type == TypeRTCPFBTransportCC {
 				media.WithTransportCCExtMap()
 			}
@@ -242,7 +373,7 @@ func addTransceiverSDP(d *sdp.SessionDescription, isPlanB bool, mediaEngine *Med
 	for _, mt := range transceivers {
 		if mt.Sender() != nil && mt.Sender().track != nil {
 			track := mt.Sender().track
-			media = media.WithMediaSource(track.SSRC(), track.Label() /* cname */, track.Label() /* streamLabel */, track.ID())
+			media = media.WithMediaSource(track.SSRC(), mt.Sender().cname(), track.Label() /* streamLabel */, track.ID())
 			if !isPlanB {
 				media = media.WithPropertyAttribute("msid:" + track.Label() + " " + track.ID())
 				break
@@ -250,6 +381,23 @@ func addTransceiverSDP(d *sdp.SessionDescription, isPlanB bool, mediaEngine *Med
 		}
 	}
 
+	for _, headerExtension := range headerExtensions {
+		uri, err := url.Parse(headerExtension.URI)
+		if err != nil {
+			return false, err
+		}
+		media = media.WithExtMap(sdp.ExtMap{Value: headerExtension.ID, URI: uri})
+	}
+
+	if rids := t.getSimulcastReceive(); len(rids) != 0 {
+		ids := []string{}
+		for _, rid := range rids {
+			media = media.WithValueAttribute("rid", ridValue(rid, "recv"))
+			ids = append(ids, rid.ID)
+		}
+		media = media.WithValueAttribute("simulcast", "recv "+strings.Join(ids, ";"))
+	}
+
 	media = media.WithPropertyAttribute(t.Direction().String())
 
 	addCandidatesToMediaDescriptions(candidates, media, iceGatheringState)
@@ -262,10 +410,20 @@ type mediaSection struct {
 	id           string
 	transceivers []*RTPTransceiver
 	data         bool
+
+	// rejected is set for a data section that is answered with port 0
+	rejected bool
+
+	// remoteMedia is set when the PayloadTypes of the remote media section
+	// should be used for this media section
+	remoteMedia *sdp.MediaDescription
+
+	// headerExtensions are the RTP header extensions offered or accepted in this media section
+	headerExtensions []RTPHeaderExtensionParameters
 }
 
 // populateSDP serializes a PeerConnections state into an SDP
-func populateSDP(d *sdp.SessionDescription, isPlanB bool, isICELite bool, mediaEngine *MediaEngine, connectionRole sdp.ConnectionRole, candidates []ICECandidate, iceParams ICEParameters, mediaSections []mediaSection, iceGatheringState ICEGatheringState) (*sdp.SessionDescription, error) {
+func populateSDP(d *sdp.SessionDescription, isPlanB bool, isICELite bool, iceOptions []string, mediaEngine *MediaEngine, connectionRole sdp.ConnectionRole, candidates []ICECandidate, iceParams ICEParameters, mediaSections []mediaSection, iceGatheringState ICEGatheringState) (*sdp.SessionDescription, error) {
 	var err error
 
 	bundleValue := "BUNDLE"
@@ -283,9 +441,12 @@ func populateSDP(d *sdp.SessionDescription, isPlanB bool, isICELite bool, mediaE
 		}
 
 		shouldAddID := true
-		if m.data {
+		if m.data && m.rejected {
+			addRejectedDataMediaSection(d)
+			shouldAddID = false
+		} else if m.data {
 			addDataMediaSection(d, m.id, iceParams, candidates, connectionRole, iceGatheringState)
-		} else if shouldAddID, err = addTransceiverSDP(d, isPlanB, mediaEngine, m.id, iceParams, candidates, connectionRole, iceGatheringState, m.transceivers...); err != nil {
+		} else if shouldAddID, err = addTransceiverSDP(d, isPlanB, mediaEngine, m.id, iceParams, candidates, connectionRole, iceGatheringState, m.remoteMedia, m.headerExtensions, m.transceivers...); err != nil {
 			return nil, err
 		}
 
@@ -298,6 +459,10 @@ func populateSDP(d *sdp.SessionDescription, isPlanB bool, isICELite bool, mediaE
 		// RFC 5245 S15.3
 		d = d.WithValueAttribute(sdp.AttrKeyICELite, sdp.AttrKeyICELite)
 	}
+	if len(iceOptions) != 0 {
+		// RFC 8839 S5.6
+		d = d.WithValueAttribute(sdpAttributeICEOptions, strings.Join(iceOptions, " "))
+	}
 	return d.WithValueAttribute(sdp.AttrKeyGroup, bundleValue), nil
 }
 
@@ -310,6 +475,62 @@ func getMidValue(media *sdp.MediaDescription) string {
 	return ""
 }
 
+// fillMissingMids adds a mid to the media sections of a remote description
+// from a legacy client that doesn't send a=mid, so they can be matched like any
+// other. The media sections of an answer get the mid of the media section at
+// the same position of the local offer. The media sections of an offer get the
+// identifiers of the BUNDLE group that no media section uses if there are as
+// many as media sections without mid, and their position otherwise.
+func fillMissingMids(parsed *sdp.SessionDescription, localOffer *sdp.SessionDescription) {
+	used := map[string]bool{}
+	missing := 0
+	for _, media := range parsed.MediaDescriptions {
+		if midValue := getMidValue(media); midValue != "" {
+			used[midValue] = true
+		} else {
+			missing++
+		}
+	}
+	if missing == 0 {
+		return
+	}
+
+	bundled := []string{}
+	if group, ok := parsed.Attribute(sdp.AttrKeyGroup); ok && strings.HasPrefix(group, "BUNDLE ") {
+		for _, midValue := range strings.Fields(group)[1:] {
+			if !used[midValue] {
+				bundled = append(bundled, midValue)
+			}
+		}
+	}
+
+	useBundle := len(bundled) == missing
+	for i, media := range parsed.MediaDescriptions {
+		if getMidValue(media) != "" {
+			continue
+		}
+
+		midValue := ""
+		switch {
+		case localOffer != nil:
+			if i < len(localOffer.MediaDescriptions) {
+				midValue = getMidValue(localOffer.MediaDescriptions[i])
+			}
+		case useBundle:
+			midValue = bundled[0]
+			bundled = bundled[1:]
+		default:
+			for n := i; midValue == "" || used[midValue]; n++ {
+				midValue = strconv.Itoa(n)
+			}
+		}
+		if midValue != "" {
+			used[midValue] = true
+			media.Attributes = append(media.Attributes, sdp.NewAttribute("mid", midValue))
+		}
+	}
+}
+
 func descriptionIsPlanB(desc *SessionDescription) bool {
 	if desc == nil || desc.parsed == nil {
 		return false
@@ -363,6 +584,21 @@ func extractFingerprint(desc *sdp.SessionDescription) (string, string, error) {
 	return parts[1], parts[0], nil
 }
 
+// extractICEOptions returns the ICE options of the description, media
+// level options are only used if there are none at session level
+func extractICEOptions(desc *sdp.SessionDescription) []string {
+	if value, ok := desc.Attribute(sdpAttributeICEOptions); ok {
+		return strings.Fields(value)
+	}
+
+	for _, m := range desc.MediaDescriptions {
+		if value, ok := m.Attribute(sdpAttributeICEOptions); ok {
+			return strings.Fields(value)
+		}
+	}
+	return nil
+}
+
 func extractICEDetails(desc *sdp.SessionDescription) (string, string, []ICECandidate, error) {
 	candidates := []ICECandidate{}
 	remotePwd := ""
@@ -399,3 +635,216 @@ func extractICEDetails(desc *sdp.SessionDescription) (string, string, []ICECandi
 
 	return remoteUfrag, remotePwd, candidates, nil
 }
+
+// frameMarkingIDFromSDP returns the ID of the frame marking header extension
+// in a media section, zero if it isn't included
+func frameMarkingIDFromSDP(media *sdp.MediaDescription) uint8 {
+	return headerExtensionIDFromSDP(media, FrameMarkingURI)
+}
+
+// ridsFromSDP parses the a=rid lines of a media section, lines that can't be
+// parsed are skipped
+func ridsFromSDP(log logging.LeveledLogger, media *sdp.MediaDescription) []RIDParameters {
+	var rids []RIDParameters
+	for _, attr := range media.Attributes {
+		if attr.Key != "rid" {
+			continue
+		}
+
+		rid, err := parseRID(attr.Value)
+		if err != nil {
+			log.Warnf("Failed to parse a=rid:%s: %v", attr.Value, err)
+			continue
+		}
+		rids = append(rids, rid)
+	}
+	return rids
+}
+
+// parseRID parses the value of an a=rid line like
+// `f send pt=96;max-width=1280;max-height=720;max-fps=30`
+// https://tools.ietf.org/html/rfc8851#section-10
+func parseRID(value string) (RIDParameters, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 || len(fields) > 3 {
+		return RIDParameters{}, fmt.Errorf("a=rid must have an id, a direction and optional restrictions")
+	} else if fields[1] != "send" && fields[1] != "recv" {
+		return RIDParameters{}, fmt.Errorf("invalid a=rid direction %s", fields[1])
+	}
+
+	rid := RIDParameters{ID: fields[0], Direction: fields[1], Restrictions: map[string]string{}}
+	if len(fields) == 2 {
+		return rid, nil
+	}
+
+	for _, restriction := range strings.Split(fields[2], ";") {
+		split := strings.SplitN(restriction, "=", 2)
+		if len(split) != 2 {
+			return RIDParameters{}, fmt.Errorf("invalid a=rid restriction %s", restriction)
+		}
+		name, value := split[0], split[1]
+		rid.Restrictions[name] = value
+
+		var err error
+		switch name {
+		case "pt":
+			for _, payloadType := range strings.Split(value, ",") {
+				var pt uint64
+				if pt, err = strconv.ParseUint(payloadType, 10, 7); err != nil {
+					break
+				}
+				rid.PayloadTypes = append(rid.PayloadTypes, uint8(pt))
+			}
+		case "max-width":
+			rid.MaxWidth, err = parseRIDUint32(value)
+		case "max-height":
+			rid.MaxHeight, err = parseRIDUint32(value)
+		case "max-fs":
+			rid.MaxFrameSize, err = parseRIDUint32(value)
+		case "max-br":
+			rid.MaxBitrate, err = parseRIDUint32(value)
+		case "max-fps":
+			rid.MaxFPS, err = strconv.ParseFloat(value, 64)
+		case "depend":
+			rid.Depend = strings.Split(value, ",")
+		}
+		if err != nil {
+			return RIDParameters{}, fmt.Errorf("invalid a=rid restriction %s: %v", restriction, err)
+		}
+	}
+	return rid, nil
+}
+
+// ridValue formats the value of an a=rid line with the given direction. The
+// restrictions that have a field come first, the others follow sorted by name.
+func ridValue(rid RIDParameters, direction string) string {
+	restrictions := []string{}
+	add := func(name, value string) {
+		restrictions = append(restrictions, name+"="+value)
+	}
+
+	if len(rid.PayloadTypes) != 0 {
+		payloadTypes := []string{}
+		for _, payloadType := range rid.PayloadTypes {
+			payloadTypes = append(payloadTypes, strconv.Itoa(int(payloadType)))
+		}
+		add("pt", strings.Join(payloadTypes, ","))
+	}
+	if rid.MaxWidth != 0 {
+		add("max-width", strconv.FormatUint(uint64(rid.MaxWidth), 10))
+	}
+	if rid.MaxHeight != 0 {
+		add("max-height", strconv.FormatUint(uint64(rid.MaxHeight), 10))
+	}
+	if rid.MaxFPS != 0 {
+		add("max-fps", strconv.FormatFloat(rid.MaxFPS, 'f', -1, 64))
+	}
+	if rid.MaxFrameSize != 0 {
+		add("max-fs", strconv.FormatUint(uint64(rid.MaxFrameSize), 10))
+	}
+	if rid.MaxBitrate != 0 {
+		add("max-br", strconv.FormatUint(uint64(rid.MaxBitrate), 10))
+	}
+	if len(rid.Depend) != 0 {
+		add("depend", strings.Join(rid.Depend, ","))
+	}
+
+	names := []string{}
+	for name := range rid.Restrictions {
+		switch name {
+		case "pt", "max-width", "max-height", "max-fps", "max-fs", "max-br", "depend":
+		default:
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(name, rid.Restrictions[name])
+	}
+
+	if len(restrictions) == 0 {
+		return rid.ID + " " + direction
+	}
+	return rid.ID + " " + direction + " " + strings.Join(restrictions, ";")
+}
+
+func parseRIDUint32(value string) (uint32, error) {
+	parsed, err := strconv.ParseUint(value, 10, 32)
+	return uint32(parsed), err
+}
+
+// headerExtensionIDFromSDP returns the ID of the one-byte header extension with
+// the given URI in a media section, zero if it isn't included
+func headerExtensionIDFromSDP(media *sdp.MediaDescription, uri string) uint8 {
+	for _, headerExtension := range headerExtensionsFromSDP(media) {
+		if headerExtension.URI == uri && headerExtension.ID < 15 {
+			return uint8(headerExtension.ID)
+		}
+	}
+	return 0
+}
+
+// headerExtensionsFromSDP returns the RTP header extensions of the extmap
+// attributes of a media section, invalid ones are skipped
+func headerExtensionsFromSDP(media *sdp.MediaDescription) []RTPHeaderExtensionParameters {
+	headerExtensions := []RTPHeaderExtensionParameters{}
+	for _, attr := range media.Attributes {
+		if attr.Key != "extmap" {
+			continue
+		}
+
+		extMap := sdp.ExtMap{}
+		if err := extMap.Unmarshal(attr.Key + ":" + attr.Value); err != nil || extMap.URI == nil {
+			continue
+		}
+		headerExtensions = append(headerExtensions, RTPHeaderExtensionParameters{URI: extMap.URI.String(), ID: extMap.Value})
+	}
+	return headerExtensions
+}
+
+// maxMessageSizeFromSDP returns the largest DataChannel message the remote
+// accepts, 0 meaning any size. Without a max-message-size attribute this is 64K.
+// https://tools.ietf.org/html/rfc8841#section-6
+func maxMessageSizeFromSDP(desc *sdp.SessionDescription) uint32 {
+	for _, media := range desc.MediaDescriptions {
+		if media.MediaName.Media != "application" {
+			continue
+		}
+
+		if value, ok := media.Attribute("max-message-size"); ok {
+			if size, err := strconv.ParseUint(value, 10, 32); err == nil {
+				return uint32(size)
+			}
+		}
+	}
+	return defaultMaxMessageSize
+}
+
+// dataChannelsRejected returns true if the application media section of the
+// description has been rejected with port 0
+func dataChannelsRejected(desc *sdp.SessionDescription) bool {
+	for _, media := range desc.MediaDescriptions {
+		if media.MediaName.Media == "application" && media.MediaName.Port.Value == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// rtcpReducedSizeFromSDP returns false if the remote has media sections, but
+// doesn't accept reduced-size RTCP on any of them
+// https://tools.ietf.org/html/rfc5506#section-5
+func rtcpReducedSizeFromSDP(desc *sdp.SessionDescription) bool {
+	haveMedia := false
+	for _, media := range desc.MediaDescriptions {
+		if media.MediaName.Media == "application" {
+			continue
+		}
+		haveMedia = true
+
+		if _, ok := media.Attribute(sdp.AttrKeyRTCPRsize); ok {
+			return true
+		}
+	}
+	return !haveMedia
+}
@@ -5,6 +5,7 @@ package webrtc
 import (
 	"testing"
 
+	"github.com/pion/logging"
 	"github.com/pion/sdp/v2"
 	"github.com/stretchr/testify/assert"
 )
@@ -87,6 +88,31 @@ func TestExtractICEDetails(t *testing.T) {
 	})
 }
 
+func TestExtractICEOptions(t *testing.T) {
+	t.Run("None", func(t *testing.T) {
+		assert.Nil(t, extractICEOptions(&sdp.SessionDescription{}))
+	})
+
+	t.Run("Session level", func(t *testing.T) {
+		s := &sdp.SessionDescription{
+			Attributes: []sdp.Attribute{{Key: "ice-options", Value: "trickle renomination"}},
+			MediaDescriptions: []*sdp.MediaDescription{
+				{Attributes: []sdp.Attribute{{Key: "ice-options", Value: "ice2"}}},
+			},
+		}
+		assert.Equal(t, []string{"trickle", "renomination"}, extractICEOptions(s))
+	})
+
+	t.Run("Media level", func(t *testing.T) {
+		s := &sdp.SessionDescription{
+			MediaDescriptions: []*sdp.MediaDescription{
+				{Attributes: []sdp.Attribute{{Key: "ice-options", Value: "trickle"}}},
+			},
+		}
+		assert.Equal(t, []string{"trickle"}, extractICEOptions(s))
+	})
+}
+
 func TestTrackDetailsFromSDP(t *testing.T) {
 	t.Run("Tracks unknown, audio and video with RTX", func(t *testing.T) {
 		s := &sdp.SessionDescription{
@@ -151,6 +177,7 @@ func TestTrackDetailsFromSDP(t *testing.T) {
 			assert.Equal(t, RTPCodecTypeVideo, track.kind)
 			assert.Equal(t, uint32(3000), track.ssrc)
 			assert.Equal(t, "video_trk_label", track.label)
+			assert.Equal(t, uint32(4000), track.rtxSSRC)
 		}
 		if _, ok := tracks[4000]; ok {
 			assert.Fail(t, "got the rtx track ssrc:3000 which should have been skipped")
@@ -162,9 +189,68 @@ func TestTrackDetailsFromSDP(t *testing.T) {
 			assert.Equal(t, uint32(5000), track.ssrc)
 			assert.Equal(t, "video_trk_id", track.id)
 			assert.Equal(t, "video_stream_id", track.label)
+			assert.Zero(t, track.rtxSSRC)
 		}
 	})
 
+	t.Run("RTX grouped like a browser", func(t *testing.T) {
+		s := &sdp.SessionDescription{}
+		assert.NoError(t, s.Unmarshal([]byte(`v=0
+o=- 4596489990601351948 2 IN IP4 127.0.0.1
+s=-
+t=0 0
+m=video 9 UDP/TLS/RTP/SAVPF 96 97
+c=IN IP4 0.0.0.0
+a=mid:0
+a=sendonly
+a=msid:stream track
+a=rtpmap:96 VP8/90000
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=96
+a=ssrc-group:FID 2231627014 632943048
+a=ssrc:2231627014 cname:4TOk42mSjXCkVIa6
+a=ssrc:2231627014 msid:stream track
+a=ssrc:632943048 cname:4TOk42mSjXCkVIa6
+a=ssrc:632943048 msid:stream track
+`)))
+
+		tracks := trackDetailsFromSDP(nil, s)
+		assert.Equal(t, 1, len(tracks))
+		assert.Equal(t, uint32(632943048), tracks[2231627014].rtxSSRC)
+	})
+
+	t.Run("Simulcast layers grouped like a browser", func(t *testing.T) {
+		s := &sdp.SessionDescription{}
+		assert.NoError(t, s.Unmarshal([]byte(`v=0
+o=- 4596489990601351948 2 IN IP4 127.0.0.1
+s=-
+t=0 0
+m=video 9 UDP/TLS/RTP/SAVPF 96 97
+c=IN IP4 0.0.0.0
+a=mid:0
+a=sendonly
+a=msid:stream track
+a=rtpmap:96 VP8/90000
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=96
+a=ssrc-group:SIM 1000 2000
+a=ssrc-group:FID 1000 1001
+a=ssrc-group:FID 2000 2001
+a=ssrc:1000 msid:stream track
+a=ssrc:1001 msid:stream track
+a=ssrc:2000 msid:stream track
+a=ssrc:2001 msid:stream track
+a=ssrc:3000 msid:stream other
+`)))
+
+		tracks := trackDetailsFromSDP(nil, s)
+		assert.Equal(t, 3, len(tracks))
+		assert.True(t, tracks[1000].simulcast)
+		assert.True(t, tracks[2000].simulcast)
+		assert.Equal(t, uint32(2001), tracks[2000].rtxSSRC)
+		assert.False(t, tracks[3000].simulcast)
+	})
+
 	t.Run("inactive and recvonly tracks ignored", func(t *testing.T) {
 		s := &sdp.SessionDescription{
 			MediaDescriptions: []*sdp.MediaDescription{
@@ -192,3 +278,165 @@ func TestTrackDetailsFromSDP(t *testing.T) {
 		assert.Equal(t, 0, len(trackDetailsFromSDP(nil, s)))
 	})
 }
+
+func TestRTCPReducedSizeFromSDP(t *testing.T) {
+	media := func(kind string, attributes ...sdp.Attribute) *sdp.MediaDescription {
+		return &sdp.MediaDescription{MediaName: sdp.MediaName{Media: kind}, Attributes: attributes}
+	}
+	rsize := sdp.Attribute{Key: sdp.AttrKeyRTCPRsize}
+
+	testCases := []struct {
+		media       []*sdp.MediaDescription
+		reducedSize bool
+	}{
+		{nil, true},
+		{[]*sdp.MediaDescription{media("application")}, true},
+		{[]*sdp.MediaDescription{media("video", rsize)}, true},
+		{[]*sdp.MediaDescription{media("audio"), media("video", rsize)}, true},
+		{[]*sdp.MediaDescription{media("audio"), media("application", rsize)}, false},
+	}
+
+	for i, testCase := range testCases {
+		s := &sdp.SessionDescription{MediaDescriptions: testCase.media}
+		assert.Equal(t, testCase.reducedSize, rtcpReducedSizeFromSDP(s), "testCase: %d", i)
+	}
+}
+
+func TestMaxMessageSizeFromSDP(t *testing.T) {
+	media := func(kind string, attributes ...sdp.Attribute) *sdp.MediaDescription {
+		return &sdp.MediaDescription{MediaName: sdp.MediaName{Media: kind}, Attributes: attributes}
+	}
+	maxMessageSize := func(value string) sdp.Attribute {
+		return sdp.Attribute{Key: "max-message-size", Value: value}
+	}
+
+	testCases := []struct {
+		media          []*sdp.MediaDescription
+		maxMessageSize uint32
+	}{
+		{nil, 65536},
+		{[]*sdp.MediaDescription{media("application")}, 65536},
+		{[]*sdp.MediaDescription{media("application", maxMessageSize("1024"))}, 1024},
+		{[]*sdp.MediaDescription{media("application", maxMessageSize("0"))}, 0},
+		{[]*sdp.MediaDescription{media("application", maxMessageSize("invalid"))}, 65536},
+		{[]*sdp.MediaDescription{media("video", maxMessageSize("1024")), media("application")}, 65536},
+	}
+
+	for i, testCase := range testCases {
+		s := &sdp.SessionDescription{MediaDescriptions: testCase.media}
+		assert.Equal(t, testCase.maxMessageSize, maxMessageSizeFromSDP(s), "testCase: %d", i)
+	}
+}
+
+func TestParseRID(t *testing.T) {
+	rid, err := parseRID("h send pt=96,97;max-width=1280;max-height=720;max-fps=29.97;max-br=2500000;depend=m,l;max-bpp=1.5")
+	assert.NoError(t, err)
+	assert.Equal(t, RIDParameters{
+		ID:           "h",
+		Direction:    "send",
+		PayloadTypes: []uint8{96, 97},
+		MaxWidth:     1280,
+		MaxHeight:    720,
+		MaxFPS:       29.97,
+		MaxBitrate:   2500000,
+		Depend:       []string{"m", "l"},
+		Restrictions: map[string]string{
+			"pt":         "96,97",
+			"max-width":  "1280",
+			"max-height": "720",
+			"max-fps":    "29.97",
+			"max-br":     "2500000",
+			"depend":     "m,l",
+			"max-bpp":    "1.5",
+		},
+	}, rid)
+
+	rid, err = parseRID("l recv")
+	assert.NoError(t, err)
+	assert.Equal(t, RIDParameters{ID: "l", Direction: "recv", Restrictions: map[string]string{}}, rid)
+
+	for _, invalid := range []string{"l", "l both", "l send max-width", "l send max-width=wide", "l send pt=200", "l send pt=96 extra"} {
+		_, err := parseRID(invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	media := &sdp.MediaDescription{Attributes: []sdp.Attribute{
+		{Key: "rid", Value: "h send max-width=1280"},
+		{Key: "rid", Value: "invalid"},
+		{Key: "rid", Value: "l send max-width=320"},
+	}}
+	rids := ridsFromSDP(logging.NewDefaultLoggerFactory().NewLogger("test"), media)
+	assert.Equal(t, 2, len(rids))
+	assert.Equal(t, uint32(320), rids[1].MaxWidth)
+}
+
+func TestFillMissingMids(t *testing.T) {
+	mids := func(parsed *sdp.SessionDescription) (mids []string) {
+		for _, media := range parsed.MediaDescriptions {
+			mids = append(mids, getMidValue(media))
+		}
+		return
+	}
+	description := func(group string, mids ...string) *sdp.SessionDescription {
+		parsed := &sdp.SessionDescription{}
+		if group != "" {
+			parsed.Attributes = []sdp.Attribute{{Key: sdp.AttrKeyGroup, Value: group}}
+		}
+		for _, midValue := range mids {
+			media := &sdp.MediaDescription{}
+			if midValue != "" {
+				media.Attributes = []sdp.Attribute{{Key: "mid", Value: midValue}}
+			}
+			parsed.MediaDescriptions = append(parsed.MediaDescriptions, media)
+		}
+		return parsed
+	}
+
+	t.Run("Position", func(t *testing.T) {
+		parsed := description("", "", "0", "")
+		fillMissingMids(parsed, nil)
+		assert.Equal(t, []string{"1", "0", "2"}, mids(parsed))
+	})
+	t.Run("BUNDLE", func(t *testing.T) {
+		parsed := description("BUNDLE audio video data", "", "", "data")
+		fillMissingMids(parsed, nil)
+		assert.Equal(t, []string{"audio", "video", "data"}, mids(parsed))
+	})
+	t.Run("BUNDLE Mismatch", func(t *testing.T) {
+		parsed := description("BUNDLE audio", "", "")
+		fillMissingMids(parsed, nil)
+		assert.Equal(t, []string{"0", "1"}, mids(parsed))
+	})
+	t.Run("Answer", func(t *testing.T) {
+		parsed := description("", "", "", "")
+		fillMissingMids(parsed, description("BUNDLE a b", "a", "b"))
+		assert.Equal(t, []string{"a", "b", ""}, mids(parsed))
+	})
+}
+
+func TestSSRCCollisionsFromSDP(t *testing.T) {
+	media := func(ssrcs ...string) *sdp.MediaDescription {
+		m := &sdp.MediaDescription{MediaName: sdp.MediaName{Media: "video"}}
+		for _, ssrc := range ssrcs {
+			m.Attributes = append(m.Attributes, sdp.Attribute{Key: "ssrc", Value: ssrc})
+		}
+		return m
+	}
+
+	testCases := []struct {
+		media      []*sdp.MediaDescription
+		collisions []uint32
+	}{
+		// The lines of one track
+		{[]*sdp.MediaDescription{media("1 cname:a", "1 msid:a b", "2 cname:a")}, []uint32{}},
+		// The same SSRC in two media sections
+		{[]*sdp.MediaDescription{media("1 cname:a"), media("2 cname:a", "1 cname:a")}, []uint32{1}},
+		// Plan B with two tracks using the same SSRC
+		{[]*sdp.MediaDescription{media("1 msid:a b", "1 msid:a c", "1 msid:a d")}, []uint32{1}},
+	}
+
+	for i, testCase := range testCases {
+		s := &sdp.SessionDescription{MediaDescriptions: testCase.media}
+		assert.Equal(t, testCase.collisions, ssrcCollisionsFromSDP(s), "testCase: %d", i)
+	}
+}
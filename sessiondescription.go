@@ -12,3 +12,128 @@ type SessionDescription struct {
 	// This will never be initialized by callers, internal use only
 	parsed *sdp.SessionDescription
 }
+
+// Unmarshal returns the parsed form of the SDP. The SDP is only parsed if it
+// wasn't before, descriptions returned by the PeerConnection are parsed
+// already. Every call returns a copy, which the caller may modify.
+func (sd *SessionDescription) Unmarshal() (*sdp.SessionDescription, error) {
+	if sd.parsed == nil {
+		parsed := &sdp.SessionDescription{}
+		if err := parsed.Unmarshal([]byte(sd.SDP)); err != nil {
+			return nil, err
+		}
+		sd.parsed = parsed
+	}
+	return copySessionDescription(sd.parsed), nil
+}
+
+// newSessionDescription marshals a SDP the PeerConnection created. It is parsed
+// again as the SDP that was built may differ from the parse of the string form,
+// e.g. in how attributes are split into key and value.
+func newSessionDescription(sdpType SDPType, d *sdp.SessionDescription) (SessionDescription, error) {
+	sdpBytes, err := d.Marshal()
+	if err != nil {
+		return SessionDescription{}, err
+	}
+
+	parsed := &sdp.SessionDescription{}
+	if err := parsed.Unmarshal(sdpBytes); err != nil {
+		return SessionDescription{}, err
+	}
+	return SessionDescription{Type: sdpType, SDP: string(sdpBytes), parsed: parsed}, nil
+}
+
+// parsedCopy returns a copy of the parsed form of a SessionDescription, or nil
+// if there is none
+func (sd *SessionDescription) parsedCopy() *sdp.SessionDescription {
+	if sd == nil || sd.parsed == nil {
+		return nil
+	}
+	return copySessionDescription(sd.parsed)
+}
+
+// copySessionDescription returns a deep copy of a parsed SDP, so changes to
+// either don't affect the other
+func copySessionDescription(s *sdp.SessionDescription) *sdp.SessionDescription {
+	c := *s
+	if s.SessionInformation != nil {
+		information := *s.SessionInformation
+		c.SessionInformation = &information
+	}
+	if s.URI != nil {
+		// The url.Userinfo is immutable and can be shared
+		uri := *s.URI
+		c.URI = &uri
+	}
+	if s.EmailAddress != nil {
+		emailAddress := *s.EmailAddress
+		c.EmailAddress = &emailAddress
+	}
+	if s.PhoneNumber != nil {
+		phoneNumber := *s.PhoneNumber
+		c.PhoneNumber = &phoneNumber
+	}
+	c.ConnectionInformation = copyConnectionInformation(s.ConnectionInformation)
+	c.Bandwidth = append([]sdp.Bandwidth(nil), s.Bandwidth...)
+	c.TimeDescriptions = nil
+	for _, t := range s.TimeDescriptions {
+		repeatTimes := []sdp.RepeatTime(nil)
+		for _, r := range t.RepeatTimes {
+			r.Offsets = append([]int64(nil), r.Offsets...)
+			repeatTimes = append(repeatTimes, r)
+		}
+		t.RepeatTimes = repeatTimes
+		c.TimeDescriptions = append(c.TimeDescriptions, t)
+	}
+	c.TimeZones = append([]sdp.TimeZone(nil), s.TimeZones...)
+	c.EncryptionKey = copyEncryptionKey(s.EncryptionKey)
+	c.Attributes = append([]sdp.Attribute(nil), s.Attributes...)
+
+	c.MediaDescriptions = nil
+	for _, m := range s.MediaDescriptions {
+		media := *m
+		media.MediaName.Port.Range = copyInt(m.MediaName.Port.Range)
+		media.MediaName.Protos = append([]string(nil), m.MediaName.Protos...)
+		media.MediaName.Formats = append([]string(nil), m.MediaName.Formats...)
+		if m.MediaTitle != nil {
+			mediaTitle := *m.MediaTitle
+			media.MediaTitle = &mediaTitle
+		}
+		media.ConnectionInformation = copyConnectionInformation(m.ConnectionInformation)
+		media.Bandwidth = append([]sdp.Bandwidth(nil), m.Bandwidth...)
+		media.EncryptionKey = copyEncryptionKey(m.EncryptionKey)
+		media.Attributes = append([]sdp.Attribute(nil), m.Attributes...)
+		c.MediaDescriptions = append(c.MediaDescriptions, &media)
+	}
+	return &c
+}
+
+func copyConnectionInformation(c *sdp.ConnectionInformation) *sdp.ConnectionInformation {
+	if c == nil {
+		return nil
+	}
+	connectionInformation := *c
+	if c.Address != nil {
+		address := *c.Address
+		address.TTL = copyInt(c.Address.TTL)
+		address.Range = copyInt(c.Address.Range)
+		connectionInformation.Address = &address
+	}
+	return &connectionInformation
+}
+
+func copyEncryptionKey(k *sdp.EncryptionKey) *sdp.EncryptionKey {
+	if k == nil {
+		return nil
+	}
+	encryptionKey := *k
+	return &encryptionKey
+}
+
+func copyInt(i *int) *int {
+	if i == nil {
+		return nil
+	}
+	value := *i
+	return &value
+}
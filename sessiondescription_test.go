@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/pion/sdp/v2"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -57,3 +58,22 @@ func TestSessionDescription_JSON(t *testing.T) {
 		)
 	}
 }
+
+func TestSessionDescription_Unmarshal(t *testing.T) {
+	desc := SessionDescription{Type: SDPTypeOffer, SDP: "v=0\r\no=- 4596489990601351948 2 IN IP4 127.0.0.1\r\ns=-\r\nt=0 0\r\n"}
+	parsed, err := desc.Unmarshal()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4596489990601351948), parsed.Origin.SessionID)
+
+	// The SDP is parsed once, every call returns a copy of it
+	assert.NotNil(t, desc.parsed)
+	parsed.Origin.SessionID = 0
+	parsed.Attributes = append(parsed.Attributes, sdp.NewPropertyAttribute("test"))
+	again, err := desc.Unmarshal()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4596489990601351948), again.Origin.SessionID)
+	assert.Empty(t, again.Attributes)
+
+	_, err = (&SessionDescription{Type: SDPTypeOffer, SDP: "invalid"}).Unmarshal()
+	assert.Error(t, err)
+}
@@ -4,10 +4,13 @@ package webrtc
 
 import (
 	"errors"
+	"math"
+	"math/rand"
 	"time"
 
 	"github.com/pion/ice"
 	"github.com/pion/logging"
+	"github.com/pion/sdp/v2"
 	"github.com/pion/transport/vnet"
 )
 
@@ -42,16 +45,37 @@ type SettingEngine struct {
 		MulticastDNSHostName           string
 		UsernameFragment               string
 		Password                       string
+		DeferGathering                 bool
+		ICEOptions                     []string
 	}
 	replayProtection struct {
 		DTLS  *uint
 		SRTP  *uint
 		SRTCP *uint
 	}
+	sctp struct {
+		MaxChannels uint16
+	}
+	rtcpReports struct {
+		Interval           time.Duration
+		Disabled           bool
+		DisableRandomizing bool
+	}
 	answeringDTLSRole                         DTLSRole
+	iceRole                                   ICERole
 	disableCertificateFingerprintVerification bool
 	disableSRTPReplayProtection               bool
 	disableSRTCPReplayProtection              bool
+	answerRecvonly                            bool
+	mirrorRemotePayloadTypes                  bool
+	dropPaddingOnlyRTP                        bool
+	keyframeRequestOnReconnect                bool
+	cname                                     string
+	pacerBitrate                              uint64
+	remoteFingerprintPins                     []DTLSFingerprint
+	packetTracer                              func(PacketTrace)
+	sdpTransform                              func(*sdp.SessionDescription)
+	random                                    *rand.Rand
 	vnet                                      *vnet.Net
 	LoggerFactory                             logging.LoggerFactory
 }
@@ -70,6 +94,15 @@ func (e *SettingEngine) SetConnectionTimeout(connectionTimeout, keepAlive time.D
 	e.timeout.ICEKeepalive = &keepAlive
 }
 
+// SetICEKeepaliveInterval sets how long the selected candidate pair may be idle
+// before a STUN binding request is sent on it, so NAT bindings stay alive while
+// no media or data is sent. The ICE agent checks the pair every 2 seconds, which
+// limits how precisely shorter intervals are kept. An interval of 0 disables
+// the keepalives, the default is 10 seconds.
+func (e *SettingEngine) SetICEKeepaliveInterval(interval time.Duration) {
+	e.timeout.ICEKeepalive = &interval
+}
+
 // SetCandidateSelectionTimeout sets the max ICECandidateSelectionTimeout
 func (e *SettingEngine) SetCandidateSelectionTimeout(t time.Duration) {
 	e.timeout.ICECandidateSelectionTimeout = &t
@@ -108,11 +141,21 @@ func (e *SettingEngine) SetEphemeralUDPPortRange(portMin, portMax uint16) error
 	return nil
 }
 
-// SetLite configures whether or not the ice agent should be a lite agent
+// SetLite configures whether or not the ice agent should be a lite agent.
+// A lite agent only gathers host candidates, advertises a=ice-lite and
+// responds to connectivity checks without initiating them.
 func (e *SettingEngine) SetLite(lite bool) {
 	e.candidates.ICELite = lite
 }
 
+// SetICEOptions sets the ICE options announced with a=ice-options in the SDP
+// the PeerConnection generates, like "trickle" or "renomination". The options
+// are only announced, the ICE agent doesn't change its behavior because of them.
+// The options of the remote are returned by PeerConnection.RemoteICEOptions.
+func (e *SettingEngine) SetICEOptions(options ...string) {
+	e.candidates.ICEOptions = options
+}
+
 // SetTrickle configures whether or not the ice agent should gather candidates
 // via the trickle method or synchronously.
 func (e *SettingEngine) SetTrickle(trickle bool) {
@@ -120,7 +163,9 @@ func (e *SettingEngine) SetTrickle(trickle bool) {
 }
 
 // SetNetworkTypes configures what types of candidate networks are supported
-// during local and server reflexive gathering.
+// during local and server reflexive gathering. Only candidate pairs of these
+// types are formed, so e.g. []NetworkType{NetworkTypeUDP4} restricts ICE to
+// IPv4. ICECandidatePair.NetworkType tells which one the selected pair uses.
 func (e *SettingEngine) SetNetworkTypes(candidateTypes []NetworkType) {
 	e.candidates.ICENetworkTypes = candidateTypes
 }
@@ -178,6 +223,20 @@ func (e *SettingEngine) SetAnsweringDTLSRole(role DTLSRole) error {
 	return nil
 }
 
+// SetICERole forces the ICE role instead of selecting it from the descriptions,
+// where the offerer is controlling. This may be useful when debugging issues with
+// the nomination of candidate pairs. The role must still follow RFC 8445: a full
+// agent must be controlling and an ICE lite agent controlled when only one of
+// them is lite, SetRemoteDescription fails otherwise.
+func (e *SettingEngine) SetICERole(role ICERole) error {
+	if role != ICERoleControlling && role != ICERoleControlled {
+		return errors.New("SetICERole must be ICERoleControlling or ICERoleControlled")
+	}
+
+	e.iceRole = role
+	return nil
+}
+
 // SetVNet sets the VNet instance that is passed to pion/ice
 //
 // VNet is a virtual network layer for Pion, allowing users to simulate
@@ -219,23 +278,174 @@ func (e *SettingEngine) SetDTLSReplayProtectionWindow(n uint) {
 }
 
 // SetSRTPReplayProtectionWindow sets a replay attack protection window size of SRTP session.
+// Packets that arrive reordered by more than the window are dropped as
+// replays, so networks with a lot of jitter may need a larger window.
 func (e *SettingEngine) SetSRTPReplayProtectionWindow(n uint) {
 	e.disableSRTPReplayProtection = false
 	e.replayProtection.SRTP = &n
 }
 
 // SetSRTCPReplayProtectionWindow sets a replay attack protection window size of SRTCP session.
+// As with SRTP, RTCP reordered by more than the window is dropped.
 func (e *SettingEngine) SetSRTCPReplayProtectionWindow(n uint) {
 	e.disableSRTCPReplayProtection = false
 	e.replayProtection.SRTCP = &n
 }
 
-// DisableSRTPReplayProtection disables SRTP replay protection.
+// DisableSRTPReplayProtection disables SRTP replay protection, so packets are
+// delivered even if their sequence number has been received before. This can
+// help when the remote rewrites sequence numbers, e.g. an SFU switching sources,
+// but an attacker that captured packets can then replay them.
 func (e *SettingEngine) DisableSRTPReplayProtection(isDisabled bool) {
 	e.disableSRTPReplayProtection = isDisabled
 }
 
-// DisableSRTCPReplayProtection disables SRTCP replay protection.
+// DisableSRTCPReplayProtection disables SRTCP replay protection, with the same
+// tradeoff as DisableSRTPReplayProtection.
 func (e *SettingEngine) DisableSRTCPReplayProtection(isDisabled bool) {
 	e.disableSRTCPReplayProtection = isDisabled
 }
+
+// SetAnswerRecvonly makes the PeerConnection receive all media of a remote offer
+// by default. When set, SetRemoteDescription adds a recvonly transceiver for every
+// audio and video section of an offer that has no matching local transceiver, so
+// CreateAnswer accepts all offered media without any local tracks. This is only
+// supported for Unified Plan offers.
+func (e *SettingEngine) SetAnswerRecvonly(recvonly bool) {
+	e.answerRecvonly = recvonly
+}
+
+// SetMirrorRemotePayloadTypes makes the PeerConnection use the PayloadTypes the remote
+// assigned to codecs in its media sections, instead of the ones registered in the
+// MediaEngine. This way packets received from the remote can be forwarded without
+// rewriting their PayloadType. Codecs the remote doesn't offer are left out of
+// those media sections, and creating the description fails if a remote PayloadType
+// matches more than one local codec.
+func (e *SettingEngine) SetMirrorRemotePayloadTypes(mirror bool) {
+	e.mirrorRemotePayloadTypes = mirror
+}
+
+// DeferICEGathering delays gathering of ICE candidates until they are first needed.
+// Without trickle ICE a PeerConnection gathers candidates as soon as it is created,
+// which opens sockets for PeerConnections that may never be negotiated. When deferred,
+// no sockets are opened until a description is created or SetRemoteDescription is
+// called. With trickle ICE gathering always starts with SetLocalDescription.
+func (e *SettingEngine) DeferICEGathering(isDeferred bool) {
+	e.candidates.DeferGathering = isDeferred
+}
+
+// SetDropPaddingOnlyRTP drops received RTP packets that carry nothing but padding,
+// as browsers send them to probe bandwidth. The packets are dropped before a remote
+// Track is read. The sequence numbers of the other packets are kept as they are,
+// so reordering and NACKs keep working, and the Stats of the Track don't count the
+// dropped packets as lost.
+func (e *SettingEngine) SetDropPaddingOnlyRTP(drop bool) {
+	e.dropPaddingOnlyRTP = drop
+}
+
+// SetKeyframeRequestOnReconnect sends a Picture Loss Indication for every
+// remote video Track when the ICE connection state changes from disconnected
+// back to connected, so decoders get a keyframe after the media they missed.
+func (e *SettingEngine) SetKeyframeRequestOnReconnect(request bool) {
+	e.keyframeRequestOnReconnect = request
+}
+
+// SetRTCPReportInterval sets the average interval of the Sender Reports that
+// RTPSenders send while media is written to their Track. Every interval is
+// randomized to between 0.5 and 1.5 times the average, so the reports of many
+// senders don't synchronize. The default is 5 seconds, the minimum interval
+// RFC 3550 recommends.
+func (e *SettingEngine) SetRTCPReportInterval(interval time.Duration) {
+	e.rtcpReports.Interval = interval
+}
+
+// DisableRTCPReportRandomization sends the Sender Reports at exactly the
+// interval set with SetRTCPReportInterval.
+func (e *SettingEngine) DisableRTCPReportRandomization(isDisabled bool) {
+	e.rtcpReports.DisableRandomizing = isDisabled
+}
+
+// DisableRTCPReports stops RTPSenders from sending Sender Reports. They can
+// still be sent with PeerConnection.WriteRTCP and Track.SenderReport.
+func (e *SettingEngine) DisableRTCPReports(isDisabled bool) {
+	e.rtcpReports.Disabled = isDisabled
+}
+
+// rtcpReportDelay returns the time until the next Sender Report
+// https://tools.ietf.org/html/rfc3550#section-6.3.1
+func (e *SettingEngine) rtcpReportDelay() time.Duration {
+	interval := e.rtcpReports.Interval
+	if interval <= 0 {
+		interval = defaultRTCPReportInterval
+	}
+	if e.rtcpReports.DisableRandomizing {
+		return interval
+	}
+	// Scaled as float64, the product of the interval and a uint32 overflows uint64 above about 4.29s
+	return interval/2 + time.Duration(float64(interval)*float64(e.randUint32())/math.MaxUint32)
+}
+
+// SetCNAME sets the canonical name the local Tracks are announced with, in
+// the a=ssrc lines of descriptions and in the Source Descriptions sent with
+// Sender Reports. Remotes synchronize the Tracks that share a CNAME. By default
+// the Label of a Track is used, so the Tracks of a stream share it.
+func (e *SettingEngine) SetCNAME(cname string) {
+	e.cname = cname
+}
+
+// SetPacerBitrate enables a pacer for every RTPSender, which spreads the packets
+// written to a Track over time so they leave at most at the given bitrate in bits
+// per second instead of in bursts. Once the remote sends a Receiver Estimated
+// Maximum Bitrate the pacer also stays within the estimate, see
+// RTPSender.SetPacerBitrate. The bitrate applies to each RTPSender on its own.
+// Zero, the default, sends packets when they are written.
+func (e *SettingEngine) SetPacerBitrate(bitsPerSecond uint64) {
+	e.pacerBitrate = bitsPerSecond
+}
+
+// SetRemoteFingerprintPin pins the DTLS certificate of the remote. The DTLS
+// handshake fails unless the certificate the remote presents matches one of the
+// given fingerprints, in addition to the fingerprint in the remote description.
+// The pin is also enforced if DisableCertificateFingerprintVerification is set.
+func (e *SettingEngine) SetRemoteFingerprintPin(fingerprints ...DTLSFingerprint) {
+	e.remoteFingerprintPins = fingerprints
+}
+
+// SetSCTPMaxChannels limits the number of DataChannels that can be open
+// simultaneously, which is also the number of SCTP streams they use. DataChannel
+// IDs must be lower than the limit, and CreateDataChannel fails once it is
+// reached. The default and maximum is 65535.
+func (e *SettingEngine) SetSCTPMaxChannels(maxChannels uint16) {
+	e.sctp.MaxChannels = maxChannels
+}
+
+// SetRandomSource sets the source of the randomness a PeerConnection uses for
+// the SSRCs, IDs and labels of the Tracks it creates in AddTransceiverFromKind,
+// the first sequence numbers of Tracks created with PeerConnection.NewTrack,
+// and the ICE credentials, unless they are set with SetICECredentials. A seeded
+// source makes these reproducible, e.g. for testing or fuzzing. It doesn't need
+// to be safe for concurrent use. DTLS keeps using crypto/rand.
+//
+// Predictable ICE credentials allow others to send to the PeerConnection, so
+// this should not be used in production.
+func (e *SettingEngine) SetRandomSource(src rand.Source) {
+	e.random = rand.New(&lockedSource{src: src})
+}
+
+// SetPacketTracer sets a function that is called for every RTP and RTCP packet
+// a PeerConnection sends or receives, e.g. to log their SSRCs, sequence numbers
+// and timestamps. It is called on the goroutine that reads or writes the packet,
+// so it must not block, and must not keep or modify the packets.
+func (e *SettingEngine) SetPacketTracer(tracer func(PacketTrace)) {
+	e.packetTracer = tracer
+}
+
+// SetSDPTransform sets a function that may modify every offer and answer the
+// PeerConnection creates, after it is built and before it is serialized, so
+// applications don't need to parse and serialize the SDP again to munge it. The
+// modified description is the one the PeerConnection applies in
+// SetLocalDescription, changes the PeerConnection can't handle, like changing
+// mids or removing media sections, break negotiation.
+func (e *SettingEngine) SetSDPTransform(transform func(*sdp.SessionDescription)) {
+	e.sdpTransform = transform
+}
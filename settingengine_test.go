@@ -3,10 +3,19 @@
 package webrtc
 
 import (
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/pion/logging"
+	"github.com/pion/sdp/v2"
+	"github.com/pion/transport/test"
+	"github.com/pion/transport/vnet"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSetEphemeralUDPPortRange(t *testing.T) {
@@ -116,3 +125,152 @@ func TestSetReplayProtection(t *testing.T) {
 		t.Errorf("Failed to set SRTCP replay protection window")
 	}
 }
+
+func TestSetRandomSource(t *testing.T) {
+	type generated struct {
+		SSRC             uint32
+		ID, Label        string
+		SequenceNumber   uint16
+		UsernameFragment string
+		Password         string
+	}
+
+	generate := func(seed int64) generated {
+		s := SettingEngine{}
+		s.SetRandomSource(rand.NewSource(seed))
+		api := NewAPI(WithSettingEngine(s))
+		api.mediaEngine.RegisterDefaultCodecs()
+
+		pc, err := api.NewPeerConnection(Configuration{})
+		require.NoError(t, err)
+		transceiver, err := pc.AddTransceiverFromKind(RTPCodecTypeVideo)
+		require.NoError(t, err)
+		track := transceiver.Sender().Track()
+		params, err := pc.iceGatherer.GetLocalParameters()
+		require.NoError(t, err)
+
+		local, err := pc.NewTrack(DefaultPayloadTypeVP8, 1234, "video", "pion")
+		require.NoError(t, err)
+		packets := local.Packetizer().Packetize([]byte{0x00}, 1)
+		require.NotEmpty(t, packets)
+
+		assert.NoError(t, pc.Close())
+		return generated{
+			SSRC:             track.SSRC(),
+			ID:               track.ID(),
+			Label:            track.Label(),
+			SequenceNumber:   packets[0].SequenceNumber,
+			UsernameFragment: params.UsernameFragment,
+			Password:         params.Password,
+		}
+	}
+
+	first := generate(1)
+	assert.Equal(t, first, generate(1))
+
+	other := generate(2)
+	assert.NotEqual(t, first.SSRC, other.SSRC)
+	assert.NotEqual(t, first.UsernameFragment, other.UsernameFragment)
+	assert.NotEqual(t, first.Password, other.Password)
+}
+
+func TestSetSDPTransform(t *testing.T) {
+	s := SettingEngine{}
+	s.SetSDPTransform(func(d *sdp.SessionDescription) {
+		d.WithValueAttribute("x-transformed", "true")
+		for _, media := range d.MediaDescriptions {
+			media.WithPropertyAttribute("x-media-transformed")
+		}
+	})
+	api := NewAPI(WithSettingEngine(s))
+	api.mediaEngine.RegisterDefaultCodecs()
+
+	pcOffer, err := api.NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+	pcAnswer, err := api.NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+	_, err = pcOffer.AddTransceiverFromKind(RTPCodecTypeVideo)
+	require.NoError(t, err)
+
+	offer, err := pcOffer.CreateOffer(nil)
+	require.NoError(t, err)
+	require.NoError(t, pcOffer.SetLocalDescription(offer))
+	assert.Contains(t, pcOffer.LocalDescription().SDP, "a=x-transformed:true\r\n")
+	assert.Contains(t, pcOffer.LocalDescription().SDP, "a=x-media-transformed\r\n")
+
+	require.NoError(t, pcAnswer.SetRemoteDescription(offer))
+	answer, err := pcAnswer.CreateAnswer(nil)
+	require.NoError(t, err)
+	require.NoError(t, pcAnswer.SetLocalDescription(answer))
+	assert.Contains(t, pcAnswer.LocalDescription().SDP, "a=x-transformed:true\r\n")
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestSetICEKeepaliveInterval(t *testing.T) {
+	lim := test.TimeOut(time.Second * 30)
+	defer lim.Stop()
+
+	// bindingRequests returns how many STUN binding requests the offerer sends
+	// on an idle connection in idlePeriod
+	bindingRequests := func(s SettingEngine, idlePeriod time.Duration) int32 {
+		wan, err := vnet.NewRouter(&vnet.RouterConfig{CIDR: "1.2.3.0/24", LoggerFactory: logging.NewDefaultLoggerFactory()})
+		require.NoError(t, err)
+
+		var counting, requests int32
+		wan.AddChunkFilter(func(c vnet.Chunk) bool {
+			data := c.UserData()
+			if host, _, _ := net.SplitHostPort(c.SourceAddr().String()); host == "1.2.3.4" && atomic.LoadInt32(&counting) == 1 &&
+				len(data) >= 8 && binary.BigEndian.Uint16(data) == 0x0001 && binary.BigEndian.Uint32(data[4:]) == 0x2112A442 {
+				atomic.AddInt32(&requests, 1)
+			}
+			return true
+		})
+
+		offerVNet := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{"1.2.3.4"}})
+		require.NoError(t, wan.AddNet(offerVNet))
+		s.SetVNet(offerVNet)
+		pcOffer, err := NewAPI(WithSettingEngine(s)).NewPeerConnection(Configuration{})
+		require.NoError(t, err)
+
+		answerVNet := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{"1.2.3.5"}})
+		require.NoError(t, wan.AddNet(answerVNet))
+		answerSettingEngine := SettingEngine{}
+		answerSettingEngine.SetVNet(answerVNet)
+		pcAnswer, err := NewAPI(WithSettingEngine(answerSettingEngine)).NewPeerConnection(Configuration{})
+		require.NoError(t, err)
+		require.NoError(t, wan.Start())
+
+		connected := make(chan struct{})
+		pcOffer.OnICEConnectionStateChange(func(state ICEConnectionState) {
+			if state == ICEConnectionStateConnected {
+				close(connected)
+			}
+		})
+		require.NoError(t, signalPair(pcOffer, pcAnswer))
+		<-connected
+
+		// Give the DTLS and SCTP handshakes time to finish
+		time.Sleep(time.Second)
+		atomic.StoreInt32(&counting, 1)
+		time.Sleep(idlePeriod)
+		atomic.StoreInt32(&counting, 0)
+
+		assert.NoError(t, pcOffer.Close())
+		assert.NoError(t, pcAnswer.Close())
+		assert.NoError(t, wan.Stop())
+		return atomic.LoadInt32(&requests)
+	}
+
+	s := SettingEngine{}
+	s.SetICEKeepaliveInterval(time.Second)
+	assert.Equal(t, time.Second, *s.timeout.ICEKeepalive)
+
+	// The ICE agent checks every 2 seconds, so an idle pair is kept alive every
+	// 2 seconds with any shorter interval
+	assert.InDelta(t, 2, bindingRequests(s, 4*time.Second), 1)
+
+	// The default interval is longer than the idle period
+	assert.Equal(t, int32(0), bindingRequests(SettingEngine{}, 4*time.Second))
+}
@@ -1195,7 +1195,7 @@ func toStatsICECandidatePairState(state ice.CandidatePairState) (StatsICECandida
 		err := fmt.Errorf(
 			"cannot convert to StatsICECandidatePairStateSucceeded invalid ice candidate state: %s",
 			state.String())
-		return StatsICECandidatePairState(Unknown), err
+		return StatsICECandidatePairState(unknownStr), err
 	}
 }
 
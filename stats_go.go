@@ -61,3 +61,17 @@ func (r StatsReport) GetICECandidatePairStats(c *ICECandidatePair) (ICECandidate
 	}
 	return candidateStats, true
 }
+
+// GetOutboundRTPStreamStats is a helper method to return the associated stats for a given RTPSender
+func (r StatsReport) GetOutboundRTPStreamStats(s *RTPSender) (OutboundRTPStreamStats, bool) {
+	stats, ok := r[s.statsID]
+	if !ok {
+		return OutboundRTPStreamStats{}, false
+	}
+
+	outboundStats, ok := stats.(OutboundRTPStreamStats)
+	if !ok {
+		return OutboundRTPStreamStats{}, false
+	}
+	return outboundStats, true
+}
@@ -9,7 +9,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/pion/rtp"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestStatsTimestampTime(t *testing.T) {
@@ -307,3 +309,41 @@ func TestPeerConnection_GetStats_Closed(t *testing.T) {
 
 	pc.GetStats()
 }
+
+func TestPeerConnection_GetStats_ICETransport(t *testing.T) {
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+	drainTrack(t, remote)
+
+	offerBefore := getTransportStats(t, pcOffer.GetStats(), "iceTransport")
+	answerBefore := getTransportStats(t, pcAnswer.GetStats(), "iceTransport")
+
+	const packets, payloadSize = 50, 1000
+	sequenceNumber := local.Stats().LastSequenceNumber
+	for i := 0; i < packets; i++ {
+		sequenceNumber++
+		assert.NoError(t, local.WriteRTP(&rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    local.PayloadType(),
+				SSRC:           local.SSRC(),
+				SequenceNumber: sequenceNumber,
+			},
+			Payload: make([]byte, payloadSize),
+		}))
+	}
+	for remote.Stats().LastSequenceNumber != sequenceNumber {
+		_, err := remote.ReadRTP()
+		require.NoError(t, err)
+	}
+
+	// Besides the RTP, RTCP may have been sent in between
+	offerAfter := getTransportStats(t, pcOffer.GetStats(), "iceTransport")
+	answerAfter := getTransportStats(t, pcAnswer.GetStats(), "iceTransport")
+	assert.GreaterOrEqual(t, offerAfter.PacketsSent-offerBefore.PacketsSent, uint32(packets))
+	assert.GreaterOrEqual(t, offerAfter.BytesSent-offerBefore.BytesSent, uint64(packets*payloadSize))
+	assert.GreaterOrEqual(t, answerAfter.PacketsReceived-answerBefore.PacketsReceived, uint32(packets))
+	assert.GreaterOrEqual(t, answerAfter.BytesReceived-answerBefore.BytesReceived, uint64(packets*payloadSize))
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"time"
 
+	"github.com/pion/rtcp"
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v2/pkg/media"
 )
@@ -27,12 +29,56 @@ type Track struct {
 	label       string
 	ssrc        uint32
 	codec       *RTPCodec
+	clockRate   uint32
 
 	packetizer rtp.Packetizer
+	sequencer  rtp.Sequencer
+
+	// State of the last write, used to generate Sender Reports
+	packetsSent      uint32
+	octetsSent       uint32
+	lastRTPTimestamp uint32
+	lastRTPTime      time.Time
+
+	// Counters of the packets read or written, highestSequenceNumber is used
+	// to detect packets that are out of order. The packets lost are counted
+	// from baseSequenceNumber, the first sequence number, and the number of
+	// times the sequence numbers wrapped around. skippedPackets counts packets
+	// that were dropped before they were read, which aren't lost either.
+	stats                 TrackStats
+	highestSequenceNumber uint16
+	baseSequenceNumber    uint16
+	sequenceCycles        uint32
+	skippedPackets        uint64
+
+	onCodecChangeHandler       func(*RTPCodec)
+	onSenderCountChangeHandler func(int)
+
+	// frameMarkingID is the ID of the frame marking header extension of a remote Track
+	frameMarkingID uint8
+
+	// playoutDelay is the playout delay header extension element of a local
+	// Track, nil if SetPlayoutDelay hasn't been called
+	playoutDelay []byte
+
+	// rtxSSRC is the SSRC of the RTX repair flow of a remote Track
+	rtxSSRC uint32
+
+	// simulcast is set if a remote Track is a layer of a simulcast set
+	simulcast bool
+
+	// peeked is the first packet of a remote Track, which is read to determine
+	// the PayloadType and returned by the next Read
+	peeked []byte
 
 	receiver         *RTPReceiver
 	activeSenders    []*RTPSender
 	totalSenderCount int // count of all senders (accounts for senders that have not been started yet)
+
+	// writeDeadline is set when writes wait for an active RTPSender, they are
+	// woken up by closing sendersActivated
+	writeDeadline    time.Time
+	sendersActivated chan struct{}
 }
 
 // ID gets the ID of the track
@@ -70,6 +116,25 @@ func (t *Track) SSRC() uint32 {
 	return t.ssrc
 }
 
+// RTXSSRC gets the SSRC of the RTX repair flow (RFC 4588) the remote grouped
+// with this remote Track using a=ssrc-group:FID. It is zero if there is none.
+func (t *Track) RTXSSRC() uint32 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.rtxSSRC
+}
+
+// IsSimulcast returns true if a remote Track is one layer of a simulcast set,
+// which the remote signals by grouping the SSRCs of the layers with
+// a=ssrc-group:SIM or, for layers that are only identified by a=rid, with
+// a=simulcast. Every layer is its own Track, false is returned for local
+// Tracks and remote Tracks that are sent as a single stream.
+func (t *Track) IsSimulcast() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.simulcast
+}
+
 // Codec gets the Codec of the track
 func (t *Track) Codec() *RTPCodec {
 	t.mu.RLock()
@@ -77,6 +142,14 @@ func (t *Track) Codec() *RTPCodec {
 	return t.codec
 }
 
+// ClockRate gets the RTP clock rate of the track. This is the clock rate of
+// the Codec unless an explicit one was given with NewTrackWithClockRate
+func (t *Track) ClockRate() uint32 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.clockRate
+}
+
 // Packetizer gets the Packetizer of the track
 func (t *Track) Packetizer() rtp.Packetizer {
 	t.mu.RLock()
@@ -84,34 +157,260 @@ func (t *Track) Packetizer() rtp.Packetizer {
 	return t.packetizer
 }
 
+// TrackStats is a snapshot of the RTP a Track has read, if it is a remote
+// Track, or written, if it is a local Track
+type TrackStats struct {
+	// Packets is the number of RTP packets
+	Packets uint64
+
+	// PayloadBytes is the number of RTP payload bytes, without headers
+	PayloadBytes uint64
+
+	// LastSequenceNumber and LastTimestamp are those of the last packet
+	LastSequenceNumber uint16
+	LastTimestamp      uint32
+
+	// OutOfOrder is the number of packets whose sequence number wasn't higher
+	// than that of all the packets before, which includes duplicates
+	OutOfOrder uint64
+
+	// PacketsLost is the number of packets missing between the first and the
+	// highest sequence number, as RTCP reception reports count it. It is
+	// negative if more duplicates than missing packets were counted.
+	PacketsLost int64
+}
+
+// Stats returns a snapshot of the counters of the RTP read from or written to
+// the Track. This is cheaper than PeerConnection.GetStats, e.g. to check the
+// health of a stream while debugging.
+func (t *Track) Stats() TrackStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.stats
+}
+
+// updateStats counts a packet read or written, t.mu must be held
+func (t *Track) updateStats(header *rtp.Header, payloadBytes int) {
+	if !t.updateSequenceNumber(header.SequenceNumber) {
+		t.stats.OutOfOrder++
+	}
+
+	t.stats.Packets++
+	t.stats.PayloadBytes += uint64(payloadBytes)
+	t.stats.LastSequenceNumber = header.SequenceNumber
+	t.stats.LastTimestamp = header.Timestamp
+	t.updatePacketsLost()
+}
+
+// skipPacket accounts for the sequence number of a received packet that is
+// dropped before it is read, so it isn't counted as lost
+func (t *Track) skipPacket(header *rtp.Header) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.updateSequenceNumber(header.SequenceNumber)
+	t.skippedPackets++
+	t.updatePacketsLost()
+}
+
+// updateSequenceNumber tracks the highest sequence number, it returns false if
+// the sequence number isn't higher than all before. t.mu must be held.
+func (t *Track) updateSequenceNumber(sequenceNumber uint16) bool {
+	switch {
+	case t.stats.Packets == 0 && t.skippedPackets == 0:
+		t.baseSequenceNumber = sequenceNumber
+		t.highestSequenceNumber = sequenceNumber
+	case int16(sequenceNumber-t.highestSequenceNumber) > 0:
+		if sequenceNumber < t.highestSequenceNumber {
+			t.sequenceCycles++
+		}
+		t.highestSequenceNumber = sequenceNumber
+	default:
+		return false
+	}
+	return true
+}
+
+// updatePacketsLost counts the packets missing up to the highest sequence number, t.mu must be held
+func (t *Track) updatePacketsLost() {
+	expected := uint64(t.sequenceCycles)<<16 + uint64(t.highestSequenceNumber) - uint64(t.baseSequenceNumber) + 1
+	t.stats.PacketsLost = int64(expected) - int64(t.stats.Packets) - int64(t.skippedPackets)
+}
+
+// resetStats clears the counters, the next packet starts them again, t.mu must be held
+func (t *Track) resetStats() {
+	t.stats = TrackStats{}
+	t.sequenceCycles = 0
+	t.skippedPackets = 0
+}
+
 // Read reads data from the track. If this is a local track this will error
 func (t *Track) Read(b []byte) (n int, err error) {
-	t.mu.RLock()
+	t.mu.Lock()
 	if len(t.activeSenders) != 0 {
-		t.mu.RUnlock()
+		t.mu.Unlock()
 		return 0, fmt.Errorf("this is a local track and must not be read from")
 	}
 	r := t.receiver
-	t.mu.RUnlock()
+	peeked := t.peeked
+	// The peeked packet is only consumed once it fits into b
+	if peeked != nil && len(b) >= len(peeked) {
+		t.peeked = nil
+	}
+	t.mu.Unlock()
+
+	if peeked != nil {
+		if n = copy(b, peeked); n < len(peeked) {
+			return n, io.ErrShortBuffer
+		}
+	} else if n, err = r.readRTP(b); err != nil {
+		return n, err
+	}
+
+	t.checkPayloadType(r, b[:n])
 
-	return r.readRTP(b)
+	header := rtp.Header{}
+	if header.Unmarshal(b[:n]) == nil {
+		t.mu.Lock()
+		t.updateStats(&header, n-header.PayloadOffset)
+		t.mu.Unlock()
+	}
+	return n, nil
 }
 
-// ReadRTP is a convenience method that wraps Read and unmarshals for you
-func (t *Track) ReadRTP() (*rtp.Packet, error) {
-	b := make([]byte, receiveMTU)
-	i, err := t.Read(b)
+// OnCodecChange sets an event handler which is called when the remote switches
+// this Track to another negotiated codec, which is detected by a change of the
+// PayloadType of the packets read. Packets with a PayloadType that isn't in the
+// MediaEngine don't change the codec.
+func (t *Track) OnCodecChange(f func(*RTPCodec)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onCodecChangeHandler = f
+}
+
+// SetPlayoutDelay sets the minimum and maximum delay with which the remote
+// should render the frames of this local Track. The delays are sent with every
+// packet if the playout delay header extension has been negotiated, see
+// MediaEngine.RegisterPlayoutDelay. They are rounded down to 10ms and can be at
+// most 40.95s.
+func (t *Track) SetPlayoutDelay(min, max time.Duration) error {
+	const (
+		granularity = 10 * time.Millisecond
+		maxDelay    = 0xFFF * granularity
+	)
+	if min < 0 || max < min {
+		return fmt.Errorf("invalid playout delay, min %v and max %v", min, max)
+	} else if max > maxDelay {
+		return fmt.Errorf("playout delay %v is larger than %v", max, maxDelay)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.receiver != nil {
+		return fmt.Errorf("the playout delay can only be set on a local track")
+	}
+	t.playoutDelay = playoutDelayElement(uint16(min/granularity), uint16(max/granularity))
+	return nil
+}
+
+// SenderCount returns the number of RTPSenders the Track is sent with,
+// including those that haven't been started yet. RTPSenders are counted from
+// their creation (e.g. by AddTrack) until they are stopped (e.g. by RemoveTrack).
+func (t *Track) SenderCount() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.totalSenderCount
+}
+
+// OnSenderCountChange sets an event handler which is called with the new
+// SenderCount whenever an RTPSender for this Track is created or stopped.
+func (t *Track) OnSenderCountChange(f func(int)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onSenderCountChangeHandler = f
+}
+
+// senderCountChanged must be called with t.mu held
+func (t *Track) senderCountChanged() {
+	if hdlr := t.onSenderCountChangeHandler; hdlr != nil {
+		go hdlr(t.totalSenderCount)
+	}
+}
+
+// checkPayloadType updates the PayloadType and codec if a packet read from
+// the remote uses another one than the Track
+func (t *Track) checkPayloadType(r *RTPReceiver, b []byte) {
+	if len(b) < 2 {
+		return
+	}
+	payloadType := b[1] & 0x7f
+
+	// The codec is unset until the Track has been announced
+	t.mu.RLock()
+	changed := t.codec != nil && payloadType != t.payloadType
+	t.mu.RUnlock()
+	if !changed {
+		return
+	}
+
+	codec, err := r.getCodec(payloadType)
 	if err != nil {
-		return nil, err
+		return
+	}
+
+	t.mu.Lock()
+	t.payloadType = payloadType
+	t.codec = codec
+	hdlr := t.onCodecChangeHandler
+	t.mu.Unlock()
+
+	if hdlr != nil {
+		go hdlr(codec)
+	}
+}
+
+// SetReadDeadline sets the deadline for Read, ReadRTP and ReadRTPInto. Once it
+// passes blocked and future reads return a net.Error with Timeout() true, a zero
+// value for the deadline means reads don't time out. If this is a local track
+// this will error
+func (t *Track) SetReadDeadline(deadline time.Time) error {
+	t.mu.RLock()
+	r := t.receiver
+	t.mu.RUnlock()
+
+	if r == nil {
+		return fmt.Errorf("this is a local track and has no read deadline")
 	}
+	return r.setRTPReadDeadline(deadline)
+}
 
+// ReadRTP is a convenience method that wraps Read and unmarshals for you
+func (t *Track) ReadRTP() (*rtp.Packet, error) {
 	r := &rtp.Packet{}
-	if err := r.Unmarshal(b[:i]); err != nil {
+	if err := t.ReadRTPInto(r); err != nil {
 		return nil, err
 	}
 	return r, nil
 }
 
+// ReadRTPInto is like ReadRTP, but unmarshals into a caller supplied packet.
+// The memory referenced by p.Raw is reused to read into if it is large enough,
+// so calling ReadRTPInto with the same packet doesn't allocate for every read.
+// This invalidates the Payload and Raw of the previous packet read into p.
+func (t *Track) ReadRTPInto(p *rtp.Packet) error {
+	b := p.Raw[:cap(p.Raw)]
+	if len(b) < receiveMTU {
+		b = make([]byte, receiveMTU)
+	}
+
+	i, err := t.Read(b)
+	if err != nil {
+		return err
+	}
+
+	return p.Unmarshal(b[:i])
+}
+
 // Write writes data to the track. If this is a remote track this will error
 func (t *Track) Write(b []byte) (n int, err error) {
 	packet := &rtp.Packet{}
@@ -128,6 +427,70 @@ func (t *Track) Write(b []byte) (n int, err error) {
 	return len(b), nil
 }
 
+// SetWriteDeadline makes writes to this local Track wait until at least one of
+// its RTPSenders has started sending, so the first packets, like a keyframe,
+// aren't lost when they are written before the PeerConnection is connected.
+// Writes fail with ErrNoActiveSender once the deadline has passed. A zero value
+// restores the default, where writes without an active RTPSender are dropped.
+func (t *Track) SetWriteDeadline(deadline time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.receiver != nil {
+		return fmt.Errorf("this is a remote track and has no write deadline")
+	}
+	t.writeDeadline = deadline
+
+	// Wake up writes that wait for the previous deadline
+	t.activateSenders()
+	return nil
+}
+
+// activateSenders wakes up writes that wait for an active RTPSender, t.mu must be held
+func (t *Track) activateSenders() {
+	if t.sendersActivated != nil {
+		close(t.sendersActivated)
+		t.sendersActivated = nil
+	}
+}
+
+// writeSenders returns the RTPSenders a write is sent with. If a write deadline
+// is set it waits until one of them is active.
+func (t *Track) writeSenders() ([]*RTPSender, error) {
+	for {
+		t.mu.Lock()
+		if t.receiver != nil {
+			t.mu.Unlock()
+			return nil, fmt.Errorf("this is a remote track and must not be written to")
+		}
+		senders := t.activeSenders
+		totalSenderCount := t.totalSenderCount
+		deadline := t.writeDeadline
+
+		if len(senders) != 0 || deadline.IsZero() {
+			t.mu.Unlock()
+			if totalSenderCount == 0 {
+				return nil, io.ErrClosedPipe
+			}
+			return senders, nil
+		}
+
+		if t.sendersActivated == nil {
+			t.sendersActivated = make(chan struct{})
+		}
+		activated := t.sendersActivated
+		t.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(deadline))
+		select {
+		case <-activated:
+			timer.Stop()
+		case <-timer.C:
+			return nil, ErrNoActiveSender
+		}
+	}
+}
+
 // WriteSample packetizes and writes to the track
 func (t *Track) WriteSample(s media.Sample) error {
 	packets := t.packetizer.Packetize(s.Data, s.Samples)
@@ -143,17 +506,9 @@ func (t *Track) WriteSample(s media.Sample) error {
 
 // WriteRTP writes RTP packets to the track
 func (t *Track) WriteRTP(p *rtp.Packet) error {
-	t.mu.RLock()
-	if t.receiver != nil {
-		t.mu.RUnlock()
-		return fmt.Errorf("this is a remote track and must not be written to")
-	}
-	senders := t.activeSenders
-	totalSenderCount := t.totalSenderCount
-	t.mu.RUnlock()
-
-	if totalSenderCount == 0 {
-		return io.ErrClosedPipe
+	senders, err := t.writeSenders()
+	if err != nil {
+		return err
 	}
 
 	for _, s := range senders {
@@ -163,13 +518,103 @@ func (t *Track) WriteRTP(p *rtp.Packet) error {
 		}
 	}
 
+	t.mu.Lock()
+	t.onRTPWritten(p)
+	t.mu.Unlock()
+
+	return nil
+}
+
+// WriteRTPBatch writes multiple RTP packets to the track in order. Compared to
+// calling WriteRTP for every packet, the RTPSenders and their SRTP streams are
+// looked up and the locks of the Track and of SetMaxLayers and MaxBitrate are
+// taken once per batch. Every packet is still encrypted and written on its own,
+// which is most of the cost of writing it.
+func (t *Track) WriteRTPBatch(packets []*rtp.Packet) error {
+	senders, err := t.writeSenders()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range senders {
+		if err := s.sendRTPBatch(packets); err != nil {
+			return err
+		}
+	}
+
+	t.mu.Lock()
+	for _, p := range packets {
+		t.onRTPWritten(p)
+	}
+	t.mu.Unlock()
+
 	return nil
 }
 
+// onRTPWritten updates the state used for Sender Reports and Stats, t.mu must be held
+func (t *Track) onRTPWritten(p *rtp.Packet) {
+	t.updateStats(&p.Header, len(p.Payload))
+
+	t.packetsSent++
+	t.octetsSent += uint32(len(p.Payload))
+	t.lastRTPTimestamp = p.Timestamp
+	t.lastRTPTime = time.Now()
+}
+
+// SenderReport generates a RTCP Sender Report for this local track at the
+// given time. The RTP timestamp of the report is extrapolated from the last
+// written packet using the ClockRate of the track.
+func (t *Track) SenderReport(now time.Time) (*rtcp.SenderReport, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.receiver != nil {
+		return nil, fmt.Errorf("this is a remote track and can't generate Sender Reports")
+	}
+
+	rtpTime := t.lastRTPTimestamp
+	if !t.lastRTPTime.IsZero() {
+		elapsed := now.Sub(t.lastRTPTime)
+		rtpTime += uint32(elapsed.Seconds() * float64(t.clockRate))
+	}
+
+	return &rtcp.SenderReport{
+		SSRC:        t.ssrc,
+		NTPTime:     toNTPTime(now),
+		RTPTime:     rtpTime,
+		PacketCount: t.packetsSent,
+		OctetCount:  t.octetsSent,
+	}, nil
+}
+
+// toNTPTime converts a time.Time to the 64 bit fixed point format used by NTP
+// https://tools.ietf.org/html/rfc3550#section-4
+func toNTPTime(t time.Time) uint64 {
+	// Seconds between the NTP epoch (1900) and the Unix epoch (1970)
+	const ntpEpochOffset = 2208988800
+
+	nanos := uint64(t.UnixNano())
+	seconds := nanos/uint64(time.Second) + ntpEpochOffset
+	fraction := (nanos % uint64(time.Second)) << 32 / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
 // NewTrack initializes a new *Track
 func NewTrack(payloadType uint8, ssrc uint32, id, label string, codec *RTPCodec) (*Track, error) {
+	return NewTrackWithClockRate(payloadType, ssrc, id, label, codec, codec.ClockRate)
+}
+
+// NewTrackWithClockRate initializes a new *Track that uses the given RTP clock
+// rate instead of the one of the codec. The clock rate is used for the
+// timestamps of Sender Reports and samples written with WriteSample.
+func NewTrackWithClockRate(payloadType uint8, ssrc uint32, id, label string, codec *RTPCodec, clockRate uint32) (*Track, error) {
+	return newTrack(payloadType, ssrc, id, label, codec, clockRate, rtp.NewRandomSequencer())
+}
+
+func newTrack(payloadType uint8, ssrc uint32, id, label string, codec *RTPCodec, clockRate uint32, sequencer rtp.Sequencer) (*Track, error) {
 	if ssrc == 0 {
 		return nil, fmt.Errorf("SSRC supplied to NewTrack() must be non-zero")
+	} else if clockRate == 0 {
+		return nil, fmt.Errorf("clock rate supplied to NewTrack() must be non-zero")
 	}
 
 	packetizer := rtp.NewPacketizer(
@@ -177,8 +622,8 @@ func NewTrack(payloadType uint8, ssrc uint32, id, label string, codec *RTPCodec)
 		payloadType,
 		ssrc,
 		codec.Payloader,
-		rtp.NewRandomSequencer(),
-		codec.ClockRate,
+		sequencer,
+		clockRate,
 	)
 
 	return &Track{
@@ -188,21 +633,33 @@ func NewTrack(payloadType uint8, ssrc uint32, id, label string, codec *RTPCodec)
 		label:       label,
 		ssrc:        ssrc,
 		codec:       codec,
+		clockRate:   clockRate,
 		packetizer:  packetizer,
+		sequencer:   sequencer,
 	}, nil
 }
 
 // determinePayloadType blocks and reads a single packet to determine the PayloadType for this Track
 // this is useful if we are dealing with a remote track and we can't announce it to the user until we know the payloadType
 func (t *Track) determinePayloadType() error {
-	r, err := t.ReadRTP()
+	t.mu.RLock()
+	r := t.receiver
+	t.mu.RUnlock()
+
+	b := make([]byte, receiveMTU)
+	n, err := r.readRTP(b)
 	if err != nil {
 		return err
 	}
 
+	header := rtp.Header{}
+	if err = header.Unmarshal(b[:n]); err != nil {
+		return err
+	}
+
 	t.mu.Lock()
-	t.payloadType = r.PayloadType
 	defer t.mu.Unlock()
-
+	t.payloadType = header.PayloadType
+	t.peeked = b[:n]
 	return nil
 }
@@ -3,10 +3,57 @@
 package webrtc
 
 import (
+	"fmt"
+	"io"
 	"math/rand"
+	"net"
 	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v2/pkg/media"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// connectTrackPair signals two PeerConnections where pcOffer sends a VP8 Track
+// and returns once the remote Track has been announced via OnTrack
+func connectTrackPair(tb testing.TB) (pcOffer, pcAnswer *PeerConnection, local, remote *Track) {
+	return connectTrackPairWithAPI(tb, NewAPI())
+}
+
+// connectTrackPairWithAPI is like connectTrackPair, but creates both PeerConnections with the given API
+func connectTrackPairWithAPI(tb testing.TB, api *API) (pcOffer, pcAnswer *PeerConnection, local, remote *Track) {
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, pcAnswer, err := api.newPair(Configuration{})
+	require.NoError(tb, err)
+
+	_, err = pcAnswer.AddTransceiverFromKind(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	require.NoError(tb, err)
+
+	local, err = pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	require.NoError(tb, err)
+
+	_, err = pcOffer.AddTrack(local)
+	require.NoError(tb, err)
+
+	remoteChan := make(chan *Track, 1)
+	pcAnswer.OnTrack(func(t *Track, r *RTPReceiver) {
+		remoteChan <- t
+	})
+
+	require.NoError(tb, signalPair(pcOffer, pcAnswer))
+
+	for {
+		select {
+		case remote = <-remoteChan:
+			return pcOffer, pcAnswer, local, remote
+		case <-time.After(20 * time.Millisecond):
+			require.NoError(tb, local.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+		}
+	}
+}
+
 func TestNewVideoTrack(t *testing.T) {
 	m := MediaEngine{}
 	m.RegisterCodec(NewRTPVP8Codec(DefaultPayloadTypeVP8, 90000))
@@ -47,6 +94,26 @@ func TestNewAudioTrack(t *testing.T) {
 	}
 }
 
+func TestNewTrack_UnregisteredPayloadType(t *testing.T) {
+	m := MediaEngine{}
+	m.RegisterCodec(NewRTPVP8Codec(DefaultPayloadTypeVP8, 90000))
+	peer, err := NewAPI(WithMediaEngine(m)).NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+
+	_, err = peer.NewTrack(DefaultPayloadTypeOpus, rand.Uint32(), "audio", "pion")
+	assert.Equal(t, ErrUnregisteredPayloadType, err)
+
+	_, err = peer.NewTrackWithClockRate(DefaultPayloadTypeOpus, rand.Uint32(), "audio", "pion", 48000)
+	assert.Equal(t, ErrUnregisteredPayloadType, err)
+
+	// A registered PayloadType resolves the codec of the Track
+	track, err := peer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	require.NoError(t, err)
+	assert.Equal(t, VP8, track.Codec().Name)
+
+	assert.NoError(t, peer.Close())
+}
+
 func TestNewTracks(t *testing.T) {
 	m := MediaEngine{}
 	m.RegisterCodec(NewRTPOpusCodec(DefaultPayloadTypeOpus, 48000))
@@ -115,3 +182,560 @@ func TestNewTracksWrite(t *testing.T) {
 		t.Error("Failed to write to audio track")
 	}
 }
+
+func TestTrack_WriteRTPBatch(t *testing.T) {
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+
+	// Use the Packetizer of the Track so sequence numbers continue
+	// from what has already been sent
+	var batch []*rtp.Packet
+	for i := 0; i < 16; i++ {
+		batch = append(batch, local.Packetizer().Packetize([]byte{byte(i)}, 1)...)
+	}
+	assert.NoError(t, local.WriteRTPBatch(batch))
+
+	// Skip packets written while waiting for OnTrack
+	p, err := remote.ReadRTP()
+	for ; err == nil && p.SequenceNumber != batch[0].SequenceNumber; p, err = remote.ReadRTP() {
+	}
+
+	for i, expected := range batch {
+		if i != 0 {
+			p, err = remote.ReadRTP()
+		}
+		require.NoError(t, err)
+		assert.Equal(t, expected.SequenceNumber, p.SequenceNumber)
+		assert.Equal(t, expected.Payload, p.Payload)
+	}
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func benchmarkTrackWrite(b *testing.B, batchSize int) {
+	pcOffer, pcAnswer, local, _ := connectTrackPair(b)
+
+	batch := make([]*rtp.Packet, batchSize)
+	for i := range batch {
+		batch[i] = &rtp.Packet{
+			Header: rtp.Header{
+				Version:     2,
+				PayloadType: local.PayloadType(),
+				SSRC:        local.SSRC(),
+			},
+			Payload: make([]byte, 1000),
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i += batchSize {
+		if batchSize == 1 {
+			if err := local.WriteRTP(batch[0]); err != nil {
+				b.Fatal(err)
+			}
+		} else if err := local.WriteRTPBatch(batch); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+
+	assert.NoError(b, pcOffer.Close())
+	assert.NoError(b, pcAnswer.Close())
+}
+
+func BenchmarkTrack_WriteRTP(b *testing.B) {
+	benchmarkTrackWrite(b, 1)
+}
+
+func BenchmarkTrack_WriteRTPBatch(b *testing.B) {
+	benchmarkTrackWrite(b, 32)
+}
+
+func TestTrack_ReadRTPInto(t *testing.T) {
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+
+	var sent []*rtp.Packet
+	for i := 0; i < 16; i++ {
+		sent = append(sent, local.Packetizer().Packetize([]byte{byte(i), byte(i)}, 1)...)
+	}
+	assert.NoError(t, local.WriteRTPBatch(sent))
+
+	// Skip packets written while waiting for OnTrack
+	p := &rtp.Packet{}
+	err := remote.ReadRTPInto(p)
+	for ; err == nil && p.SequenceNumber != sent[0].SequenceNumber; err = remote.ReadRTPInto(p) {
+	}
+
+	raw := p.Raw
+	for i, expected := range sent {
+		if i != 0 {
+			err = remote.ReadRTPInto(p)
+		}
+		assert.NoError(t, err)
+
+		// Memory of the packet is reused between reads
+		assert.Equal(t, &raw[0], &p.Raw[0])
+
+		assert.Equal(t, expected.SequenceNumber, p.SequenceNumber)
+		assert.Equal(t, expected.Timestamp, p.Timestamp)
+		assert.Equal(t, expected.SSRC, p.SSRC)
+		assert.Equal(t, expected.Payload, p.Payload)
+	}
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestTrack_ReadShortBuffer(t *testing.T) {
+	pcOffer, pcAnswer, _, remote := connectTrackPair(t)
+
+	// The first packet was peeked to determine the PayloadType, a read that is
+	// too short for it doesn't lose it
+	header := make([]byte, 12)
+	n, err := remote.Read(header)
+	assert.Equal(t, io.ErrShortBuffer, err)
+	assert.Equal(t, len(header), n)
+
+	require.NoError(t, remote.SetReadDeadline(time.Now().Add(5*time.Second)))
+	p, err := remote.ReadRTP()
+	require.NoError(t, err)
+	raw, err := p.Marshal()
+	require.NoError(t, err)
+	assert.Equal(t, header, raw[:len(header)])
+	assert.Equal(t, uint64(1), remote.Stats().Packets)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestTrack_SetReadDeadline(t *testing.T) {
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+
+	assert.Error(t, local.SetReadDeadline(time.Now()))
+
+	// Reads return packets written while waiting for OnTrack until the deadline passes
+	assert.NoError(t, remote.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+	var err error
+	for err == nil {
+		_, err = remote.ReadRTP()
+	}
+	netErr, ok := err.(net.Error)
+	require.True(t, ok)
+	assert.True(t, netErr.Timeout())
+
+	// Reads work again once the deadline is cleared
+	assert.NoError(t, remote.SetReadDeadline(time.Time{}))
+	assert.NoError(t, local.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+	_, err = remote.ReadRTP()
+	assert.NoError(t, err)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestTrack_DropPaddingOnlyRTP(t *testing.T) {
+	s := SettingEngine{}
+	s.SetDropPaddingOnlyRTP(true)
+	pcOffer, pcAnswer, local, remote := connectTrackPairWithAPI(t, NewAPI(WithSettingEngine(s)))
+
+	// Two padding-only packets are sent between media marked with 0xA0, 0xA1
+	// and 0xA2, and 0xA1 arrives after 0xA2
+	var packets []*rtp.Packet
+	for _, marker := range []byte{0xA0, 0x00, 0x00, 0xA1, 0xA2} {
+		p := local.Packetizer().Packetize([]byte{marker}, 1)[0]
+		if marker == 0x00 {
+			p.Padding = true
+			p.Payload = []byte{0x00, 0x00, 0x03}
+		}
+		packets = append(packets, p)
+	}
+	assert.NoError(t, local.WriteRTPBatch([]*rtp.Packet{packets[0], packets[1], packets[2], packets[4], packets[3]}))
+
+	// Skip packets written while waiting for OnTrack
+	p, err := remote.ReadRTP()
+	for ; err == nil && p.Payload[len(p.Payload)-1] != 0xA0; p, err = remote.ReadRTP() {
+	}
+	require.NoError(t, err)
+	assert.Equal(t, packets[0].SequenceNumber, p.SequenceNumber)
+
+	// The padding is dropped and the sequence numbers are kept
+	for _, i := range []int{4, 3} {
+		p, err = remote.ReadRTP()
+		require.NoError(t, err)
+		assert.False(t, p.Padding)
+		assert.Equal(t, packets[i].Payload, p.Payload)
+		assert.Equal(t, packets[i].SequenceNumber, p.SequenceNumber)
+	}
+
+	// The padding isn't lost, 0xA1 is out of order
+	stats := remote.Stats()
+	assert.Equal(t, int64(0), stats.PacketsLost)
+	assert.Equal(t, uint64(1), stats.OutOfOrder)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestTrack_OnCodecChange(t *testing.T) {
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+	assert.Equal(t, VP8, remote.Codec().Name)
+
+	codecChanged := make(chan *RTPCodec, 1)
+	remote.OnCodecChange(func(codec *RTPCodec) {
+		codecChanged <- codec
+	})
+
+	// The publisher switches to VP9, packets with an unknown PayloadType are ignored
+	for i, payloadType := range []uint8{120, DefaultPayloadTypeVP9} {
+		p := local.Packetizer().Packetize([]byte{0xA0 + byte(i)}, 1)[0]
+		p.PayloadType = payloadType
+		assert.NoError(t, local.WriteRTP(p))
+	}
+
+	p := readMarked(t, remote, 0xA0)
+	assert.Equal(t, uint8(120), p.PayloadType)
+	assert.Equal(t, VP8, remote.Codec().Name)
+
+	p, err := remote.ReadRTP()
+	require.NoError(t, err)
+	assert.Equal(t, uint8(DefaultPayloadTypeVP9), p.PayloadType)
+	assert.Equal(t, uint8(DefaultPayloadTypeVP9), remote.PayloadType())
+	assert.Equal(t, VP9, remote.Codec().Name)
+
+	select {
+	case codec := <-codecChanged:
+		assert.Equal(t, VP9, codec.Name)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "codec change wasn't reported")
+	}
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+// benchmarkTrackRead writes a single packet before every read, so the
+// difference in allocations between benchmarks is caused by read
+func benchmarkTrackRead(b *testing.B, read func(*Track) error) {
+	pcOffer, pcAnswer, local, remote := connectTrackPair(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := local.WriteSample(media.Sample{Data: make([]byte, 1000), Samples: 1}); err != nil {
+			b.Fatal(err)
+		}
+		if err := read(remote); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+
+	assert.NoError(b, pcOffer.Close())
+	assert.NoError(b, pcAnswer.Close())
+}
+
+func BenchmarkTrack_ReadRTP(b *testing.B) {
+	benchmarkTrackRead(b, func(t *Track) error {
+		_, err := t.ReadRTP()
+		return err
+	})
+}
+
+func BenchmarkTrack_ReadRTPInto(b *testing.B) {
+	p := &rtp.Packet{}
+	benchmarkTrackRead(b, func(t *Track) error {
+		return t.ReadRTPInto(p)
+	})
+}
+
+func TestTrack_ClockRate(t *testing.T) {
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pc, err := api.NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+
+	_, err = pc.NewTrackWithClockRate(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion", 0)
+	assert.Error(t, err)
+
+	defaultTrack, err := pc.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(90000), defaultTrack.ClockRate())
+
+	track, err := pc.NewTrackWithClockRate(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion", 48000)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(48000), track.ClockRate())
+
+	_, err = pc.AddTrack(track)
+	require.NoError(t, err)
+
+	p := &rtp.Packet{
+		Header:  rtp.Header{Version: 2, SSRC: track.SSRC(), Timestamp: 1000},
+		Payload: []byte{0x00, 0x01, 0x02},
+	}
+	require.NoError(t, track.WriteRTP(p))
+
+	// One second after the write the RTP timestamp advanced by the clock rate
+	sr, err := track.SenderReport(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, track.SSRC(), sr.SSRC)
+	assert.Equal(t, uint32(1), sr.PacketCount)
+	assert.Equal(t, uint32(3), sr.OctetCount)
+	assert.GreaterOrEqual(t, sr.RTPTime, uint32(1000+48000))
+	assert.Less(t, sr.RTPTime, uint32(1000+48000+4800))
+
+	assert.NoError(t, pc.Close())
+}
+
+func TestToNTPTime(t *testing.T) {
+	assert.Equal(t, uint64(2208988800)<<32, toNTPTime(time.Unix(0, 0)))
+	assert.Equal(t, uint64(2208988801)<<32|1<<31, toNTPTime(time.Unix(1, int64(time.Second/2))))
+}
+
+func TestTrack_SetWriteDeadline(t *testing.T) {
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, pcAnswer, err := api.newPair(Configuration{})
+	require.NoError(t, err)
+
+	local, err := pcOffer.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	require.NoError(t, err)
+
+	// Without an RTPSender writes fail once the deadline passed
+	assert.NoError(t, local.SetWriteDeadline(time.Now().Add(50*time.Millisecond)))
+	assert.Equal(t, ErrNoActiveSender, local.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+
+	// A single write before signaling reaches the remote once the RTPSender started
+	assert.NoError(t, local.SetWriteDeadline(time.Now().Add(10*time.Second)))
+	writeErr := make(chan error)
+	go func() {
+		writeErr <- local.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1})
+	}()
+
+	_, err = pcAnswer.AddTransceiverFromKind(RTPCodecTypeVideo, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	require.NoError(t, err)
+	_, err = pcOffer.AddTrack(local)
+	require.NoError(t, err)
+
+	onTrack := make(chan struct{})
+	pcAnswer.OnTrack(func(*Track, *RTPReceiver) {
+		close(onTrack)
+	})
+	require.NoError(t, signalPair(pcOffer, pcAnswer))
+
+	assert.NoError(t, <-writeErr)
+	<-onTrack
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestTrack_SenderCount(t *testing.T) {
+	api := NewAPI()
+	api.mediaEngine.RegisterDefaultCodecs()
+
+	pcA, err := api.NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+	pcB, err := api.NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+
+	track, err := pcA.NewTrack(DefaultPayloadTypeVP8, rand.Uint32(), "video", "pion")
+	require.NoError(t, err)
+	assert.Equal(t, 0, track.SenderCount())
+
+	counts := make(chan int)
+	track.OnSenderCountChange(func(count int) {
+		counts <- count
+	})
+
+	senderA, err := pcA.AddTrack(track)
+	require.NoError(t, err)
+	assert.Equal(t, 1, <-counts)
+
+	senderB, err := pcB.AddTrack(track)
+	require.NoError(t, err)
+	assert.Equal(t, 2, <-counts)
+	assert.Equal(t, 2, track.SenderCount())
+
+	require.NoError(t, pcA.RemoveTrack(senderA))
+	assert.Equal(t, 1, <-counts)
+
+	// Removing the same Track twice doesn't change the count again
+	assert.Error(t, pcA.RemoveTrack(senderA))
+
+	require.NoError(t, pcB.RemoveTrack(senderB))
+	assert.Equal(t, 0, <-counts)
+	assert.Equal(t, 0, track.SenderCount())
+
+	assert.NoError(t, pcA.Close())
+	assert.NoError(t, pcB.Close())
+}
+
+func TestTrack_Stats(t *testing.T) {
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+	drainTrack(t, remote)
+
+	// Write three packets after those written while waiting for OnTrack, the
+	// last two out of order
+	before := local.Stats()
+	sequenceNumber := before.LastSequenceNumber + 1
+	for i, offset := range []uint16{0, 2, 1} {
+		assert.NoError(t, local.WriteRTP(&rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    local.PayloadType(),
+				SSRC:           local.SSRC(),
+				SequenceNumber: sequenceNumber + offset,
+				Timestamp:      uint32(1000 + i),
+			},
+			Payload: make([]byte, i+1),
+		}))
+	}
+
+	expected := TrackStats{
+		Packets:            before.Packets + 3,
+		PayloadBytes:       before.PayloadBytes + 6,
+		LastSequenceNumber: sequenceNumber + 1,
+		LastTimestamp:      1002,
+		OutOfOrder:         before.OutOfOrder + 1,
+		PacketsLost:        before.PacketsLost,
+	}
+	assert.Equal(t, expected, local.Stats())
+
+	// The remote counts the same packets when reading them
+	before = remote.Stats()
+	for range []int{0, 1, 2} {
+		_, err := remote.ReadRTP()
+		assert.NoError(t, err)
+	}
+	expected.Packets = before.Packets + 3
+	expected.PayloadBytes = before.PayloadBytes + 6
+	expected.OutOfOrder = before.OutOfOrder + 1
+	expected.PacketsLost = before.PacketsLost
+	assert.Equal(t, expected, remote.Stats())
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestRTPReceiver_ResetStats(t *testing.T) {
+	pcOffer, pcAnswer, local, remote := connectTrackPair(t)
+	drainTrack(t, remote)
+	receiver := pcAnswer.GetReceivers()[0]
+
+	// sendAndRead writes and reads packets with consecutive sequence numbers
+	// starting at the given one
+	sendAndRead := func(sequenceNumber uint16) {
+		for i := uint16(0); i < 5; i++ {
+			assert.NoError(t, local.WriteRTP(&rtp.Packet{
+				Header: rtp.Header{
+					Version:        2,
+					PayloadType:    local.PayloadType(),
+					SSRC:           local.SSRC(),
+					SequenceNumber: sequenceNumber + i,
+				},
+				Payload: []byte{0x00},
+			}))
+			_, err := remote.ReadRTP()
+			assert.NoError(t, err)
+		}
+	}
+
+	receiver.ResetStats()
+	assert.Equal(t, TrackStats{}, remote.Stats())
+	sequenceNumber := local.Stats().LastSequenceNumber + 1
+	sendAndRead(sequenceNumber)
+	assert.Equal(t, uint64(5), remote.Stats().Packets)
+	assert.Equal(t, int64(0), remote.Stats().PacketsLost)
+
+	// Switching to a source with other sequence numbers looks like loss
+	sendAndRead(sequenceNumber + 1000)
+	assert.Equal(t, int64(995), remote.Stats().PacketsLost)
+
+	// unless the RTPReceiver is reset with the switch
+	receiver.ResetStats()
+	sendAndRead(sequenceNumber + 2000)
+	assert.Equal(t, uint64(5), remote.Stats().Packets)
+	assert.Equal(t, int64(0), remote.Stats().PacketsLost)
+	assert.Equal(t, uint64(0), remote.Stats().OutOfOrder)
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestTrack_SetPlayoutDelay(t *testing.T) {
+	api := NewAPI()
+	api.mediaEngine.RegisterPlayoutDelay()
+	pcOffer, pcAnswer, local, remote := connectTrackPairWithAPI(t, api)
+
+	extMap := fmt.Sprintf("a=extmap:%d %s", playoutDelayExtensionID, PlayoutDelayURI)
+	assert.Contains(t, pcOffer.LocalDescription().SDP, extMap)
+	assert.Contains(t, pcAnswer.LocalDescription().SDP, extMap)
+
+	assert.Error(t, local.SetPlayoutDelay(-time.Millisecond, 0))
+	assert.Error(t, local.SetPlayoutDelay(20*time.Millisecond, 10*time.Millisecond))
+	assert.Error(t, local.SetPlayoutDelay(0, 41*time.Second))
+	assert.Error(t, remote.SetPlayoutDelay(0, 0))
+	require.NoError(t, local.SetPlayoutDelay(30*time.Millisecond, time.Second))
+
+	// Packets written before SetPlayoutDelay may still be buffered
+	for {
+		require.NoError(t, local.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 1}))
+		p, err := remote.ReadRTP()
+		require.NoError(t, err)
+		if playoutDelay, ok := oneByteHeaderExtension(&p.Header, playoutDelayExtensionID); ok {
+			assert.Equal(t, []byte{0x00, 0x30, 0x64}, playoutDelay)
+			break
+		}
+	}
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
+
+func TestTrack_Codec_Negotiated(t *testing.T) {
+	offerAPI := NewAPI()
+	offerAPI.mediaEngine.RegisterDefaultCodecs()
+	pcOffer, err := offerAPI.NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+
+	// The answerer assigned another PayloadType to Opus and answers with the one
+	// of the offer, which the remote Track is sent with
+	s := SettingEngine{}
+	s.SetMirrorRemotePayloadTypes(true)
+	answerAPI := NewAPI(WithSettingEngine(s))
+	answerAPI.mediaEngine.RegisterCodec(NewRTPOpusCodec(109, 48000))
+	pcAnswer, err := answerAPI.NewPeerConnection(Configuration{})
+	require.NoError(t, err)
+
+	_, err = pcAnswer.AddTransceiverFromKind(RTPCodecTypeAudio, RtpTransceiverInit{Direction: RTPTransceiverDirectionRecvonly})
+	require.NoError(t, err)
+	local, err := pcOffer.NewTrack(DefaultPayloadTypeOpus, rand.Uint32(), "audio", "pion")
+	require.NoError(t, err)
+	_, err = pcOffer.AddTrack(local)
+	require.NoError(t, err)
+
+	remoteChan := make(chan *Track, 1)
+	pcAnswer.OnTrack(func(t *Track, r *RTPReceiver) {
+		remoteChan <- t
+	})
+	require.NoError(t, signalPair(pcOffer, pcAnswer))
+
+	var remote *Track
+	for remote == nil {
+		select {
+		case remote = <-remoteChan:
+		case <-time.After(20 * time.Millisecond):
+			require.NoError(t, local.WriteSample(media.Sample{Data: []byte{0x00}, Samples: 960}))
+		}
+	}
+
+	codec := remote.Codec()
+	assert.Equal(t, Opus, codec.Name)
+	assert.Equal(t, uint8(DefaultPayloadTypeOpus), codec.PayloadType)
+	assert.Equal(t, uint16(2), codec.Channels)
+	assert.Equal(t, uint32(48000), codec.ClockRate)
+	assert.Equal(t, RTPCodecTypeAudio, remote.Kind())
+
+	assert.NoError(t, pcOffer.Close())
+	assert.NoError(t, pcAnswer.Close())
+}
@@ -0,0 +1,161 @@
+package webrtc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+const (
+	// transportCCFormat is the FMT of transport-wide congestion control feedback
+	transportCCFormat = 15
+
+	transportCCHeaderLength = 20
+	transportCCDeltaUnit    = 250 * time.Microsecond
+	transportCCTimeUnit     = 64 * time.Millisecond
+)
+
+// The status symbols of the packets in transport-wide congestion control feedback
+const (
+	transportCCNotReceived = iota
+	transportCCSmallDelta
+	transportCCLargeDelta
+)
+
+// TransportCCFeedback is the decoded transport-wide congestion control
+// feedback the remote sends for packets that carry the transport-wide
+// sequence number header extension. It reports for a range of sequence
+// numbers which packets arrived and when, which is the input of delay based
+// bandwidth estimators like GCC.
+// https://tools.ietf.org/html/draft-holmer-rmcat-transport-wide-cc-extensions-01
+type TransportCCFeedback struct {
+	SenderSSRC uint32
+	MediaSSRC  uint32
+
+	// FeedbackPacketCount counts the feedback packets the remote has sent, so
+	// lost feedback can be detected
+	FeedbackPacketCount uint8
+
+	// ReferenceTime is the time the arrival times are relative to, on the clock
+	// of the remote
+	ReferenceTime time.Duration
+
+	// Packets holds the status of every sequence number the feedback covers, in order
+	Packets []TransportCCPacketFeedback
+}
+
+// TransportCCPacketFeedback is the status of a single packet in TransportCCFeedback
+type TransportCCPacketFeedback struct {
+	SequenceNumber uint16
+	Received       bool
+
+	// Delta is the time between the arrival of this packet and the previous
+	// one that was received, or ReferenceTime for the first. It can be negative
+	// if packets arrived out of order. It is zero for lost packets.
+	Delta time.Duration
+
+	// ArrivalTime is when the packet arrived on the clock of the remote, it is
+	// zero for lost packets
+	ArrivalTime time.Duration
+}
+
+// isTransportCCFeedback returns true if a RTCP packet that pion/rtcp doesn't
+// know is transport-wide congestion control feedback
+func isTransportCCFeedback(p *rtcp.RawPacket) bool {
+	header := p.Header()
+	return header.Type == rtcp.TypeTransportSpecificFeedback && header.Count == transportCCFormat
+}
+
+// Unmarshal decodes transport-wide congestion control feedback from a RTCP
+// packet, like one pion/rtcp returns as a RawPacket
+func (f *TransportCCFeedback) Unmarshal(raw []byte) error {
+	var header rtcp.Header
+	if err := header.Unmarshal(raw); err != nil {
+		return err
+	} else if header.Type != rtcp.TypeTransportSpecificFeedback || header.Count != transportCCFormat {
+		return fmt.Errorf("RTCP packet is not transport-wide congestion control feedback")
+	}
+
+	length := int(header.Length+1) * 4
+	if len(raw) < length || length < transportCCHeaderLength {
+		return fmt.Errorf("transport-wide congestion control feedback is too short")
+	}
+	raw = raw[:length]
+
+	*f = TransportCCFeedback{
+		SenderSSRC:          binary.BigEndian.Uint32(raw[4:]),
+		MediaSSRC:           binary.BigEndian.Uint32(raw[8:]),
+		FeedbackPacketCount: raw[19],
+	}
+	baseSequenceNumber := binary.BigEndian.Uint16(raw[12:])
+	statusCount := int(binary.BigEndian.Uint16(raw[14:]))
+
+	// The reference time is a signed 24 bit integer
+	referenceTime := int32(binary.BigEndian.Uint32(raw[16:])) >> 8
+	f.ReferenceTime = time.Duration(referenceTime) * transportCCTimeUnit
+
+	// The packet chunks hold the status symbols of statusCount packets
+	symbols := make([]uint8, 0, statusCount)
+	offset := transportCCHeaderLength
+	for len(symbols) < statusCount {
+		if offset+2 > len(raw) {
+			return fmt.Errorf("transport-wide congestion control feedback is missing packet chunks")
+		}
+		chunk := binary.BigEndian.Uint16(raw[offset:])
+		offset += 2
+
+		switch {
+		case chunk&0x8000 == 0:
+			// Run length chunk, one symbol for up to 8191 packets
+			symbol := uint8(chunk >> 13 & 0x03)
+			for i := 0; i < int(chunk&0x1FFF) && len(symbols) < statusCount; i++ {
+				symbols = append(symbols, symbol)
+			}
+		case chunk&0x4000 == 0:
+			// Status vector chunk with 14 one bit symbols
+			for i := 13; i >= 0 && len(symbols) < statusCount; i-- {
+				symbols = append(symbols, uint8(chunk>>uint(i)&0x01))
+			}
+		default:
+			// Status vector chunk with 7 two bit symbols
+			for i := 6; i >= 0 && len(symbols) < statusCount; i-- {
+				symbols = append(symbols, uint8(chunk>>uint(2*i)&0x03))
+			}
+		}
+	}
+
+	// A receive delta follows for every received packet
+	arrivalTime := f.ReferenceTime
+	f.Packets = make([]TransportCCPacketFeedback, 0, statusCount)
+	for i, symbol := range symbols {
+		packet := TransportCCPacketFeedback{SequenceNumber: baseSequenceNumber + uint16(i)}
+
+		switch symbol {
+		case transportCCNotReceived:
+		case transportCCSmallDelta:
+			if offset+1 > len(raw) {
+				return fmt.Errorf("transport-wide congestion control feedback is missing receive deltas")
+			}
+			packet.Delta = time.Duration(raw[offset]) * transportCCDeltaUnit
+			offset++
+		case transportCCLargeDelta:
+			if offset+2 > len(raw) {
+				return fmt.Errorf("transport-wide congestion control feedback is missing receive deltas")
+			}
+			packet.Delta = time.Duration(int16(binary.BigEndian.Uint16(raw[offset:]))) * transportCCDeltaUnit
+			offset += 2
+		default:
+			return fmt.Errorf("invalid packet status symbol %d in transport-wide congestion control feedback", symbol)
+		}
+
+		if symbol != transportCCNotReceived {
+			arrivalTime += packet.Delta
+			packet.Received = true
+			packet.ArrivalTime = arrivalTime
+		}
+		f.Packets = append(f.Packets, packet)
+	}
+	return nil
+}
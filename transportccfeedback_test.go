@@ -0,0 +1,58 @@
+package webrtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransportCCFeedback_Unmarshal(t *testing.T) {
+	raw := []byte{
+		0x8F, 0xCD, 0x00, 0x08, // FMT 15, PT 205, length 8
+		0x01, 0x02, 0x03, 0x04, // sender SSRC
+		0x05, 0x06, 0x07, 0x08, // media SSRC
+		0x00, 0x64, 0x00, 0x14, // base sequence number 100, 20 packets
+		0xFF, 0xFF, 0xFF, 0x03, // reference time -64ms, feedback packet count 3
+		0x20, 0x03, // run length: 3 small deltas
+		0xE1, 0x40, // two bit vector: large, lost, small, small, lost, lost, lost
+		0xA0, 0x10, // one bit vector: received, 8 lost, received
+		0x04, 0x08, 0x00, 0xFF, 0xFC, 0x28, 0x01, 0x14, 0xFF, // receive deltas
+		0x00, // padding
+	}
+
+	feedback := TransportCCFeedback{}
+	assert.NoError(t, feedback.Unmarshal(raw))
+	assert.Equal(t, uint32(0x01020304), feedback.SenderSSRC)
+	assert.Equal(t, uint32(0x05060708), feedback.MediaSSRC)
+	assert.Equal(t, uint8(3), feedback.FeedbackPacketCount)
+	assert.Equal(t, -64*time.Millisecond, feedback.ReferenceTime)
+	assert.Equal(t, 20, len(feedback.Packets))
+
+	arrivalTimes := map[uint16]time.Duration{
+		100: -63 * time.Millisecond,
+		101: -61 * time.Millisecond,
+		102: -61 * time.Millisecond,
+		103: -62 * time.Millisecond,
+		105: -52 * time.Millisecond,
+		106: -51750 * time.Microsecond,
+		110: -46750 * time.Microsecond,
+		119: 17 * time.Millisecond,
+	}
+	for i, packet := range feedback.Packets {
+		assert.Equal(t, uint16(100+i), packet.SequenceNumber)
+		arrivalTime, received := arrivalTimes[packet.SequenceNumber]
+		assert.Equal(t, received, packet.Received, "sequence number %d", packet.SequenceNumber)
+		assert.Equal(t, arrivalTime, packet.ArrivalTime, "sequence number %d", packet.SequenceNumber)
+	}
+	assert.Equal(t, -1*time.Millisecond, feedback.Packets[3].Delta)
+
+	assert.True(t, isTransportCCFeedback((*rtcp.RawPacket)(&raw)))
+	assert.Error(t, feedback.Unmarshal(raw[:24]))
+	assert.Error(t, feedback.Unmarshal(append([]byte{0x8F, 0xCD, 0x00, 0x07}, raw[4:32]...)))
+
+	pli, err := (&rtcp.PictureLossIndication{MediaSSRC: 1}).Marshal()
+	assert.NoError(t, err)
+	assert.Error(t, feedback.Unmarshal(pli))
+}